@@ -0,0 +1,13 @@
+CREATE TABLE image_uploads (
+    id text PRIMARY KEY,
+    user_id int4 REFERENCES users(id) ON DELETE CASCADE,
+    object_name text NOT NULL,
+    multipart_id text NOT NULL,
+    upload_length int8 NOT NULL,
+    upload_offset int8 NOT NULL DEFAULT 0,
+    part_count int4 NOT NULL DEFAULT 0,
+    tail_size int8 NOT NULL DEFAULT 0,
+    file_name text NOT NULL,
+    metadata text NOT NULL DEFAULT '',
+    created_at timestamp NOT NULL DEFAULT now()
+);
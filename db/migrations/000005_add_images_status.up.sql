@@ -0,0 +1,4 @@
+ALTER TABLE images
+    ADD COLUMN status text NOT NULL DEFAULT 'ready',
+    ADD COLUMN content_type text,
+    ADD COLUMN size int8;
@@ -0,0 +1,20 @@
+CREATE TABLE import_jobs (
+    id serial PRIMARY KEY,
+    user_id int4 REFERENCES users(id) ON DELETE CASCADE,
+    status text NOT NULL DEFAULT 'pending',
+    created_at timestamp NOT NULL DEFAULT now(),
+    updated_at timestamp NOT NULL DEFAULT now()
+);
+
+CREATE INDEX import_jobs_status_idx ON import_jobs(status);
+
+CREATE TABLE import_items (
+    id serial PRIMARY KEY,
+    job_id int4 NOT NULL REFERENCES import_jobs(id) ON DELETE CASCADE,
+    url text NOT NULL,
+    status text NOT NULL DEFAULT 'pending',
+    image_id int4 REFERENCES images(id) ON DELETE SET NULL,
+    error text
+);
+
+CREATE INDEX import_items_job_id_idx ON import_items(job_id);
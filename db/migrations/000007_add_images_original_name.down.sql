@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS images_user_id_created_at_idx;
+
+ALTER TABLE images
+    DROP COLUMN IF EXISTS original_name,
+    DROP COLUMN IF EXISTS created_at;
@@ -0,0 +1,5 @@
+ALTER TABLE images
+    ADD COLUMN original_name text,
+    ADD COLUMN created_at timestamp NOT NULL DEFAULT now();
+
+CREATE INDEX images_user_id_created_at_idx ON images(user_id, created_at);
@@ -0,0 +1,5 @@
+CREATE TABLE tg_link_codes (
+    code text PRIMARY KEY,
+    user_id int4 NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at timestamp NOT NULL
+);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS tg_chat_states;
@@ -0,0 +1,6 @@
+CREATE TABLE tg_chat_states (
+    chat_id int8 PRIMARY KEY,
+    state text NOT NULL,
+    data text NOT NULL DEFAULT '',
+    updated_at timestamp NOT NULL DEFAULT now()
+);
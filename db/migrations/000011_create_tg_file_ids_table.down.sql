@@ -0,0 +1 @@
+DROP TABLE IF EXISTS tg_file_ids;
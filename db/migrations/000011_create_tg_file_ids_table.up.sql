@@ -0,0 +1,5 @@
+CREATE TABLE tg_file_ids (
+    image_id int4 PRIMARY KEY REFERENCES images(id) ON DELETE CASCADE,
+    file_id text NOT NULL,
+    created_at timestamp NOT NULL DEFAULT now()
+);
@@ -0,0 +1,4 @@
+DELETE FROM tg_file_ids WHERE variant <> 'photo';
+ALTER TABLE tg_file_ids DROP CONSTRAINT tg_file_ids_pkey;
+ALTER TABLE tg_file_ids DROP COLUMN variant;
+ALTER TABLE tg_file_ids ADD PRIMARY KEY (image_id);
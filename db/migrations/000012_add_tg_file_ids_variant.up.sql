@@ -0,0 +1,3 @@
+ALTER TABLE tg_file_ids ADD COLUMN variant text NOT NULL DEFAULT 'photo';
+ALTER TABLE tg_file_ids DROP CONSTRAINT tg_file_ids_pkey;
+ALTER TABLE tg_file_ids ADD PRIMARY KEY (image_id, variant);
@@ -0,0 +1,6 @@
+CREATE TABLE notification_settings (
+    user_id int4 PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    image_uploaded bool NOT NULL DEFAULT true,
+    image_deleted bool NOT NULL DEFAULT true,
+    profile_updated bool NOT NULL DEFAULT true
+);
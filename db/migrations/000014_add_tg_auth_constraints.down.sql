@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS tg_auth_user_id_idx;
+
+ALTER TABLE tg_auth
+    DROP COLUMN last_active_at,
+    DROP COLUMN linked_at,
+    DROP CONSTRAINT tg_auth_user_id_fkey,
+    ADD CONSTRAINT tg_auth_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id),
+    DROP CONSTRAINT tg_auth_telegram_id_key,
+    ALTER COLUMN telegram_id DROP NOT NULL,
+    ALTER COLUMN user_id DROP NOT NULL;
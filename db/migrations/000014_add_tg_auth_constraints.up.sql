@@ -0,0 +1,13 @@
+DELETE FROM tg_auth WHERE user_id IS NULL OR telegram_id IS NULL;
+DELETE FROM tg_auth a USING tg_auth b WHERE a.telegram_id = b.telegram_id AND a.id > b.id;
+
+ALTER TABLE tg_auth
+    ALTER COLUMN user_id SET NOT NULL,
+    ALTER COLUMN telegram_id SET NOT NULL,
+    ADD CONSTRAINT tg_auth_telegram_id_key UNIQUE (telegram_id),
+    DROP CONSTRAINT tg_auth_user_id_fkey,
+    ADD CONSTRAINT tg_auth_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    ADD COLUMN linked_at timestamp NOT NULL DEFAULT now(),
+    ADD COLUMN last_active_at timestamp;
+
+CREATE INDEX tg_auth_user_id_idx ON tg_auth (user_id);
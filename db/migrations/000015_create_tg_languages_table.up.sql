@@ -0,0 +1,5 @@
+CREATE TABLE tg_languages (
+    telegram_id int8 PRIMARY KEY,
+    language text NOT NULL,
+    updated_at timestamp NOT NULL DEFAULT now()
+);
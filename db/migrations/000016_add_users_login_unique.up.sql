@@ -0,0 +1,22 @@
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_login_key;
+-- Logins users sign in with are not changed here. While several users share a login the migration fails
+-- and lists them, they are resolved with db/remediation/000016_duplicate_logins.sql before it is run again.
+DO $$
+DECLARE
+    conflicts text;
+BEGIN
+    SELECT string_agg(format('%L (users %s)', login, ids), ', ' ORDER BY login)
+    INTO conflicts
+    FROM (SELECT login, string_agg(id::text, ', ' ORDER BY id) AS ids
+          FROM users
+          GROUP BY login
+          HAVING count(*) > 1) duplicates;
+
+    IF conflicts IS NOT NULL THEN
+        RAISE EXCEPTION 'users share logins, resolve them before making logins unique: %', conflicts
+            USING HINT = 'see db/remediation/000016_duplicate_logins.sql';
+    END IF;
+END
+$$;
+
+ALTER TABLE users ADD CONSTRAINT users_login_key UNIQUE (login);
@@ -0,0 +1,2 @@
+CREATE INDEX users_name_id_idx ON users (name, id);
+CREATE INDEX users_name_prefix_idx ON users (lower(name) text_pattern_ops);
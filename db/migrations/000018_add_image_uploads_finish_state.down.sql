@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS image_uploads_created_at_idx;
+ALTER TABLE image_uploads DROP COLUMN IF EXISTS image_id;
+ALTER TABLE image_uploads DROP COLUMN IF EXISTS assembled;
@@ -0,0 +1,3 @@
+ALTER TABLE image_uploads ADD COLUMN assembled boolean NOT NULL DEFAULT false;
+ALTER TABLE image_uploads ADD COLUMN image_id int4;
+CREATE INDEX image_uploads_created_at_idx ON image_uploads (created_at);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS images_pending_created_at_idx;
@@ -0,0 +1 @@
+CREATE INDEX images_pending_created_at_idx ON images (created_at) WHERE status = 'pending';
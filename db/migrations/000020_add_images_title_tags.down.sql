@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS images_tags_idx;
+ALTER TABLE images
+    DROP COLUMN IF EXISTS tags,
+    DROP COLUMN IF EXISTS title;
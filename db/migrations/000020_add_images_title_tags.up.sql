@@ -0,0 +1,11 @@
+ALTER TABLE images
+    ADD COLUMN title text,
+    ADD COLUMN tags text[] NOT NULL DEFAULT '{}';
+
+-- captions of images received by the bot were kept as descriptions, their hashtags become the tags
+UPDATE images
+SET tags  = ARRAY(SELECT DISTINCT lower(m[2]) FROM regexp_matches(description, '(^|\s)#(\S+)', 'g') AS m),
+    title = nullif(regexp_replace(trim(regexp_replace(description, '(^|\s)#\S+', ' ', 'g')), '\s+', ' ', 'g'), '')
+WHERE description IS NOT NULL;
+
+CREATE INDEX images_tags_idx ON images USING gin (tags);
@@ -0,0 +1,23 @@
+-- Remediation for migration 000016, which fails while several users share a login.
+-- It is run by hand once the changes are reviewed, never by the migration tool.
+
+-- 1. List the users sharing a login. The oldest account, the one with the lowest id, keeps the login.
+SELECT u.login, u.id, u.name, u.id = min(u.id) OVER (PARTITION BY u.login) AS keeps_login
+FROM users u
+WHERE u.login IN (SELECT login FROM users GROUP BY login HAVING count(*) > 1)
+ORDER BY u.login, u.id;
+
+-- 2. Agree a new login with each of the other users, or delete the accounts that are no longer used,
+--    and apply exactly the reviewed changes in one transaction, e.g.:
+--
+--    BEGIN;
+--    UPDATE users SET login = 'alice.smith' WHERE id = 42 AND login = 'alice';
+--    DELETE FROM users WHERE id = 57 AND login = 'alice';
+--    COMMIT;
+--
+--    Tell every user whose login changed, they sign in with the new login from then on.
+
+-- 3. The failed migration left the schema version dirty at 16. Mark it as not applied and run it again:
+--
+--    migrate -database "$DATABASE_URL" -path db/migrations force 15
+--    migrate -database "$DATABASE_URL" -path db/migrations up
@@ -4,44 +4,46 @@ go 1.19
 
 require (
 	github.com/go-chi/chi v1.5.4
+	github.com/go-telegram-bot-api/telegram-bot-api/v5 v5.5.1
 	github.com/gofrs/uuid v4.0.0+incompatible
 	github.com/golang-jwt/jwt/v5 v5.0.0-rc.1
 	github.com/golang-migrate/migrate/v4 v4.15.2
-	github.com/jinzhu/copier v0.3.5
 	github.com/jmoiron/sqlx v1.3.5
 	github.com/kelseyhightower/envconfig v1.4.0
 	github.com/lib/pq v1.10.7
 	github.com/minio/minio-go/v7 v7.0.49
 	github.com/sirupsen/logrus v1.9.0
+	github.com/swaggo/swag v1.8.10
+)
+
+require (
 	github.com/KyleBanks/depth v1.2.1 // indirect
-    github.com/PuerkitoBio/purell v1.1.1 // indirect
-    github.com/PuerkitoBio/urlesc v0.0.0-20170810143723-de5bf2ad4578 // indirect
-    github.com/dustin/go-humanize v1.0.1 // indirect
-    github.com/go-openapi/jsonpointer v0.19.5 // indirect
-    github.com/go-openapi/jsonreference v0.19.6 // indirect
-    github.com/go-openapi/spec v0.20.4 // indirect
-    github.com/go-openapi/swag v0.19.15 // indirect
-    github.com/go-telegram-bot-api/telegram-bot-api/v5 v5.5.1 // indirect
-    github.com/google/uuid v1.3.0 // indirect
-    github.com/hashicorp/errwrap v1.1.0 // indirect
-    github.com/hashicorp/go-multierror v1.1.1 // indirect
-    github.com/josharian/intern v1.0.0 // indirect
-    github.com/json-iterator/go v1.1.12 // indirect
-    github.com/klauspost/compress v1.15.15 // indirect
-    github.com/klauspost/cpuid/v2 v2.2.3 // indirect
-    github.com/mailru/easyjson v0.7.6 // indirect
-    github.com/minio/md5-simd v1.1.2 // indirect
-    github.com/minio/sha256-simd v1.0.0 // indirect
-    github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
-    github.com/modern-go/reflect2 v1.0.2 // indirect
-    github.com/rs/xid v1.4.0 // indirect
-    github.com/swaggo/swag v1.8.10 // indirect
-    go.uber.org/atomic v1.7.0 // indirect
-    golang.org/x/crypto v0.6.0 // indirect
-    golang.org/x/net v0.7.0 // indirect
-    golang.org/x/sys v0.5.0 // indirect
-    golang.org/x/text v0.7.0 // indirect
-    golang.org/x/tools v0.1.12 // indirect
-    gopkg.in/ini.v1 v1.67.0 // indirect
-    gopkg.in/yaml.v2 v2.4.0 // indirect
+	github.com/PuerkitoBio/purell v1.1.1 // indirect
+	github.com/PuerkitoBio/urlesc v0.0.0-20170810143723-de5bf2ad4578 // indirect
+	github.com/dustin/go-humanize v1.0.1 // indirect
+	github.com/go-openapi/jsonpointer v0.19.5 // indirect
+	github.com/go-openapi/jsonreference v0.19.6 // indirect
+	github.com/go-openapi/spec v0.20.4 // indirect
+	github.com/go-openapi/swag v0.19.15 // indirect
+	github.com/google/uuid v1.3.0 // indirect
+	github.com/hashicorp/errwrap v1.1.0 // indirect
+	github.com/hashicorp/go-multierror v1.1.1 // indirect
+	github.com/josharian/intern v1.0.0 // indirect
+	github.com/json-iterator/go v1.1.12 // indirect
+	github.com/klauspost/compress v1.15.15 // indirect
+	github.com/klauspost/cpuid/v2 v2.2.3 // indirect
+	github.com/mailru/easyjson v0.7.6 // indirect
+	github.com/minio/md5-simd v1.1.2 // indirect
+	github.com/minio/sha256-simd v1.0.0 // indirect
+	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
+	github.com/modern-go/reflect2 v1.0.2 // indirect
+	github.com/rs/xid v1.4.0 // indirect
+	go.uber.org/atomic v1.7.0 // indirect
+	golang.org/x/crypto v0.6.0 // indirect
+	golang.org/x/net v0.7.0 // indirect
+	golang.org/x/sys v0.5.0 // indirect
+	golang.org/x/text v0.7.0 // indirect
+	golang.org/x/tools v0.1.12 // indirect
+	gopkg.in/ini.v1 v1.67.0 // indirect
+	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
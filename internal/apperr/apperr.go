@@ -0,0 +1,62 @@
+// Package apperr defines the errors services and repositories return for failures the client caused,
+// the API turns them into responses by their kind and code.
+package apperr
+
+import "errors"
+
+// Kind classifies an error, the API picks the response status by it.
+type Kind string
+
+const (
+	KindValidation           Kind = "validation"
+	KindUnauthorized         Kind = "unauthorized"
+	KindForbidden            Kind = "forbidden"
+	KindNotFound             Kind = "not_found"
+	KindConflict             Kind = "conflict"
+	KindPreconditionFailed   Kind = "precondition_failed"
+	KindTooLarge             Kind = "too_large"
+	KindUnsupportedMediaType Kind = "unsupported_media_type"
+)
+
+// Error is an error with a kind and a stable code clients can rely on.
+// Validation errors list the invalid fields in Fields.
+type Error struct {
+	Kind   Kind
+	Code   string
+	Err    error
+	Fields []FieldError
+}
+
+// FieldError is a rule an input field breaks. Code names the rule, Param is its argument, such as a length.
+type FieldError struct {
+	Field string
+	Code  string
+	Param string
+}
+
+// New creates an error, it is meant for sentinel errors compared with errors.Is.
+func New(kind Kind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Err: errors.New(message)}
+}
+
+// Wrap gives err a kind and a code, err stays in the chain.
+func Wrap(kind Kind, code string, err error) *Error {
+	return &Error{Kind: kind, Code: code, Err: err}
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// As returns the first *Error in the chain of err.
+func As(err error) (*Error, bool) {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr, true
+	}
+	return nil, false
+}
@@ -1,17 +1,26 @@
 package config
 
-import "github.com/kelseyhightower/envconfig"
+import (
+	"github.com/kelseyhightower/envconfig"
+	"time"
+)
 
 type Config struct {
-	DB         *DB    `envconfig:"db"`
-	App        *App   `envconfig:"app"`
-	JWTKeyword string `envconfig:"jwt_keyword"`
-	Minio      *Minio `envconfig:"minio"`
-	TgBot      TgBot  `envconfig:"tgbot"`
+	DB         *DB     `envconfig:"db"`
+	App        *App    `envconfig:"app"`
+	JWTKeyword string  `envconfig:"jwt_keyword"`
+	Minio      *Minio  `envconfig:"minio"`
+	TgBot      TgBot   `envconfig:"tgbot"`
+	Upload     *Upload `envconfig:"upload"`
+	Import     *Import `envconfig:"import"`
+	Archive    Archive `envconfig:"archive"`
+	Docs       Docs    `envconfig:"docs"`
 }
 
 type App struct {
 	Port string `envconfig:"port"`
+	// ShutdownTimeout bounds how long in-flight requests and bot updates are waited for on shutdown.
+	ShutdownTimeout time.Duration `envconfig:"shutdown_timeout" default:"30s"`
 }
 
 type DB struct {
@@ -29,8 +38,58 @@ type Minio struct {
 	Bucket    string `envconfig:"bucket"`
 }
 
+type Upload struct {
+	PartSize      int64         `envconfig:"part_size" default:"5242880"`
+	MaxSize       int64         `envconfig:"max_size" default:"104857600"`
+	PresignExpiry time.Duration `envconfig:"presign_expiry" default:"15m"`
+	// TTL is how long a resumable upload may take, unfinished uploads are removed after it.
+	TTL time.Duration `envconfig:"ttl" default:"24h"`
+	// BatchConcurrency limits how many files of one batch upload are stored at the same time.
+	BatchConcurrency int `envconfig:"batch_concurrency" default:"4"`
+}
+
+type Import struct {
+	Workers      int           `envconfig:"workers" default:"2"`
+	MaxURLs      int           `envconfig:"max_urls" default:"50"`
+	MaxSize      int64         `envconfig:"max_size" default:"20971520"`
+	Timeout      time.Duration `envconfig:"timeout" default:"30s"`
+	MaxRedirects int           `envconfig:"max_redirects" default:"5"`
+	// AllowedCIDRs lists private networks that may still be fetched from, e.g. an internal CDN.
+	AllowedCIDRs []string `envconfig:"allowed_cidrs"`
+}
+
+type Archive struct {
+	// Prefetch is how many images are opened ahead of the one being written to an archive.
+	Prefetch int `envconfig:"prefetch" default:"4"`
+}
+
+type Docs struct {
+	// Enabled serves the OpenAPI spec at /openapi.json and Swagger UI at /docs/.
+	Enabled bool `envconfig:"enabled"`
+	// BaseURL is the URL clients reach the API at, such as https://images.example.com, it is put into
+	// the spec as its server. The server is the relative "/" when it is empty, it never comes from request headers.
+	BaseURL string `envconfig:"base_url"`
+}
+
 type TgBot struct {
-	APIKey string `envconfig:"api_key" required:"true"`
+	// APIKey is the bot token, the bot is disabled when it is empty.
+	APIKey string `envconfig:"api_key"`
+	// Username is used to build t.me deep links for account linking.
+	Username    string        `envconfig:"username"`
+	LinkCodeTTL time.Duration `envconfig:"link_code_ttl" default:"10m"`
+	// StateTTL is how long the bot waits for the next step of a multi-step command before dropping it.
+	StateTTL time.Duration `envconfig:"state_ttl" default:"5m"`
+	// Workers is how many updates are processed concurrently, updates of one chat are still handled in order.
+	Workers int `envconfig:"workers" default:"4"`
+	// CacheChatID is a chat the bot may post images to, so images it never sent or received get a file_id
+	// and can be shared with inline queries. Without it only images the bot has seen are offered.
+	CacheChatID int64 `envconfig:"cache_chat_id"`
+	// Mode is either "polling" or "webhook".
+	Mode string `envconfig:"mode" default:"polling"`
+	// WebhookURL is the public URL Telegram posts updates to, it has to reach WebhookPath of this server.
+	WebhookURL    string `envconfig:"webhook_url"`
+	WebhookPath   string `envconfig:"webhook_path" default:"/telegram/webhook"`
+	WebhookSecret string `envconfig:"webhook_secret"`
 }
 
 func (c *Config) Process() error {
@@ -1,11 +1,100 @@
 package dto
 
-import "io"
+import (
+	"io"
+	"time"
+)
 
 type Image struct {
-	ID        int
-	UserID    int
-	Name      string
-	Extension string
-	Data      io.Reader
+	ID           int
+	UserID       int
+	Name         string
+	OriginalName string
+	Description  string
+	Title        string
+	Tags         []string
+	Extension    string
+	Data         io.Reader
+}
+
+// PageCursor points at the image a page starts after or, with Before set, ends before.
+// The zero cursor is the first page.
+type PageCursor struct {
+	ImageID int
+	Before  bool
+}
+
+// ImageObject is an image to be sent somewhere. Data is nil until the object is opened,
+// FileID is set instead when Telegram already has the image.
+type ImageObject struct {
+	ID          int
+	Name        string
+	Description string
+	FileID      string
+	// Size is 0 for images stored before sizes were recorded.
+	Size int64
+	Data io.ReadCloser
+}
+
+type ImagePage struct {
+	Images  []ImageObject
+	HasPrev bool
+	HasNext bool
+}
+
+// ArchiveFilter narrows the images put into an archive, zero bounds are open and an empty tag matches every image.
+type ArchiveFilter struct {
+	From time.Time
+	To   time.Time
+	Tag  string
+}
+
+type ArchiveEntry struct {
+	ID           int       `json:"id"`
+	FileName     string    `json:"fileName"`
+	OriginalName string    `json:"originalName,omitempty"`
+	ContentType  string    `json:"contentType,omitempty"`
+	Size         int64     `json:"size"`
+	CreatedAt    time.Time `json:"createdAt"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// ImageFile is one file of a batch upload, Open is called only when the file is processed.
+type ImageFile struct {
+	Name string
+	Size int64
+	Open func() (io.ReadCloser, error)
+}
+
+type ImageResult struct {
+	Name  string `json:"name"`
+	ID    int    `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+type DirectUpload struct {
+	UserID      int    `json:"-"`
+	FileName    string `json:"fileName" validate:"max=255"`
+	ContentType string `json:"contentType" validate:"required"`
+	Size        int64  `json:"size" validate:"min=1"`
+}
+
+type PresignedUpload struct {
+	ImageID   int               `json:"imageId"`
+	URL       string            `json:"url"`
+	Fields    map[string]string `json:"fields"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+}
+
+type ImageInfo struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+}
+
+type ImageSummary struct {
+	Count       int        `json:"count"`
+	TotalSize   int64      `json:"totalSize"`
+	LastAddedAt *time.Time `json:"lastAddedAt,omitempty"`
 }
@@ -0,0 +1,22 @@
+package dto
+
+import "time"
+
+type ImportRequest struct {
+	URLs []string `json:"urls" validate:"required"`
+}
+
+type ImportJob struct {
+	ID        int          `json:"id"`
+	Status    string       `json:"status"`
+	Items     []ImportItem `json:"items"`
+	CreatedAt time.Time    `json:"createdAt"`
+	UpdatedAt time.Time    `json:"updatedAt"`
+}
+
+type ImportItem struct {
+	URL     string `json:"url"`
+	Status  string `json:"status"`
+	ImageID int    `json:"imageId,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
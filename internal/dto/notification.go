@@ -0,0 +1,8 @@
+package dto
+
+// NotificationSettings tells which account events are sent to the user's linked Telegram chats.
+type NotificationSettings struct {
+	ImageUploaded  bool `json:"imageUploaded"`
+	ImageDeleted   bool `json:"imageDeleted"`
+	ProfileUpdated bool `json:"profileUpdated"`
+}
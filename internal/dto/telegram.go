@@ -0,0 +1,19 @@
+package dto
+
+// InlineImage is an image offered as an inline query result, FileID is empty until the image
+// has been uploaded to Telegram once.
+type InlineImage struct {
+	ID          int
+	Title       string
+	Description string
+	FileID      string
+}
+
+// ChatState is the step of a multi-step bot flow a chat is in, Data carries what the flow collected so far.
+// The zero state means the chat is not in any flow.
+type ChatState struct {
+	State string
+	Data  string
+	// Expired is set when the chat was left in a flow for longer than the state timeout.
+	Expired bool
+}
@@ -0,0 +1,10 @@
+package dto
+
+type Upload struct {
+	ID       string
+	UserID   int
+	Length   int64
+	Offset   int64
+	FileName string
+	Metadata string
+}
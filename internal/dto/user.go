@@ -1,30 +1,93 @@
 package dto
 
+import "time"
+
 type UserDto struct {
 	ID          int64  `json:"id"`
-	Name        string `json:"name"`
-	Login       string `json:"login"`
-	Password    string `json:"password"`
-	Description string `json:"description"`
+	Name        string `json:"name" validate:"required,max=100"`
+	Login       string `json:"login" validate:"required,min=3,max=64"`
+	Password    string `json:"password" validate:"required,min=8,max=72"`
+	Description string `json:"description" validate:"max=1000"`
+}
+
+// UserUpdate is the account replaced by PUT, the password is changed by PasswordChange only.
+type UserUpdate struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name" validate:"required,max=100"`
+	Login       string `json:"login" validate:"required,min=3,max=64"`
+	Description string `json:"description" validate:"max=1000"`
+}
+
+// UserProfile is the part of a user changed by PATCH, a nil description is cleared.
+type UserProfile struct {
+	Name        string  `json:"name" validate:"required,max=100"`
+	Login       string  `json:"login" validate:"required,min=3,max=64"`
+	Description *string `json:"description" validate:"max=1000"`
 }
 
+type PasswordChange struct {
+	CurrentPassword string `json:"currentPassword" validate:"required"`
+	NewPassword     string `json:"newPassword" validate:"required,min=8,max=72"`
+}
+
+// UserResponse is a user as its owner sees it.
 type UserResponse struct {
 	ID          int64  `json:"id"`
 	Name        string `json:"name"`
 	Login       string `json:"login"`
-	Password    string `json:"password"`
 	Description string `json:"description"`
 	ImageUrls   []string
 }
 
+// PublicUser is what every user may see of another one.
+type PublicUser struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Me is the profile of the authorized user.
+type Me struct {
+	ID          int64        `json:"id"`
+	Name        string       `json:"name"`
+	Login       string       `json:"login"`
+	Description string       `json:"description"`
+	Images      ImageSummary `json:"images"`
+}
+
+// UserQuery lists users ordered by Sort, "id" or "name", and then by id. Cursor is the
+// NextCursor of the previous page and empty on the first one.
+type UserQuery struct {
+	Search string `json:"search" validate:"max=100"`
+	Sort   string `json:"sort"`
+	Desc   bool   `json:"-"`
+	Cursor string `json:"cursor"`
+	Limit  int    `json:"limit" validate:"min=1,max=100"`
+	// Count asks for the number of users found over all pages.
+	Count bool `json:"count"`
+}
+
+type UserPage struct {
+	Users []PublicUser
+	// NextCursor is empty on the last page.
+	NextCursor string
+	// Total is only set when the query asked for the count.
+	Total *int
+}
+
 type AuthUserDto struct {
-	Login    string `json:"login"`
-	Password string `json:"password"`
+	Login    string `json:"login" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+type TelegramLink struct {
+	TelegramID   int64      `json:"telegramId"`
+	LinkedAt     time.Time  `json:"linkedAt"`
+	LastActiveAt *time.Time `json:"lastActiveAt,omitempty"`
 }
 
-func NewAuthUserDto(login string, password string) AuthUserDto {
-	return AuthUserDto{
-		Login:    login,
-		Password: password,
-	}
+type TelegramLinkCode struct {
+	Code      string    `json:"code"`
+	DeepLink  string    `json:"deepLink,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
 }
@@ -1,8 +1,34 @@
 package entity
 
+import (
+	"database/sql"
+	"github.com/lib/pq"
+	"time"
+)
+
+const (
+	ImageStatusPending = "pending"
+	ImageStatusReady   = "ready"
+)
+
 type Image struct {
-	ID        int    `db:"id"`
-	UserID    int    `db:"user_id"`
-	Name      string `db:"name"`
-	Extension string `db:"extension"`
+	ID           int            `db:"id"`
+	UserID       int            `db:"user_id"`
+	Name         string         `db:"name"`
+	Extension    string         `db:"extension"`
+	Status       string         `db:"status"`
+	ContentType  sql.NullString `db:"content_type"`
+	Size         sql.NullInt64  `db:"size"`
+	OriginalName sql.NullString `db:"original_name"`
+	CreatedAt    time.Time      `db:"created_at"`
+	Description  sql.NullString `db:"description"`
+	Title        sql.NullString `db:"title"`
+	Tags         pq.StringArray `db:"tags"`
+}
+
+// ImageSummary aggregates the ready images of a user.
+type ImageSummary struct {
+	Count       int          `db:"count"`
+	TotalSize   int64        `db:"total_size"`
+	LastAddedAt sql.NullTime `db:"last_added_at"`
 }
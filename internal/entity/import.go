@@ -0,0 +1,30 @@
+package entity
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	ImportStatusPending = "pending"
+	ImportStatusRunning = "running"
+	ImportStatusDone    = "done"
+	ImportStatusFailed  = "failed"
+)
+
+type ImportJob struct {
+	ID        int       `db:"id"`
+	UserID    int       `db:"user_id"`
+	Status    string    `db:"status"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+type ImportItem struct {
+	ID      int            `db:"id"`
+	JobID   int            `db:"job_id"`
+	URL     string         `db:"url"`
+	Status  string         `db:"status"`
+	ImageID sql.NullInt64  `db:"image_id"`
+	Error   sql.NullString `db:"error"`
+}
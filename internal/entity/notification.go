@@ -0,0 +1,8 @@
+package entity
+
+type NotificationSettings struct {
+	UserID         int  `db:"user_id"`
+	ImageUploaded  bool `db:"image_uploaded"`
+	ImageDeleted   bool `db:"image_deleted"`
+	ProfileUpdated bool `db:"profile_updated"`
+}
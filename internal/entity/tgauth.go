@@ -1,7 +1,48 @@
 package entity
 
+import (
+	"database/sql"
+	"time"
+)
+
+// TgAuth links a Telegram account to a user, a user may link several accounts.
 type TgAuth struct {
-	ID         int   `db:"id"`
-	UserID     int   `db:"user_id"`
-	TelegramID int64 `db:"telegram_id"`
+	ID           int          `db:"id"`
+	UserID       int          `db:"user_id"`
+	TelegramID   int64        `db:"telegram_id"`
+	LinkedAt     time.Time    `db:"linked_at"`
+	LastActiveAt sql.NullTime `db:"last_active_at"`
+}
+
+type TgLinkCode struct {
+	Code      string    `db:"code"`
+	UserID    int       `db:"user_id"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+type TgChatState struct {
+	ChatID    int64     `db:"chat_id"`
+	State     string    `db:"state"`
+	Data      string    `db:"data"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// TgLanguage is the language a Telegram user chose for the bot.
+type TgLanguage struct {
+	TelegramID int64     `db:"telegram_id"`
+	Language   string    `db:"language"`
+	UpdatedAt  time.Time `db:"updated_at"`
+}
+
+// TgFileVariantPhoto is the image sent as a compressed Telegram photo.
+const TgFileVariantPhoto = "photo"
+
+// TgFileID is the Telegram file_id of an image the bot already uploaded or received,
+// photos can be sent again by file_id without uploading their bytes. Telegram assigns
+// different file_ids to different variants of the same image.
+type TgFileID struct {
+	ImageID   int       `db:"image_id"`
+	Variant   string    `db:"variant"`
+	FileID    string    `db:"file_id"`
+	CreatedAt time.Time `db:"created_at"`
 }
@@ -0,0 +1,24 @@
+package entity
+
+import (
+	"database/sql"
+	"time"
+)
+
+type Upload struct {
+	ID          string    `db:"id"`
+	UserID      int       `db:"user_id"`
+	ObjectName  string    `db:"object_name"`
+	MultipartID string    `db:"multipart_id"`
+	Length      int64     `db:"upload_length"`
+	Offset      int64     `db:"upload_offset"`
+	PartCount   int       `db:"part_count"`
+	TailSize    int64     `db:"tail_size"`
+	FileName    string    `db:"file_name"`
+	Metadata    string    `db:"metadata"`
+	CreatedAt   time.Time `db:"created_at"`
+	// Assembled is set once the parts are joined into one object, the multipart upload is gone then.
+	Assembled bool `db:"assembled"`
+	// ImageID is the image made from the upload, the upload only waits for its objects to be removed.
+	ImageID sql.NullInt64 `db:"image_id"`
+}
@@ -9,3 +9,14 @@ type User struct {
 	Password    string         `db:"password"`
 	Description sql.NullString `db:"description"`
 }
+
+// UserQuery selects a page of users. Users are ordered by Sort, "id" or "name", and then by id,
+// AfterName and AfterID are those of the last user of the previous page and AfterID is 0 on the first one.
+type UserQuery struct {
+	Search    string
+	Sort      string
+	Desc      bool
+	AfterName string
+	AfterID   int64
+	Limit     int
+}
@@ -0,0 +1,171 @@
+// Package event is an in-process bus services publish account events to, so that other parts
+// of the application, such as the Telegram bot, can react without the services knowing about them.
+package event
+
+import (
+	"context"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// busWorkers handlers run at the same time, busQueueSize deliveries wait for them before
+// further events are dropped.
+const (
+	busWorkers   = 4
+	busQueueSize = 256
+)
+
+type Type string
+
+const (
+	ImageUploaded Type = "image_uploaded"
+	// ImagesUploaded is published once for a batch, zip or import that added several images.
+	ImagesUploaded  Type = "images_uploaded"
+	ImageDeleted    Type = "image_deleted"
+	ProfileUpdated  Type = "profile_updated"
+	PasswordChanged Type = "password_changed"
+)
+
+// Sources tell where the action behind an event came from.
+const (
+	SourceAPI      = "api"
+	SourceTelegram = "telegram"
+)
+
+type Event struct {
+	Type   Type `json:"type"`
+	UserID int  `json:"userId"`
+	// ImageID and ImageName are set for image events.
+	ImageID   int    `json:"imageId,omitempty"`
+	ImageName string `json:"imageName,omitempty"`
+	// Count is the number of images of an ImagesUploaded event.
+	Count  int       `json:"count,omitempty"`
+	Source string    `json:"source"`
+	At     time.Time `json:"at"`
+}
+
+type Handler func(ctx context.Context, e Event)
+
+type sourceKey struct{}
+
+// WithSource marks the actions done with ctx as coming from source, SourceAPI is assumed otherwise.
+func WithSource(ctx context.Context, source string) context.Context {
+	return context.WithValue(ctx, sourceKey{}, source)
+}
+
+func SourceFromContext(ctx context.Context) string {
+	source, ok := ctx.Value(sourceKey{}).(string)
+	if !ok {
+		return SourceAPI
+	}
+	return source
+}
+
+// Bus delivers published events to every subscriber. Handlers run on a few workers fed by a queue,
+// so a slow subscriber never delays the request that published the event. When the queue is full
+// the event is dropped for the subscribers that did not get it, notifications may be lost.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers []Handler
+	closed   bool
+	queue    chan delivery
+	wg       sync.WaitGroup
+	// ctx is given to the handlers, it is canceled when Close gives up waiting for them.
+	ctx    context.Context
+	cancel context.CancelFunc
+	l      *logrus.Logger
+}
+
+type delivery struct {
+	handler Handler
+	event   Event
+}
+
+func NewBus(l *logrus.Logger) *Bus {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &Bus{
+		queue:  make(chan delivery, busQueueSize),
+		ctx:    ctx,
+		cancel: cancel,
+		l:      l,
+	}
+
+	b.wg.Add(busWorkers)
+	for i := 0; i < busWorkers; i++ {
+		go b.work()
+	}
+
+	return b
+}
+
+func (b *Bus) work() {
+	defer b.wg.Done()
+
+	for d := range b.queue {
+		d.handler(b.ctx, d.event)
+	}
+}
+
+func (b *Bus) Subscribe(h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers = append(b.handlers, h)
+}
+
+// Close stops taking events and waits for the queued ones to be handled. When ctx is done first,
+// the context of the handlers is canceled, so the running and the remaining ones give up.
+func (b *Bus) Close(ctx context.Context) error {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.queue)
+	}
+	b.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	defer b.cancel()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("event handlers did not finish: %w", ctx.Err())
+	}
+}
+
+// Publish sends the event to the subscribers, its source is taken from ctx. Handlers get a context
+// that is not canceled with ctx, since the request publishing the event usually ends first.
+func (b *Bus) Publish(ctx context.Context, e Event) {
+	e.Source = SourceFromContext(ctx)
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+
+	b.Deliver(e)
+}
+
+// Deliver sends an event that was published elsewhere, such as in another process, to the subscribers as is.
+// Events delivered after Close are dropped.
+func (b *Bus) Deliver(e Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return
+	}
+
+	for _, h := range b.handlers {
+		select {
+		case b.queue <- delivery{handler: h, event: e}:
+		default:
+			b.l.Warnf("event queue is full, dropped a %s event of user %d", e.Type, e.UserID)
+		}
+	}
+}
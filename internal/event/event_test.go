@@ -0,0 +1,151 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestBus() *Bus {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return NewBus(logger)
+}
+
+func TestPublishDeliversToEverySubscriber(t *testing.T) {
+	b := newTestBus()
+
+	received := make(chan Event, 2)
+	for i := 0; i < 2; i++ {
+		b.Subscribe(func(ctx context.Context, e Event) {
+			received <- e
+		})
+	}
+
+	b.Publish(WithSource(context.Background(), SourceTelegram), Event{Type: ImageUploaded, UserID: 1})
+
+	for i := 0; i < 2; i++ {
+		select {
+		case e := <-received:
+			if e.Type != ImageUploaded || e.UserID != 1 || e.Source != SourceTelegram || e.At.IsZero() {
+				t.Errorf("got event %+v, want an image_uploaded event of user 1 from telegram", e)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("got %d events, want 2", i)
+		}
+	}
+}
+
+func TestHandlersOutliveThePublisher(t *testing.T) {
+	b := newTestBus()
+
+	handled := make(chan error, 1)
+	b.Subscribe(func(ctx context.Context, e Event) {
+		time.Sleep(10 * time.Millisecond)
+		handled <- ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b.Publish(ctx, Event{Type: ProfileUpdated, UserID: 1})
+	cancel()
+
+	select {
+	case err := <-handled:
+		if err != nil {
+			t.Errorf("got handler context error %v, want none", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the event was not handled")
+	}
+}
+
+func TestSourceFromContext(t *testing.T) {
+	if got := SourceFromContext(context.Background()); got != SourceAPI {
+		t.Errorf("got source %q, want %q", got, SourceAPI)
+	}
+	if got := SourceFromContext(WithSource(context.Background(), SourceTelegram)); got != SourceTelegram {
+		t.Errorf("got source %q, want %q", got, SourceTelegram)
+	}
+}
+
+func TestCloseHandlesQueuedEvents(t *testing.T) {
+	b := newTestBus()
+
+	var handled atomic.Int32
+	b.Subscribe(func(ctx context.Context, e Event) {
+		time.Sleep(time.Millisecond)
+		handled.Add(1)
+	})
+
+	for i := 0; i < busQueueSize/2; i++ {
+		b.Publish(context.Background(), Event{Type: ImageUploaded, UserID: i})
+	}
+
+	err := b.Close(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := handled.Load(); got != busQueueSize/2 {
+		t.Errorf("got %d events handled, want %d", got, busQueueSize/2)
+	}
+
+	b.Publish(context.Background(), Event{Type: ImageUploaded})
+	if got := handled.Load(); got != busQueueSize/2 {
+		t.Errorf("an event published after Close was handled")
+	}
+}
+
+func TestFullQueueDropsEvents(t *testing.T) {
+	b := newTestBus()
+
+	release := make(chan struct{})
+	var handled atomic.Int32
+	b.Subscribe(func(ctx context.Context, e Event) {
+		<-release
+		handled.Add(1)
+	})
+
+	published := busWorkers + busQueueSize + 10
+	for i := 0; i < published; i++ {
+		b.Publish(context.Background(), Event{Type: ImageUploaded, UserID: i})
+	}
+	close(release)
+
+	err := b.Close(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the workers may take a few events off the queue while it is being filled
+	if got := handled.Load(); got < busQueueSize || got >= int32(published) {
+		t.Errorf("got %d of %d events handled, want the full queue and no more", got, published)
+	}
+}
+
+func TestCloseCancelsSlowHandlers(t *testing.T) {
+	b := newTestBus()
+
+	canceled := make(chan struct{})
+	b.Subscribe(func(ctx context.Context, e Event) {
+		<-ctx.Done()
+		close(canceled)
+	})
+	b.Publish(context.Background(), Event{Type: ProfileUpdated})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := b.Close(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Error("the handler context was not canceled")
+	}
+}
@@ -0,0 +1,80 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// relayChannel is the Postgres channel events travel on between processes.
+const relayChannel = "image_loader_events"
+
+// Relay carries events between processes through Postgres LISTEN/NOTIFY, so a bot running
+// apart from the API still hears about what happens there. Notifications sent while no
+// listener is connected are lost, which is acceptable for notifications.
+type Relay struct {
+	db  *sqlx.DB
+	dsn string
+	l   *logrus.Logger
+}
+
+func NewRelay(db *sqlx.DB, dsn string, l *logrus.Logger) *Relay {
+	return &Relay{
+		db:  db,
+		dsn: dsn,
+		l:   l,
+	}
+}
+
+// Forward sends the event to the listening processes, it is meant to be subscribed to the local bus.
+func (r *Relay) Forward(ctx context.Context, e Event) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		r.l.Error(err)
+		return
+	}
+
+	_, err = r.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, relayChannel, string(payload))
+	if err != nil {
+		r.l.Errorf("failed to forward event: %v", err)
+	}
+}
+
+// Listen delivers the events forwarded by other processes to bus until ctx is done.
+func (r *Relay) Listen(ctx context.Context, bus *Bus) error {
+	listener := pq.NewListener(r.dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			r.l.Errorf("event listener: %v", err)
+		}
+	})
+	defer listener.Close()
+
+	err := listener.Listen(relayChannel)
+	if err != nil {
+		return fmt.Errorf("failed to listen for events: %w", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			// A nil notification means the connection was re-established, events sent meanwhile are lost.
+			if n == nil {
+				continue
+			}
+
+			var e Event
+			err := json.Unmarshal([]byte(n.Extra), &e)
+			if err != nil {
+				r.l.Errorf("failed to decode event: %v", err)
+				continue
+			}
+			bus.Deliver(e)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrBlockedAddress   = errors.New("address is not allowed")
+	ErrTooLarge         = errors.New("remote file is too large")
+	ErrTooManyRedirects = errors.New("too many redirects")
+	ErrUnsupportedURL   = errors.New("only http and https urls are supported")
+)
+
+// blockedNetworks are ranges that are not reachable from the internet, on top of what net.IP reports
+// as private, loopback, link-local, multicast or unspecified.
+var blockedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",
+	"100.64.0.0/10",
+	"192.0.0.0/24",
+	"198.18.0.0/15",
+	"240.0.0.0/4",
+	"64:ff9b::/96",
+)
+
+// Fetcher downloads remote files while refusing to connect to internal addresses.
+// The check runs on the resolved address of every connection, so DNS tricks and redirects are covered too.
+type Fetcher struct {
+	client  *http.Client
+	maxSize int64
+	allowed []*net.IPNet
+}
+
+func NewFetcher(timeout time.Duration, maxRedirects int, maxSize int64, allowedCIDRs []string) (*Fetcher, error) {
+	allowed := make([]*net.IPNet, 0, len(allowedCIDRs))
+	for _, cidr := range allowedCIDRs {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed network %q: %w", cidr, err)
+		}
+		allowed = append(allowed, network)
+	}
+
+	f := &Fetcher{
+		maxSize: maxSize,
+		allowed: allowed,
+	}
+
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: f.control,
+	}
+
+	f.client = &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return ErrTooManyRedirects
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return ErrUnsupportedURL
+			}
+			return nil
+		},
+	}
+
+	return f, nil
+}
+
+// Fetch downloads the file at url, failing when it is larger than the configured limit.
+func (f *Fetcher) Fetch(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return nil, ErrUnsupportedURL
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+	if f.maxSize > 0 && resp.ContentLength > f.maxSize {
+		return nil, ErrTooLarge
+	}
+
+	body := io.Reader(resp.Body)
+	if f.maxSize > 0 {
+		body = io.LimitReader(resp.Body, f.maxSize+1)
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if f.maxSize > 0 && int64(len(data)) > f.maxSize {
+		return nil, ErrTooLarge
+	}
+
+	return data, nil
+}
+
+func (f *Fetcher) control(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return ErrBlockedAddress
+	}
+
+	for _, network := range f.allowed {
+		if network.Contains(ip) {
+			return nil
+		}
+	}
+
+	if isInternal(ip) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, ip)
+	}
+
+	return nil
+}
+
+func isInternal(ip net.IP) bool {
+	if ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return true
+	}
+
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
@@ -0,0 +1,203 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// loopback allows the httptest servers, which listen on 127.0.0.1, and nothing else of the loopback network.
+var loopback = []string{"127.0.0.1/32"}
+
+func newTestFetcher(t *testing.T, maxRedirects int, maxSize int64, allowedCIDRs []string) *Fetcher {
+	t.Helper()
+
+	f, err := NewFetcher(time.Second, maxRedirects, maxSize, allowedCIDRs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestControl(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		allowed []string
+		wantErr error
+	}{
+		{"public IPv4", "93.184.216.34:80", nil, nil},
+		{"public IPv6", "[2606:2800:220:1:248:1893:25c8:1946]:443", nil, nil},
+		{"loopback", "127.0.0.1:80", nil, ErrBlockedAddress},
+		{"other loopback", "127.0.0.2:80", nil, ErrBlockedAddress},
+		{"IPv6 loopback", "[::1]:80", nil, ErrBlockedAddress},
+		{"RFC1918 10/8", "10.0.0.1:80", nil, ErrBlockedAddress},
+		{"RFC1918 172.16/12", "172.31.255.255:80", nil, ErrBlockedAddress},
+		{"RFC1918 192.168/16", "192.168.1.1:80", nil, ErrBlockedAddress},
+		{"link-local metadata", "169.254.169.254:80", nil, ErrBlockedAddress},
+		{"IPv6 link-local", "[fe80::1]:80", nil, ErrBlockedAddress},
+		{"IPv6 unique local", "[fd00::1]:80", nil, ErrBlockedAddress},
+		{"IPv4-mapped loopback", "[::ffff:127.0.0.1]:80", nil, ErrBlockedAddress},
+		{"carrier-grade NAT", "100.64.0.1:80", nil, ErrBlockedAddress},
+		{"unspecified", "0.0.0.0:80", nil, ErrBlockedAddress},
+		{"multicast", "224.0.0.1:80", nil, ErrBlockedAddress},
+		{"allowed network", "10.1.2.3:80", []string{"10.1.0.0/16"}, nil},
+		{"outside the allowed network", "10.2.0.1:80", []string{"10.1.0.0/16"}, ErrBlockedAddress},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newTestFetcher(t, 0, 0, tt.allowed)
+
+			err := f.control("tcp", tt.address, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewFetcherRejectsInvalidNetworks(t *testing.T) {
+	_, err := NewFetcher(time.Second, 0, 0, []string{"10.0.0.0"})
+	if err == nil {
+		t.Error("got no error for a network without a prefix length")
+	}
+}
+
+func TestFetchInternalServer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("image"))
+	}))
+	defer srv.Close()
+
+	_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		url     string
+		allowed []string
+		wantErr error
+	}{
+		{"loopback address", srv.URL, nil, ErrBlockedAddress},
+		{"name resolving to loopback", "http://localhost:" + port, nil, ErrBlockedAddress},
+		{"allowed network", srv.URL, loopback, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := newTestFetcher(t, 0, 0, tt.allowed).Fetch(context.Background(), tt.url)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && string(data) != "image" {
+				t.Errorf("got data %q, want %q", data, "image")
+			}
+		})
+	}
+}
+
+func TestFetchRedirects(t *testing.T) {
+	// /hops/n redirects n more times before answering
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hops/", func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/hops/"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if n == 0 {
+			_, _ = w.Write([]byte("image"))
+			return
+		}
+		http.Redirect(w, r, "/hops/"+strconv.Itoa(n-1), http.StatusFound)
+	})
+	mux.HandleFunc("/to", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, r.URL.Query().Get("url"), http.StatusFound)
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr error
+	}{
+		{"within the limit", "/hops/2", nil},
+		{"over the limit", "/hops/3", ErrTooManyRedirects},
+		{"to the metadata service", "/to?url=" + url.QueryEscape("http://169.254.169.254/latest/meta-data/"), ErrBlockedAddress},
+		{"to another loopback address", "/to?url=" + url.QueryEscape("http://127.0.0.2/"), ErrBlockedAddress},
+		{"to a private network", "/to?url=" + url.QueryEscape("http://10.0.0.1/"), ErrBlockedAddress},
+		{"to another scheme", "/to?url=" + url.QueryEscape("file:///etc/passwd"), ErrUnsupportedURL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newTestFetcher(t, 2, 0, loopback).Fetch(context.Background(), srv.URL+tt.path)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFetchMaxSize(t *testing.T) {
+	const maxSize = 1 << 10
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		size, err := strconv.Atoi(r.URL.Query().Get("size"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.URL.Query().Has("chunked") {
+			// flushing before the body is written leaves the length out of the response
+			w.(http.Flusher).Flush()
+		} else {
+			w.Header().Set("Content-Length", strconv.Itoa(size))
+		}
+		_, _ = w.Write(bytes.Repeat([]byte{1}, size))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		query   string
+		wantErr error
+	}{
+		{"largest file", "size=1024", nil},
+		{"declared too large", "size=1025", ErrTooLarge},
+		{"largest file without length", "size=1024&chunked", nil},
+		{"too large without length", "size=4096&chunked", ErrTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := newTestFetcher(t, 0, maxSize, loopback).Fetch(context.Background(), srv.URL+"/?"+tt.query)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && len(data) != maxSize {
+				t.Errorf("got %d bytes, want %d", len(data), maxSize)
+			}
+		})
+	}
+}
+
+func TestFetchUnsupportedURL(t *testing.T) {
+	_, err := newTestFetcher(t, 0, 0, nil).Fetch(context.Background(), "ftp://example.com/1.png")
+	if !errors.Is(err, ErrUnsupportedURL) {
+		t.Errorf("got error %v, want %v", err, ErrUnsupportedURL)
+	}
+}
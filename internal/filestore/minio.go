@@ -26,7 +26,7 @@ func (m *Minio) PutObject(ctx context.Context, image string, data io.Reader) err
 }
 
 func (m *Minio) GetImageUrls(ctx context.Context, imageNames []string) ([]string, error) {
-	var urls []string
+	urls := make([]string, 0, len(imageNames))
 
 	for i := range imageNames {
 		url, err := m.minio.PresignedGetObject(ctx, m.bucket, imageNames[i], time.Hour*24, nil)
@@ -54,3 +54,118 @@ func (m *Minio) GetObjects(ctx context.Context, imageNames []string) ([]io.Reade
 
 	return objects, nil
 }
+
+func (m *Minio) GetObject(ctx context.Context, name string) (io.ReadCloser, error) {
+	return m.minio.GetObject(ctx, m.bucket, name, minio.GetObjectOptions{})
+}
+
+func (m *Minio) RemoveObject(ctx context.Context, name string) error {
+	return m.minio.RemoveObject(ctx, m.bucket, name, minio.RemoveObjectOptions{})
+}
+
+func (m *Minio) NewMultipartUpload(ctx context.Context, name string) (string, error) {
+	return m.core().NewMultipartUpload(ctx, m.bucket, name, minio.PutObjectOptions{})
+}
+
+func (m *Minio) PutObjectPart(ctx context.Context, name, uploadID string, partNumber int, data io.Reader, size int64) error {
+	_, err := m.core().PutObjectPart(ctx, m.bucket, name, uploadID, partNumber, data, size, "", "", nil)
+
+	return err
+}
+
+func (m *Minio) CompleteMultipartUpload(ctx context.Context, name, uploadID string) error {
+	var parts []minio.CompletePart
+
+	marker := 0
+	for {
+		result, err := m.core().ListObjectParts(ctx, m.bucket, name, uploadID, marker, 1000)
+		if err != nil {
+			return err
+		}
+
+		for _, part := range result.ObjectParts {
+			parts = append(parts, minio.CompletePart{PartNumber: part.PartNumber, ETag: part.ETag})
+		}
+
+		if !result.IsTruncated {
+			break
+		}
+		marker = result.NextPartNumberMarker
+	}
+
+	_, err := m.core().CompleteMultipartUpload(ctx, m.bucket, name, uploadID, parts, minio.PutObjectOptions{})
+
+	return err
+}
+
+func (m *Minio) AbortMultipartUpload(ctx context.Context, name, uploadID string) error {
+	return m.core().AbortMultipartUpload(ctx, m.bucket, name, uploadID)
+}
+
+func (m *Minio) core() minio.Core {
+	return minio.Core{Client: m.minio}
+}
+
+// PresignedPostPolicy returns the URL and form fields that let a client POST exactly size bytes
+// of contentType as the object name.
+func (m *Minio) PresignedPostPolicy(ctx context.Context, name, contentType string, size int64, expires time.Duration) (string, map[string]string, error) {
+	policy := minio.NewPostPolicy()
+
+	err := policy.SetBucket(m.bucket)
+	if err != nil {
+		return "", nil, err
+	}
+	err = policy.SetKey(name)
+	if err != nil {
+		return "", nil, err
+	}
+	err = policy.SetExpires(time.Now().UTC().Add(expires))
+	if err != nil {
+		return "", nil, err
+	}
+	err = policy.SetContentType(contentType)
+	if err != nil {
+		return "", nil, err
+	}
+	err = policy.SetContentLengthRange(size, size)
+	if err != nil {
+		return "", nil, err
+	}
+
+	url, fields, err := m.minio.PresignedPostPolicy(ctx, policy)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return url.String(), fields, nil
+}
+
+// StatObject returns the object size, exists is false when there is no such object.
+func (m *Minio) StatObject(ctx context.Context, name string) (size int64, exists bool, err error) {
+	info, err := m.minio.StatObject(ctx, m.bucket, name, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+
+	return info.Size, true, nil
+}
+
+// ReadObjectHead returns up to n first bytes of the object.
+func (m *Minio) ReadObjectHead(ctx context.Context, name string, n int64) ([]byte, error) {
+	opts := minio.GetObjectOptions{}
+	err := opts.SetRange(0, n-1)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := m.minio.GetObject(ctx, m.bucket, name, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	return io.ReadAll(io.LimitReader(object, n))
+}
@@ -0,0 +1,110 @@
+// Package i18n holds the messages shown to users of the API and the bot in every supported language.
+package i18n
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Lang string
+
+const (
+	English Lang = "en"
+	Russian Lang = "ru"
+
+	Default = English
+)
+
+// Supported lists the languages with a full catalog.
+var Supported = []Lang{English, Russian}
+
+// Key identifies a message, messages taking arguments are fmt formats.
+type Key string
+
+// T returns the message in lang, falling back to the default language and then to the key itself.
+func T(lang Lang, key Key, args ...any) string {
+	msg, ok := Lookup(lang, key)
+	if !ok {
+		msg = string(key)
+	}
+
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// Lookup returns the message in lang or in the default language, ok is false when the catalog has no such message.
+func Lookup(lang Lang, key Key) (msg string, ok bool) {
+	msg, ok = catalog[lang][key]
+	if !ok {
+		msg, ok = catalog[Default][key]
+	}
+	return msg, ok
+}
+
+// Parse returns the supported language of a language tag such as "ru" or "ru-RU".
+func Parse(tag string) (Lang, bool) {
+	primary, _, _ := strings.Cut(strings.TrimSpace(tag), "-")
+	lang := Lang(strings.ToLower(primary))
+
+	for _, supported := range Supported {
+		if lang == supported {
+			return lang, true
+		}
+	}
+	return "", false
+}
+
+// FromAcceptLanguage picks the supported language the client prefers most, the default when there is none.
+func FromAcceptLanguage(header string) Lang {
+	type candidate struct {
+		lang Lang
+		q    float64
+	}
+
+	candidates := make([]candidate, 0)
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+
+		q := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			parsed, err := strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		if lang, ok := Parse(tag); ok && q > 0 {
+			candidates = append(candidates, candidate{lang: lang, q: q})
+		}
+	}
+
+	if len(candidates) == 0 {
+		return Default
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+	return candidates[0].lang
+}
+
+type langKey struct{}
+
+func WithLang(ctx context.Context, lang Lang) context.Context {
+	return context.WithValue(ctx, langKey{}, lang)
+}
+
+// FromContext returns the language chosen for the request, the default when none was.
+func FromContext(ctx context.Context) Lang {
+	lang, ok := ctx.Value(langKey{}).(Lang)
+	if !ok {
+		return Default
+	}
+	return lang
+}
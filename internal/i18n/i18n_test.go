@@ -0,0 +1,79 @@
+package i18n
+
+import (
+	"regexp"
+	"testing"
+)
+
+// verbs matches the fmt verbs of a message, %% is not one.
+var verbs = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z]`)
+
+func TestCatalogComplete(t *testing.T) {
+	for _, lang := range Supported {
+		if Name(lang) == "" {
+			t.Errorf("language %s has no name", lang)
+		}
+
+		for key, msg := range catalog[Default] {
+			translated, ok := catalog[lang][key]
+			if !ok {
+				t.Errorf("%s has no message %s", lang, key)
+				continue
+			}
+
+			want, got := verbs.FindAllString(msg, -1), verbs.FindAllString(translated, -1)
+			if len(got) != len(want) {
+				t.Errorf("%s message %s takes %v, want %v", lang, key, got, want)
+				continue
+			}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Errorf("%s message %s takes %v, want %v", lang, key, got, want)
+					break
+				}
+			}
+		}
+
+		for key := range catalog[lang] {
+			if _, ok := catalog[Default][key]; !ok {
+				t.Errorf("%s message %s is missing from the default language", lang, key)
+			}
+		}
+	}
+}
+
+func TestFromAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   Lang
+	}{
+		{"", Default},
+		{"ru", Russian},
+		{"ru-RU,ru;q=0.9,en-US;q=0.8", Russian},
+		{"de-DE, en;q=0.5, ru;q=0.7", Russian},
+		{"en;q=0.2, RU;q=0.4", Russian},
+		{"de, fr", Default},
+		{"ru;q=0, en", English},
+		{"ru;q=abc, en;q=0.1", English},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if got := FromAcceptLanguage(tt.header); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTFallback(t *testing.T) {
+	if got, want := T("de", Cancelled), catalog[Default][Cancelled]; got != want {
+		t.Errorf("got %q for an unsupported language, want the default %q", got, want)
+	}
+	if got := T(Russian, "no_such_message"); got != "no_such_message" {
+		t.Errorf("got %q for an unknown key, want the key", got)
+	}
+	if got, want := T(English, NotifyImagesUploaded, 3), "3 new images uploaded"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,409 @@
+package i18n
+
+// Bot messages.
+const (
+	CommandHelp          Key = "command_help"
+	CommandLink          Key = "command_link"
+	CommandUnlink        Key = "command_unlink"
+	CommandLatest        Key = "command_latest"
+	CommandAlbums        Key = "command_albums"
+	CommandDelete        Key = "command_delete"
+	CommandWhoAmI        Key = "command_whoami"
+	CommandNotifications Key = "command_notifications"
+	CommandLanguage      Key = "command_language"
+	CommandCancel        Key = "command_cancel"
+
+	HelpIntro          Key = "help_intro"
+	SelectAction       Key = "select_action"
+	ButtonShowImages   Key = "button_show_images"
+	ButtonRegistration Key = "button_registration"
+	UnknownCommand     Key = "unknown_command"
+	ActionTimedOut     Key = "action_timed_out"
+	NothingToCancel    Key = "nothing_to_cancel"
+	Cancelled          Key = "cancelled"
+	AlbumsNotSupported Key = "albums_not_supported"
+	SignUp             Key = "sign_up"
+
+	LinkHelp            Key = "link_help"
+	NotLinked           Key = "not_linked"
+	AccountNotLinked    Key = "account_not_linked"
+	AlreadyLinked       Key = "already_linked"
+	SendLinkCode        Key = "send_link_code"
+	LinkCodeInvalid     Key = "link_code_invalid"
+	LinkFailed          Key = "link_failed"
+	Linked              Key = "linked"
+	UnlinkFailed        Key = "unlink_failed"
+	Unlinked            Key = "unlinked"
+	PasswordDeleted     Key = "password_deleted"
+	AccountLoadFailed   Key = "account_load_failed"
+	LinkedTo            Key = "linked_to"
+	InlineLinkAccount   Key = "inline_link_account"
+	SaveImageFailed     Key = "save_image_failed"
+	NotAnImage          Key = "not_an_image"
+	ImageSaved          Key = "image_saved"
+	ImagesLoadFailed    Key = "images_load_failed"
+	NoImages            Key = "no_images"
+	ImagesRange         Key = "images_range"
+	ButtonPrev          Key = "button_prev"
+	ButtonNext          Key = "button_next"
+	SendImageID         Key = "send_image_id"
+	ImageIDNotNumber    Key = "image_id_not_number"
+	DeleteImagePrompt   Key = "delete_image_prompt"
+	ButtonDelete        Key = "button_delete"
+	ButtonKeep          Key = "button_keep"
+	ConfirmDeletion     Key = "confirm_deletion"
+	ConfirmationExpired Key = "confirmation_expired"
+	ImageKept           Key = "image_kept"
+	ImageNotFoundID     Key = "image_not_found_id"
+	DeleteImageFailed   Key = "delete_image_failed"
+	ImageDeletedID      Key = "image_deleted_id"
+
+	NotificationsPrompt       Key = "notifications_prompt"
+	NotificationsLoadFailed   Key = "notifications_load_failed"
+	NotificationsUpdateFailed Key = "notifications_update_failed"
+	NotifyUploadedImages      Key = "notify_uploaded_images"
+	NotifyDeletedImages       Key = "notify_deleted_images"
+	NotifyProfileChanges      Key = "notify_profile_changes"
+	NotificationOn            Key = "notification_on"
+	NotificationOff           Key = "notification_off"
+	NotifyImageUploaded       Key = "notify_image_uploaded"
+	NotifyImagesUploaded      Key = "notify_images_uploaded"
+	NotifyImageDeleted        Key = "notify_image_deleted"
+	NotifyProfileUpdated      Key = "notify_profile_updated"
+	NotifyPasswordChanged     Key = "notify_password_changed"
+
+	LanguagePrompt     Key = "language_prompt"
+	LanguageChanged    Key = "language_changed"
+	LanguageSaveFailed Key = "language_save_failed"
+)
+
+// API problem titles.
+const (
+	StatusBadRequest           Key = "status_bad_request"
+	StatusUnauthorized         Key = "status_unauthorized"
+	StatusForbidden            Key = "status_forbidden"
+	StatusNotFound             Key = "status_not_found"
+	StatusConflict             Key = "status_conflict"
+	StatusPreconditionFailed   Key = "status_precondition_failed"
+	StatusTooLarge             Key = "status_too_large"
+	StatusUnsupportedMediaType Key = "status_unsupported_media_type"
+	StatusInternal             Key = "status_internal"
+)
+
+// API error details, keyed by the error codes.
+const (
+	ErrInternal               Key = "internal"
+	ErrUnauthorized           Key = "unauthorized"
+	ErrForbidden              Key = "forbidden"
+	ErrInvalidCredentials     Key = "invalid_credentials"
+	ErrInvalidBody            Key = "invalid_body"
+	ErrInvalidParameter       Key = "invalid_parameter"
+	ErrInvalidHeader          Key = "invalid_header"
+	ErrNoFiles                Key = "no_files"
+	ErrUnsupportedContentType Key = "unsupported_content_type"
+	ErrUnsupportedTusVersion  Key = "unsupported_tus_version"
+	ErrAlreadyExists          Key = "already_exists"
+	ErrUserNotFound           Key = "user_not_found"
+	ErrImageNotFound          Key = "image_not_found"
+	ErrImageNotUploaded       Key = "image_not_uploaded"
+	ErrUnsupportedImageType   Key = "unsupported_image_type"
+	ErrImageAlreadyCompleted  Key = "image_already_completed"
+	ErrImportJobNotFound      Key = "import_job_not_found"
+	ErrInvalidImportURL       Key = "invalid_import_url"
+	ErrTooManyImportURLs      Key = "too_many_import_urls"
+	ErrUploadNotFound         Key = "upload_not_found"
+	ErrUploadOffsetMismatch   Key = "upload_offset_mismatch"
+	ErrUploadTooLarge         Key = "upload_too_large"
+	ErrUploadEmpty            Key = "upload_empty"
+	ErrInvalidLinkCode        Key = "invalid_link_code"
+	ErrTelegramAlreadyLinked  Key = "telegram_already_linked"
+	ErrTelegramNotLinked      Key = "telegram_not_linked"
+	ErrTelegramLinkNotFound   Key = "telegram_link_not_found"
+	ErrValidationFailed       Key = "validation_failed"
+	ErrLoginTaken             Key = "login_taken"
+	ErrInvalidPatch           Key = "invalid_patch"
+	ErrWrongPassword          Key = "wrong_password"
+	ErrInvalidCursor          Key = "invalid_cursor"
+)
+
+// API field error messages, keyed by "field_" and the field error codes.
+const (
+	FieldRequired  Key = "field_required"
+	FieldMinLength Key = "field_min_length"
+	FieldMaxLength Key = "field_max_length"
+	FieldMin       Key = "field_min"
+	FieldMax       Key = "field_max"
+	FieldMinItems  Key = "field_min_items"
+	FieldMaxItems  Key = "field_max_items"
+)
+
+// FieldKey returns the key of the message describing a field error, by the error code.
+func FieldKey(code string) Key {
+	return Key("field_" + code)
+}
+
+// names are shown in the language picker, each in its own language.
+var names = map[Lang]string{
+	English: "English",
+	Russian: "Русский",
+}
+
+// Name returns the name of the language in that language.
+func Name(lang Lang) string {
+	return names[lang]
+}
+
+var catalog = map[Lang]map[Key]string{
+	English: {
+		CommandHelp:          "Show what the bot can do",
+		CommandLink:          "Link this Telegram account with a code from the app",
+		CommandUnlink:        "Unlink this Telegram account",
+		CommandLatest:        "Show your latest images",
+		CommandAlbums:        "Show your albums",
+		CommandDelete:        "Delete an image by its ID",
+		CommandWhoAmI:        "Show the linked account",
+		CommandNotifications: "Choose what the bot notifies you about",
+		CommandLanguage:      "Change the bot language",
+		CommandCancel:        "Cancel the current action",
+
+		HelpIntro:          "Send me a photo or an image file to save it.",
+		SelectAction:       "Select the action",
+		ButtonShowImages:   "Show images",
+		ButtonRegistration: "Registration",
+		UnknownCommand:     "Unknown command, see /help",
+		ActionTimedOut:     "The previous action timed out, start it again",
+		NothingToCancel:    "Nothing to cancel",
+		Cancelled:          "Cancelled",
+		AlbumsNotSupported: "Albums are not supported yet, use /latest to browse your images",
+		SignUp:             "Sign up!",
+
+		LinkHelp:            "To link your account request a link code in the app and open the link, or send /start <code>",
+		NotLinked:           "This Telegram account is not linked.\nTo link your account request a link code in the app and open the link, or send /start <code>",
+		AccountNotLinked:    "This Telegram account is not linked",
+		AlreadyLinked:       "This Telegram account is already linked",
+		SendLinkCode:        "Send the link code from the app",
+		LinkCodeInvalid:     "The link code is invalid or expired, request a new one",
+		LinkFailed:          "Failed to link the account",
+		Linked:              "Your account is linked!",
+		UnlinkFailed:        "Failed to unlink the account",
+		Unlinked:            "Your account is unlinked",
+		PasswordDeleted:     "Never send your password here, the message was deleted.\nTo link your account request a link code in the app and open the link, or send /start <code>",
+		AccountLoadFailed:   "Failed to load the account",
+		LinkedTo:            "Linked to %s (user #%d)",
+		InlineLinkAccount:   "Link your account to share images",
+		SaveImageFailed:     "Failed to save the image",
+		NotAnImage:          "This file is not a JPEG, PNG, GIF or WebP image",
+		ImageSaved:          "Image saved! ID: %d",
+		ImagesLoadFailed:    "Failed to load images",
+		NoImages:            "You have no images yet",
+		ImagesRange:         "Images %d-%d",
+		ButtonPrev:          "« Prev",
+		ButtonNext:          "Next »",
+		SendImageID:         "Send the ID of the image to delete",
+		ImageIDNotNumber:    "The image ID must be a number, send it again or /cancel",
+		DeleteImagePrompt:   "Delete image %d?",
+		ButtonDelete:        "Delete",
+		ButtonKeep:          "Keep",
+		ConfirmDeletion:     "Confirm the deletion with the buttons above or send /cancel",
+		ConfirmationExpired: "This confirmation has expired, send /delete again",
+		ImageKept:           "The image is kept",
+		ImageNotFoundID:     "Image %d not found",
+		DeleteImageFailed:   "Failed to delete the image",
+		ImageDeletedID:      "Image %d deleted",
+
+		NotificationsPrompt:       "Notifications sent to this chat, tap to switch",
+		NotificationsLoadFailed:   "Failed to load the notification settings",
+		NotificationsUpdateFailed: "Failed to update the notification settings",
+		NotifyUploadedImages:      "Uploaded images",
+		NotifyDeletedImages:       "Deleted images",
+		NotifyProfileChanges:      "Profile changes",
+		NotificationOn:            "on",
+		NotificationOff:           "off",
+		NotifyImageUploaded:       "New image %d %s uploaded",
+		NotifyImagesUploaded:      "%d new images uploaded",
+		NotifyImageDeleted:        "Image %d %s was deleted",
+		NotifyProfileUpdated:      "Your profile was updated",
+		NotifyPasswordChanged:     "Your password was changed. If it was not you, sign in and change it right away",
+
+		LanguagePrompt:     "Choose the bot language",
+		LanguageChanged:    "The bot will talk to you in English",
+		LanguageSaveFailed: "Failed to change the language",
+
+		StatusBadRequest:           "Bad request",
+		StatusUnauthorized:         "Unauthorized",
+		StatusForbidden:            "Forbidden",
+		StatusNotFound:             "Not found",
+		StatusConflict:             "Conflict",
+		StatusPreconditionFailed:   "Precondition failed",
+		StatusTooLarge:             "Request too large",
+		StatusUnsupportedMediaType: "Unsupported media type",
+		StatusInternal:             "Internal server error",
+
+		ErrInternal:               "Something went wrong on our side, try again later",
+		ErrUnauthorized:           "Authorization required",
+		ErrForbidden:              "You cannot change another user's account",
+		ErrInvalidCredentials:     "Incorrect login or password",
+		ErrInvalidBody:            "The request body is invalid",
+		ErrInvalidParameter:       "A request parameter is invalid",
+		ErrInvalidHeader:          "A request header is invalid",
+		ErrNoFiles:                "The request has no files",
+		ErrUnsupportedContentType: "Unsupported content type",
+		ErrUnsupportedTusVersion:  "Unsupported tus version",
+		ErrAlreadyExists:          "It already exists",
+		ErrUserNotFound:           "User not found",
+		ErrImageNotFound:          "Image not found",
+		ErrImageNotUploaded:       "The image was not uploaded",
+		ErrUnsupportedImageType:   "Unsupported image type",
+		ErrImageAlreadyCompleted:  "The image upload is already completed",
+		ErrImportJobNotFound:      "Import job not found",
+		ErrInvalidImportURL:       "Invalid import URL",
+		ErrTooManyImportURLs:      "Too many import URLs",
+		ErrUploadNotFound:         "Upload not found",
+		ErrUploadOffsetMismatch:   "The upload offset does not match",
+		ErrUploadTooLarge:         "The upload exceeds the maximum size",
+		ErrUploadEmpty:            "The upload length must be positive",
+		ErrInvalidLinkCode:        "The link code is invalid or expired",
+		ErrTelegramAlreadyLinked:  "The Telegram account is already linked",
+		ErrTelegramNotLinked:      "The Telegram account is not linked",
+		ErrTelegramLinkNotFound:   "Telegram link not found",
+		ErrValidationFailed:       "Some fields are invalid",
+		ErrLoginTaken:             "This login is already taken",
+		ErrInvalidPatch:           "The patch cannot be applied to the user",
+		ErrWrongPassword:          "The current password is wrong",
+		ErrInvalidCursor:          "The page cursor is invalid or belongs to another sort order",
+
+		FieldRequired:  "This field is required",
+		FieldMinLength: "Must be at least %s characters long",
+		FieldMaxLength: "Must be at most %s characters long",
+		FieldMin:       "Must be at least %s",
+		FieldMax:       "Must be at most %s",
+		FieldMinItems:  "Must have at least %s items",
+		FieldMaxItems:  "Must have at most %s items",
+	},
+	Russian: {
+		CommandHelp:          "Что умеет бот",
+		CommandLink:          "Привязать этот аккаунт Telegram кодом из приложения",
+		CommandUnlink:        "Отвязать этот аккаунт Telegram",
+		CommandLatest:        "Показать последние изображения",
+		CommandAlbums:        "Показать альбомы",
+		CommandDelete:        "Удалить изображение по ID",
+		CommandWhoAmI:        "Показать привязанный аккаунт",
+		CommandNotifications: "Выбрать, о чём присылать уведомления",
+		CommandLanguage:      "Сменить язык бота",
+		CommandCancel:        "Отменить текущее действие",
+
+		HelpIntro:          "Пришлите фото или файл с изображением, чтобы сохранить его.",
+		SelectAction:       "Выберите действие",
+		ButtonShowImages:   "Показать изображения",
+		ButtonRegistration: "Регистрация",
+		UnknownCommand:     "Неизвестная команда, см. /help",
+		ActionTimedOut:     "Время на предыдущее действие истекло, начните заново",
+		NothingToCancel:    "Нечего отменять",
+		Cancelled:          "Отменено",
+		AlbumsNotSupported: "Альбомы пока не поддерживаются, используйте /latest, чтобы посмотреть изображения",
+		SignUp:             "Зарегистрируйтесь!",
+
+		LinkHelp:            "Чтобы привязать аккаунт, получите код привязки в приложении и откройте ссылку или отправьте /start <код>",
+		NotLinked:           "Этот аккаунт Telegram не привязан.\nЧтобы привязать аккаунт, получите код привязки в приложении и откройте ссылку или отправьте /start <код>",
+		AccountNotLinked:    "Этот аккаунт Telegram не привязан",
+		AlreadyLinked:       "Этот аккаунт Telegram уже привязан",
+		SendLinkCode:        "Отправьте код привязки из приложения",
+		LinkCodeInvalid:     "Код привязки неверный или устарел, запросите новый",
+		LinkFailed:          "Не удалось привязать аккаунт",
+		Linked:              "Аккаунт привязан!",
+		UnlinkFailed:        "Не удалось отвязать аккаунт",
+		Unlinked:            "Аккаунт отвязан",
+		PasswordDeleted:     "Никогда не отправляйте сюда пароль, сообщение удалено.\nЧтобы привязать аккаунт, получите код привязки в приложении и откройте ссылку или отправьте /start <код>",
+		AccountLoadFailed:   "Не удалось загрузить аккаунт",
+		LinkedTo:            "Привязан к %s (пользователь #%d)",
+		InlineLinkAccount:   "Привяжите аккаунт, чтобы делиться изображениями",
+		SaveImageFailed:     "Не удалось сохранить изображение",
+		NotAnImage:          "Этот файл не является изображением JPEG, PNG, GIF или WebP",
+		ImageSaved:          "Изображение сохранено! ID: %d",
+		ImagesLoadFailed:    "Не удалось загрузить изображения",
+		NoImages:            "У вас пока нет изображений",
+		ImagesRange:         "Изображения %d-%d",
+		ButtonPrev:          "« Назад",
+		ButtonNext:          "Вперёд »",
+		SendImageID:         "Отправьте ID изображения, которое нужно удалить",
+		ImageIDNotNumber:    "ID изображения должен быть числом, отправьте его ещё раз или /cancel",
+		DeleteImagePrompt:   "Удалить изображение %d?",
+		ButtonDelete:        "Удалить",
+		ButtonKeep:          "Оставить",
+		ConfirmDeletion:     "Подтвердите удаление кнопками выше или отправьте /cancel",
+		ConfirmationExpired: "Подтверждение устарело, отправьте /delete ещё раз",
+		ImageKept:           "Изображение оставлено",
+		ImageNotFoundID:     "Изображение %d не найдено",
+		DeleteImageFailed:   "Не удалось удалить изображение",
+		ImageDeletedID:      "Изображение %d удалено",
+
+		NotificationsPrompt:       "Уведомления в этом чате, нажмите, чтобы переключить",
+		NotificationsLoadFailed:   "Не удалось загрузить настройки уведомлений",
+		NotificationsUpdateFailed: "Не удалось изменить настройки уведомлений",
+		NotifyUploadedImages:      "Загруженные изображения",
+		NotifyDeletedImages:       "Удалённые изображения",
+		NotifyProfileChanges:      "Изменения профиля",
+		NotificationOn:            "вкл",
+		NotificationOff:           "выкл",
+		NotifyImageUploaded:       "Загружено новое изображение %d %s",
+		NotifyImagesUploaded:      "Загружено новых изображений: %d",
+		NotifyImageDeleted:        "Изображение %d %s удалено",
+		NotifyProfileUpdated:      "Ваш профиль обновлён",
+		NotifyPasswordChanged:     "Ваш пароль изменён. Если это были не вы, войдите и срочно смените его",
+
+		LanguagePrompt:     "Выберите язык бота",
+		LanguageChanged:    "Бот будет общаться с вами на русском",
+		LanguageSaveFailed: "Не удалось сменить язык",
+
+		StatusBadRequest:           "Некорректный запрос",
+		StatusUnauthorized:         "Не авторизован",
+		StatusForbidden:            "Доступ запрещён",
+		StatusNotFound:             "Не найдено",
+		StatusConflict:             "Конфликт",
+		StatusPreconditionFailed:   "Не выполнено предварительное условие",
+		StatusTooLarge:             "Слишком большой запрос",
+		StatusUnsupportedMediaType: "Неподдерживаемый тип содержимого",
+		StatusInternal:             "Внутренняя ошибка сервера",
+
+		ErrInternal:               "Что-то пошло не так на нашей стороне, попробуйте позже",
+		ErrUnauthorized:           "Требуется авторизация",
+		ErrForbidden:              "Нельзя изменять чужой аккаунт",
+		ErrInvalidCredentials:     "Неверный логин или пароль",
+		ErrInvalidBody:            "Некорректное тело запроса",
+		ErrInvalidParameter:       "Некорректный параметр запроса",
+		ErrInvalidHeader:          "Некорректный заголовок запроса",
+		ErrNoFiles:                "В запросе нет файлов",
+		ErrUnsupportedContentType: "Неподдерживаемый тип содержимого",
+		ErrUnsupportedTusVersion:  "Неподдерживаемая версия tus",
+		ErrAlreadyExists:          "Такая запись уже существует",
+		ErrUserNotFound:           "Пользователь не найден",
+		ErrImageNotFound:          "Изображение не найдено",
+		ErrImageNotUploaded:       "Изображение не было загружено",
+		ErrUnsupportedImageType:   "Неподдерживаемый тип изображения",
+		ErrImageAlreadyCompleted:  "Загрузка изображения уже завершена",
+		ErrImportJobNotFound:      "Задача импорта не найдена",
+		ErrInvalidImportURL:       "Некорректный URL для импорта",
+		ErrTooManyImportURLs:      "Слишком много URL для импорта",
+		ErrUploadNotFound:         "Загрузка не найдена",
+		ErrUploadOffsetMismatch:   "Смещение загрузки не совпадает",
+		ErrUploadTooLarge:         "Загрузка превышает максимальный размер",
+		ErrUploadEmpty:            "Длина загрузки должна быть положительной",
+		ErrInvalidLinkCode:        "Код привязки неверный или устарел",
+		ErrTelegramAlreadyLinked:  "Аккаунт Telegram уже привязан",
+		ErrTelegramNotLinked:      "Аккаунт Telegram не привязан",
+		ErrTelegramLinkNotFound:   "Привязка Telegram не найдена",
+		ErrValidationFailed:       "Некоторые поля заполнены неверно",
+		ErrLoginTaken:             "Этот логин уже занят",
+		ErrInvalidPatch:           "Изменения нельзя применить к пользователю",
+		ErrWrongPassword:          "Текущий пароль указан неверно",
+		ErrInvalidCursor:          "Курсор страницы неверный или относится к другой сортировке",
+
+		FieldRequired:  "Обязательное поле",
+		FieldMinLength: "Должно быть не короче %s символов",
+		FieldMaxLength: "Должно быть не длиннее %s символов",
+		FieldMin:       "Должно быть не меньше %s",
+		FieldMax:       "Должно быть не больше %s",
+		FieldMinItems:  "Должно содержать не меньше %s элементов",
+		FieldMaxItems:  "Должно содержать не больше %s элементов",
+	},
+}
@@ -0,0 +1,52 @@
+// Package mergepatch applies JSON Merge Patches as defined by RFC 7396.
+package mergepatch
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ContentType is the media type of merge patch documents.
+const ContentType = "application/merge-patch+json"
+
+// Apply returns doc with patch merged into it. Members of a patch object replace the members of
+// the same name, null members remove them and a patch that is not an object replaces the document.
+func Apply(doc, patch []byte) ([]byte, error) {
+	var target, p any
+
+	err := json.Unmarshal(patch, &p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse merge patch: %w", err)
+	}
+
+	if len(doc) > 0 {
+		err = json.Unmarshal(doc, &target)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse document: %w", err)
+		}
+	}
+
+	return json.Marshal(merge(target, p))
+}
+
+func merge(target, patch any) any {
+	members, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	object, ok := target.(map[string]any)
+	if !ok {
+		object = make(map[string]any)
+	}
+
+	for name, value := range members {
+		if value == nil {
+			delete(object, name)
+			continue
+		}
+		object[name] = merge(object[name], value)
+	}
+
+	return object
+}
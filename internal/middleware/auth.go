@@ -2,74 +2,69 @@ package middleware
 
 import (
 	"context"
-	"errors"
+	"fmt"
+	"github.com/fichca/image-loader/internal/apperr"
 	"github.com/fichca/image-loader/internal/constants"
-	"github.com/fichca/image-loader/internal/dto"
 	"github.com/fichca/image-loader/internal/response"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/sirupsen/logrus"
 	"net/http"
-	"strings"
+	"strconv"
 )
 
 type authService interface {
-	ValidateUser(ctx context.Context, user dto.AuthUserDto) (int64, error)
+	ValidateUser(ctx context.Context, userID int) error
 }
 
 func Auth(us authService, keyword string, logger *logrus.Logger) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
-			user, err := initCredentials(r.Header, keyword)
+			userId, err := tokenUserID(r.Header, keyword)
 			if err != nil {
-				writeErr(err, logger, w)
+				writeErr(err, logger, w, r)
 				return
 			}
-			userId, err := us.ValidateUser(context.Background(), user)
 
-			ctx := r.Context()
-			ctx = context.WithValue(ctx, constants.IdCtxKey, int(userId))
+			err = us.ValidateUser(r.Context(), userId)
 			if err != nil {
-				writeErr(err, logger, w)
+				writeErr(err, logger, w, r)
 				return
 			}
+
+			ctx := context.WithValue(r.Context(), constants.IdCtxKey, userId)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		}
 		return http.HandlerFunc(fn)
 	}
 }
 
-func initCredentials(header http.Header, keyword string) (dto.AuthUserDto, error) {
+// tokenUserID verifies the token of the Authorization header and returns the user ID of its subject.
+func tokenUserID(header http.Header, keyword string) (int, error) {
 	tokenStr := header.Get("Authorization")
 	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
 		return []byte(keyword), nil
-	})
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 
 	if err != nil {
-		return dto.AuthUserDto{}, err
+		return 0, err
 	}
 
-	issuer, err := token.Claims.GetIssuer()
-
+	subject, err := token.Claims.GetSubject()
 	if err != nil {
-		return dto.AuthUserDto{}, err
+		return 0, err
 	}
-	credentials := strings.Split(issuer, " ")
-	if len(credentials) != 2 {
-		return dto.AuthUserDto{}, errors.New("math: square root of negative number")
+
+	userId, err := strconv.Atoi(subject)
+	if err != nil {
+		return 0, fmt.Errorf("invalid token subject %q", subject)
 	}
-	return dto.NewAuthUserDto(credentials[0], credentials[1]), nil
+	return userId, nil
 }
 
-func writeErr(err error, l *logrus.Logger, w http.ResponseWriter) {
-	w.WriteHeader(http.StatusUnauthorized)
+func writeErr(err error, l *logrus.Logger, w http.ResponseWriter, r *http.Request) {
 	l.Error(err)
 
-	b, err := response.ParseResponse(err.Error(), true)
-	if err != nil {
-		l.Error(err)
-	}
-
-	_, err = w.Write(b)
+	err = response.WriteProblem(w, response.NewProblem(r, apperr.Wrap(apperr.KindUnauthorized, "unauthorized", err)))
 	if err != nil {
 		l.Error(err)
 	}
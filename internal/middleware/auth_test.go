@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"github.com/fichca/image-loader/internal/constants"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testKeyword = "secret"
+
+type fakeAuthService struct{}
+
+func (fakeAuthService) ValidateUser(ctx context.Context, userID int) error {
+	if userID != 5 {
+		return errors.New("user not found")
+	}
+	return nil
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, key any, claims jwt.RegisteredClaims) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestAuth(t *testing.T) {
+	now := time.Now()
+	valid := jwt.RegisteredClaims{
+		Subject:   "5",
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		IssuedAt:  jwt.NewNumericDate(now),
+	}
+	expired := valid
+	expired.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute))
+	deleted := valid
+	deleted.Subject = "6"
+	login := valid
+	login.Subject = "john"
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"valid", signToken(t, jwt.SigningMethodHS256, []byte(testKeyword), valid), http.StatusOK},
+		{"no token", "", http.StatusUnauthorized},
+		{"wrong key", signToken(t, jwt.SigningMethodHS256, []byte("other"), valid), http.StatusUnauthorized},
+		{"other algorithm", signToken(t, jwt.SigningMethodHS512, []byte(testKeyword), valid), http.StatusUnauthorized},
+		{"unsigned", signToken(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, valid), http.StatusUnauthorized},
+		{"expired", signToken(t, jwt.SigningMethodHS256, []byte(testKeyword), expired), http.StatusUnauthorized},
+		{"unknown user", signToken(t, jwt.SigningMethodHS256, []byte(testKeyword), deleted), http.StatusUnauthorized},
+		{"subject not an ID", signToken(t, jwt.SigningMethodHS256, []byte(testKeyword), login), http.StatusUnauthorized},
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var userID any
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				userID = r.Context().Value(constants.IdCtxKey)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", tt.token)
+			w := httptest.NewRecorder()
+			Auth(fakeAuthService{}, testKeyword, logger)(next).ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("got status %d, want %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusOK && userID != 5 {
+				t.Errorf("got user %v in the context, want 5", userID)
+			}
+			if tt.status != http.StatusOK && userID != nil {
+				t.Error("the request reached the handler")
+			}
+		})
+	}
+}
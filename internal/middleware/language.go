@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"github.com/fichca/image-loader/internal/i18n"
+	"net/http"
+)
+
+// Language picks the response language from the Accept-Language header and stores it in the request context.
+func Language(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		lang := i18n.FromAcceptLanguage(r.Header.Get("Accept-Language"))
+
+		w.Header().Set("Content-Language", string(lang))
+		w.Header().Add("Vary", "Accept-Language")
+		next.ServeHTTP(w, r.WithContext(i18n.WithLang(r.Context(), lang)))
+	}
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,106 @@
+package openapi
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// spec is the OpenAPI 3 description of the /api/v1 routes.
+//
+//go:embed openapi.json
+var spec []byte
+
+// ui is Swagger UI 5.18.2, the swagger-ui-dist bundle without its source maps. Only
+// swagger-initializer.js is changed, to load the spec from ../openapi.json and nothing from other hosts.
+//
+//go:embed ui
+var ui embed.FS
+
+type document struct {
+	Paths map[string]map[string]json.RawMessage `json:"paths"`
+}
+
+// Spec returns the OpenAPI document.
+func Spec() []byte {
+	return spec
+}
+
+// SpecFor returns the OpenAPI document with serverURL as its only server.
+func SpecFor(serverURL string) ([]byte, error) {
+	var doc map[string]any
+	err := json.Unmarshal(spec, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the OpenAPI spec: %w", err)
+	}
+
+	doc["servers"] = []map[string]string{{"url": serverURL}}
+	return json.Marshal(doc)
+}
+
+// UI returns the files of Swagger UI, index.html loads the spec from ../openapi.json.
+func UI() fs.FS {
+	sub, err := fs.Sub(ui, "ui")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// CheckRoutes compares the routes under prefix with the operations of the spec, it fails
+// when a route is missing from the spec or an operation has no route.
+func CheckRoutes(routes chi.Routes, prefix string) error {
+	var doc document
+	err := json.Unmarshal(spec, &doc)
+	if err != nil {
+		return fmt.Errorf("failed to parse the OpenAPI spec: %w", err)
+	}
+
+	operations := make(map[string]bool)
+	for path, item := range doc.Paths {
+		for method := range item {
+			if method == "parameters" {
+				continue
+			}
+			operations[strings.ToUpper(method)+" "+path] = false
+		}
+	}
+
+	var undocumented []string
+	err = chi.Walk(routes, func(method string, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if !strings.HasPrefix(route, prefix+"/") {
+			return nil
+		}
+
+		operation := method + " " + route
+		if _, ok := operations[operation]; !ok {
+			undocumented = append(undocumented, operation)
+			return nil
+		}
+		operations[operation] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var unrouted []string
+	for operation, routed := range operations {
+		if !routed {
+			unrouted = append(unrouted, operation)
+		}
+	}
+
+	if len(undocumented) == 0 && len(unrouted) == 0 {
+		return nil
+	}
+	sort.Strings(undocumented)
+	sort.Strings(unrouted)
+	return fmt.Errorf("the routes do not match the OpenAPI spec, not in the spec: [%s], not routed: [%s]",
+		strings.Join(undocumented, ", "), strings.Join(unrouted, ", "))
+}
@@ -0,0 +1,442 @@
+// Package openapitest checks requests and responses against the OpenAPI spec of the API, so
+// handler tests can assert that what they send and receive is what the spec documents:
+//
+//	err := openapitest.ValidateRequest(req, "/api/v1/users/{userID}", body)
+//	err = openapitest.ValidateResponse(http.MethodGet, "/api/v1/users/{userID}", w.Code, w.Header(), w.Body.Bytes())
+//
+// Only the parts of OpenAPI 3 and JSON Schema the spec uses are understood. Objects are checked
+// strictly: properties that the schema does not list fail unless additionalProperties allows them,
+// so fields a handler adds without documenting them are found.
+package openapitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/fichca/image-loader/internal/openapi"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type document struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas   map[string]*Schema   `json:"schemas"`
+		Responses map[string]*Response `json:"responses"`
+	} `json:"components"`
+}
+
+type Operation struct {
+	Parameters  []*Parameter         `json:"parameters"`
+	RequestBody *RequestBody         `json:"requestBody"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Ref     string                `json:"$ref"`
+	Content map[string]*MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Enum                 []any              `json:"enum"`
+	Nullable             bool               `json:"nullable"`
+	Required             []string           `json:"required"`
+	Properties           map[string]*Schema `json:"properties"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+	OneOf                []*Schema          `json:"oneOf"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+}
+
+var doc = mustParse()
+
+func mustParse() *document {
+	var d document
+	err := json.Unmarshal(openapi.Spec(), &d)
+	if err != nil {
+		panic(fmt.Sprintf("openapitest: failed to parse the spec: %v", err))
+	}
+	return &d
+}
+
+// Operations returns the operations of the spec as "METHOD /path", sorted.
+func Operations() []string {
+	var operations []string
+	for path, item := range doc.Paths {
+		for method := range item {
+			if method != "parameters" {
+				operations = append(operations, strings.ToUpper(method)+" "+path)
+			}
+		}
+	}
+	sort.Strings(operations)
+	return operations
+}
+
+// Lookup returns the operation of the spec served at the route pattern path.
+func Lookup(method, path string) (*Operation, error) {
+	item, ok := doc.Paths[path]
+	if !ok {
+		return nil, fmt.Errorf("%s is not in the spec", path)
+	}
+
+	raw, ok := item[strings.ToLower(method)]
+	if !ok {
+		return nil, fmt.Errorf("%s %s is not in the spec", method, path)
+	}
+
+	var operation Operation
+	err := json.Unmarshal(raw, &operation)
+	if err != nil {
+		return nil, err
+	}
+
+	if shared, ok := item["parameters"]; ok {
+		var parameters []*Parameter
+		err = json.Unmarshal(shared, &parameters)
+		if err != nil {
+			return nil, err
+		}
+		operation.Parameters = append(parameters, operation.Parameters...)
+	}
+
+	return &operation, nil
+}
+
+// ValidateRequest checks the parameters and the body of r, a request to the route pattern path.
+// body is passed separately because r.Body is consumed by the handler.
+func ValidateRequest(r *http.Request, path string, body []byte) error {
+	operation, err := Lookup(r.Method, path)
+	if err != nil {
+		return err
+	}
+
+	values, err := pathValues(path, r.URL.Path)
+	if err != nil {
+		return err
+	}
+
+	for _, param := range operation.Parameters {
+		var value string
+		var present bool
+		switch param.In {
+		case "path":
+			value, present = values[param.Name]
+		case "query":
+			present = r.URL.Query().Has(param.Name)
+			value = r.URL.Query().Get(param.Name)
+		case "header":
+			value = r.Header.Get(param.Name)
+			present = value != ""
+		}
+
+		if !present {
+			if param.Required {
+				return fmt.Errorf("%s parameter %s is required", param.In, param.Name)
+			}
+			continue
+		}
+
+		err = validateParam(value, param.Schema)
+		if err != nil {
+			return fmt.Errorf("%s parameter %s: %w", param.In, param.Name, err)
+		}
+	}
+
+	if operation.RequestBody == nil {
+		if len(body) > 0 {
+			return fmt.Errorf("%s %s takes no body", r.Method, path)
+		}
+		return nil
+	}
+
+	if len(body) == 0 {
+		if operation.RequestBody.Required {
+			return fmt.Errorf("%s %s requires a body", r.Method, path)
+		}
+		return nil
+	}
+
+	return validateContent(operation.RequestBody.Content, r.Header.Get("Content-Type"), body)
+}
+
+// ValidateResponse checks that status is documented for the operation and that the body
+// matches the schema of its content type.
+func ValidateResponse(method, path string, status int, header http.Header, body []byte) error {
+	operation, err := Lookup(method, path)
+	if err != nil {
+		return err
+	}
+
+	response, ok := operation.Responses[strconv.Itoa(status)]
+	if !ok {
+		return fmt.Errorf("status %d is not documented for %s %s", status, method, path)
+	}
+	if response.Ref != "" {
+		response, ok = doc.Components.Responses[strings.TrimPrefix(response.Ref, "#/components/responses/")]
+		if !ok {
+			return fmt.Errorf("unknown response %s", response.Ref)
+		}
+	}
+
+	if len(response.Content) == 0 {
+		if len(body) > 0 {
+			return fmt.Errorf("status %d of %s %s has no documented body, got %q", status, method, path, body)
+		}
+		return nil
+	}
+
+	return validateContent(response.Content, header.Get("Content-Type"), body)
+}
+
+func validateContent(content map[string]*MediaType, contentType string, body []byte) error {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("invalid content type %q: %w", contentType, err)
+	}
+
+	media, ok := content[mediaType]
+	if !ok {
+		return fmt.Errorf("content type %s is not documented", mediaType)
+	}
+
+	if !strings.HasSuffix(mediaType, "json") || media.Schema == nil {
+		return nil
+	}
+
+	var value any
+	err = json.Unmarshal(body, &value)
+	if err != nil {
+		return fmt.Errorf("invalid JSON %q: %w", body, err)
+	}
+
+	return Validate(value, media.Schema)
+}
+
+// pathValues matches the request path against the route pattern and returns its parameters.
+func pathValues(pattern, path string) (map[string]string, error) {
+	patternParts := strings.Split(pattern, "/")
+	pathParts := strings.Split(path, "/")
+	if len(patternParts) != len(pathParts) {
+		return nil, fmt.Errorf("%s does not match %s", path, pattern)
+	}
+
+	values := make(map[string]string)
+	for i, part := range patternParts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			values[strings.Trim(part, "{}")] = pathParts[i]
+			continue
+		}
+		if part != pathParts[i] {
+			return nil, fmt.Errorf("%s does not match %s", path, pattern)
+		}
+	}
+	return values, nil
+}
+
+// validateParam checks a parameter, which arrives as text, against its schema.
+func validateParam(value string, schema *Schema) error {
+	schema = resolve(schema)
+	if schema == nil {
+		return nil
+	}
+
+	var v any = value
+	switch schema.Type {
+	case "integer":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		v = float64(n)
+	case "boolean":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+		v = b
+	}
+
+	return Validate(v, schema)
+}
+
+// Validate checks a decoded JSON value against the schema.
+func Validate(value any, schema *Schema) error {
+	return validate(value, schema, "$")
+}
+
+func validate(value any, schema *Schema, at string) error {
+	schema = resolve(schema)
+	if schema == nil {
+		return nil
+	}
+
+	if value == nil {
+		if schema.Nullable {
+			return nil
+		}
+		return fmt.Errorf("%s: null is not allowed", at)
+	}
+
+	if len(schema.OneOf) > 0 {
+		matched := 0
+		for _, option := range schema.OneOf {
+			if validate(value, option, at) == nil {
+				matched++
+			}
+		}
+		if matched != 1 {
+			return fmt.Errorf("%s: matches %d of the oneOf schemas, want 1", at, matched)
+		}
+		return nil
+	}
+
+	if len(schema.Enum) > 0 && !contains(schema.Enum, value) {
+		return fmt.Errorf("%s: %v is not one of %v", at, value, schema.Enum)
+	}
+
+	switch schema.Type {
+	case "object":
+		return validateObject(value, schema, at)
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s: %T is not an array", at, value)
+		}
+		for i, item := range items {
+			err := validate(item, schema.Items, fmt.Sprintf("%s[%d]", at, i))
+			if err != nil {
+				return err
+			}
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: %T is not a string", at, value)
+		}
+		length := len([]rune(s))
+		if schema.MinLength != nil && length < *schema.MinLength {
+			return fmt.Errorf("%s: %q is shorter than %d", at, s, *schema.MinLength)
+		}
+		if schema.MaxLength != nil && length > *schema.MaxLength {
+			return fmt.Errorf("%s: %q is longer than %d", at, s, *schema.MaxLength)
+		}
+		if schema.Format == "date-time" {
+			_, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return fmt.Errorf("%s: %q is not a date-time", at, s)
+			}
+		}
+	case "integer", "number":
+		n, ok := value.(float64)
+		if !ok {
+			return fmt.Errorf("%s: %T is not a number", at, value)
+		}
+		if schema.Type == "integer" && n != math.Trunc(n) {
+			return fmt.Errorf("%s: %v is not an integer", at, n)
+		}
+		if schema.Minimum != nil && n < *schema.Minimum {
+			return fmt.Errorf("%s: %v is less than %v", at, n, *schema.Minimum)
+		}
+		if schema.Maximum != nil && n > *schema.Maximum {
+			return fmt.Errorf("%s: %v is greater than %v", at, n, *schema.Maximum)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: %T is not a boolean", at, value)
+		}
+	}
+
+	return nil
+}
+
+func validateObject(value any, schema *Schema, at string) error {
+	object, ok := value.(map[string]any)
+	if !ok {
+		return fmt.Errorf("%s: %T is not an object", at, value)
+	}
+
+	for _, name := range schema.Required {
+		if _, ok := object[name]; !ok {
+			return fmt.Errorf("%s: %s is required", at, name)
+		}
+	}
+
+	var additional *Schema
+	allowAdditional := false
+	if len(schema.AdditionalProperties) > 0 {
+		err := json.Unmarshal(schema.AdditionalProperties, &allowAdditional)
+		if err != nil {
+			allowAdditional = true
+			err = json.Unmarshal(schema.AdditionalProperties, &additional)
+			if err != nil {
+				return fmt.Errorf("%s: invalid additionalProperties: %w", at, err)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		property, ok := schema.Properties[name]
+		if !ok {
+			if !allowAdditional {
+				return fmt.Errorf("%s: %s is not documented", at, name)
+			}
+			property = additional
+		}
+
+		err := validate(object[name], property, at+"."+name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func resolve(schema *Schema) *Schema {
+	for schema != nil && schema.Ref != "" {
+		schema = doc.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+	}
+	return schema
+}
+
+func contains(values []any, value any) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"github.com/fichca/image-loader/internal/apperr"
+	"github.com/lib/pq"
+)
+
+// uniqueViolation is the Postgres error code of a unique constraint violation.
+const uniqueViolation = "23505"
+
+var ErrAlreadyExists = apperr.New(apperr.KindConflict, "already_exists", "record already exists")
+
+// constraintErrors are the errors returned for violations of the unique constraints clients can run into.
+var constraintErrors = map[string]error{
+	"users_login_key": ErrLoginTaken,
+}
+
+// conflictErr turns a unique constraint violation into the error of the constraint or ErrAlreadyExists,
+// other errors are returned as they are.
+func conflictErr(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != uniqueViolation {
+		return err
+	}
+
+	if constraintErr, ok := constraintErrors[pqErr.Constraint]; ok {
+		return constraintErr
+	}
+	return fmt.Errorf("%w: %s", ErrAlreadyExists, pqErr.Constraint)
+}
@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"testing"
+)
+
+func TestConflictErr(t *testing.T) {
+	foreignKeyViolation := &pq.Error{Code: "23503", Constraint: "users_login_key"}
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"known constraint", &pq.Error{Code: uniqueViolation, Constraint: "users_login_key"}, ErrLoginTaken},
+		{"other constraint", &pq.Error{Code: uniqueViolation, Constraint: "tg_auth_telegram_id_key"}, ErrAlreadyExists},
+		{"wrapped", fmt.Errorf("failed to insert: %w", &pq.Error{Code: uniqueViolation, Constraint: "users_login_key"}), ErrLoginTaken},
+		{"other violation", foreignKeyViolation, foreignKeyViolation},
+		{"not a database error", sql.ErrNoRows, sql.ErrNoRows},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := conflictErr(tt.err)
+			if !errors.Is(got, tt.want) {
+				t.Errorf("got error %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,9 +2,13 @@ package repository
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"github.com/fichca/image-loader/internal/entity"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"strings"
+	"time"
 )
 
 type ImageRepo struct {
@@ -17,14 +21,92 @@ func NewImageRepo(db *sqlx.DB) *ImageRepo {
 	}
 }
 
-func (i *ImageRepo) Add(ctx context.Context, image entity.Image) error {
-	query := `INSERT INTO images(user_id, name, extension) VALUES (:user_id, :name, :extension)`
+// Add inserts a pending image, it becomes visible once Finalize records that its object is stored.
+func (i *ImageRepo) Add(ctx context.Context, image entity.Image) (int, error) {
+	query := `INSERT INTO images(user_id, name, extension, status, original_name, description, title, tags) 
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
 
-	_, err := i.db.NamedExecContext(ctx, query, &image)
+	var id int
+
+	tags := image.Tags
+	if tags == nil {
+		tags = pq.StringArray{}
+	}
+
+	err := i.db.QueryRowxContext(ctx, query, image.UserID, image.Name, image.Extension, entity.ImageStatusPending,
+		image.OriginalName, image.Description, image.Title, tags).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert image: %w", err)
+	}
+
+	return id, nil
+}
+
+// Reserve inserts an image row that waits for its object to be uploaded directly to the storage.
+func (i *ImageRepo) Reserve(ctx context.Context, image entity.Image) (int, error) {
+	query := `INSERT INTO images(user_id, name, extension, status, content_type, size, original_name) 
+              VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+
+	var id int
+
+	err := i.db.QueryRowxContext(ctx, query, image.UserID, image.Name, image.Extension, entity.ImageStatusPending,
+		image.ContentType, image.Size, image.OriginalName).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reserve image: %w", err)
+	}
+
+	return id, nil
+}
+
+func (i *ImageRepo) Finalize(ctx context.Context, image entity.Image) error {
+	query := `UPDATE images SET (status, content_type, size) = ($1, $2, $3) WHERE id = $4`
+
+	_, err := i.db.ExecContext(ctx, query, entity.ImageStatusReady, image.ContentType, image.Size, image.ID)
+	if err != nil {
+		return fmt.Errorf("failed to finalize image: %w", err)
+	}
+
+	return nil
+}
+
+// GetPendingCreatedBefore returns up to limit images reserved before t whose objects were never completed.
+func (i *ImageRepo) GetPendingCreatedBefore(ctx context.Context, t time.Time, limit int) ([]entity.Image, error) {
+	query := `SELECT * FROM images WHERE status = $1 AND created_at < $2 ORDER BY created_at LIMIT $3`
+
+	images := make([]entity.Image, 0)
+
+	err := i.db.SelectContext(ctx, &images, query, entity.ImageStatusPending, t, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending images: %w", err)
+	}
+
+	return images, nil
+}
+
+// DeletePending deletes the image if it is still pending and reports whether it was.
+func (i *ImageRepo) DeletePending(ctx context.Context, id int) (bool, error) {
+	query := `DELETE FROM images WHERE id = $1 AND status = $2`
+
+	res, err := i.db.ExecContext(ctx, query, id, entity.ImageStatusPending)
 	if err != nil {
-		return fmt.Errorf("failed to insert image: %w", err)
+		return false, fmt.Errorf("failed to delete pending image: %w", err)
 	}
 
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete pending image: %w", err)
+	}
+
+	return n > 0, nil
+}
+
+func (i *ImageRepo) DeleteById(ctx context.Context, id int) error {
+	query := `DELETE FROM images WHERE id = $1`
+
+	_, err := i.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete image: %w", err)
+	}
 	return nil
 }
 
@@ -44,7 +126,7 @@ func (i *ImageRepo) GetById(ctx context.Context, id int) (entity.Image, error) {
 }
 
 func (i *ImageRepo) GetAllByUserId(ctx context.Context, userID int) ([]entity.Image, error) {
-	query := `SELECT * FROM images WHERE user_id = $1`
+	query := `SELECT * FROM images WHERE user_id = $1 AND status = 'ready'`
 
 	var images []entity.Image
 
@@ -66,3 +148,90 @@ func (i *ImageRepo) GetAllByUserId(ctx context.Context, userID int) ([]entity.Im
 
 	return images, nil
 }
+
+// GetPageByUserId returns up to limit ready images of the user next to the cursor image id,
+// after it in ascending id order or, when before is set, preceding it.
+func (i *ImageRepo) GetPageByUserId(ctx context.Context, userID, cursor int, before bool, limit int) ([]entity.Image, error) {
+	query := `SELECT * FROM images WHERE user_id = $1 AND status = 'ready' AND id > $2 ORDER BY id LIMIT $3`
+	if before {
+		query = `SELECT * FROM images WHERE user_id = $1 AND status = 'ready' AND id < $2 ORDER BY id DESC LIMIT $3`
+	}
+
+	images := make([]entity.Image, 0)
+
+	err := i.db.SelectContext(ctx, &images, query, userID, cursor, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query images: %w", err)
+	}
+
+	if before {
+		for l, r := 0, len(images)-1; l < r; l, r = l+1, r-1 {
+			images[l], images[r] = images[r], images[l]
+		}
+	}
+
+	return images, nil
+}
+
+// SearchByUserId returns the ready images of the user whose title contains the search text or
+// that have it as a tag, newest first. A leading # is ignored and an empty search matches every image.
+func (i *ImageRepo) SearchByUserId(ctx context.Context, userID int, search string, offset, limit int) ([]entity.Image, error) {
+	query := `SELECT * FROM images 
+              WHERE user_id = $1 AND status = 'ready' 
+                AND ($2 = '' OR title ILIKE '%' || $2 || '%' OR $3 = ANY(tags)) 
+              ORDER BY id DESC 
+              OFFSET $4 LIMIT $5`
+
+	images := make([]entity.Image, 0)
+
+	search = strings.TrimPrefix(search, "#")
+
+	err := i.db.SelectContext(ctx, &images, query, userID, escapeLike(search), strings.ToLower(search), offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search images: %w", err)
+	}
+
+	return images, nil
+}
+
+// GetSummaryByUserId counts the ready images of the user and sums their size.
+func (i *ImageRepo) GetSummaryByUserId(ctx context.Context, userID int) (entity.ImageSummary, error) {
+	query := `SELECT count(*) AS count, coalesce(sum(size), 0) AS total_size, max(created_at) AS last_added_at
+              FROM images WHERE user_id = $1 AND status = 'ready'`
+
+	var summary entity.ImageSummary
+
+	err := i.db.GetContext(ctx, &summary, query, userID)
+	if err != nil {
+		return entity.ImageSummary{}, fmt.Errorf("failed to summarize images: %w", err)
+	}
+
+	return summary, nil
+}
+
+// GetAllByUserIdCreatedBetween returns the ready images of the user, a null bound leaves that side open.
+// A non-empty tag keeps only the images that have it, a leading # is ignored.
+func (i *ImageRepo) GetAllByUserIdCreatedBetween(ctx context.Context, userID int, from, to sql.NullTime, tag string) ([]entity.Image, error) {
+	query := `SELECT * FROM images 
+              WHERE user_id = $1 AND status = 'ready' 
+                AND ($2::timestamp IS NULL OR created_at >= $2) 
+                AND ($3::timestamp IS NULL OR created_at < $3) 
+                AND ($4 = '' OR tags @> ARRAY[$4::text]) 
+              ORDER BY created_at, id`
+
+	images := make([]entity.Image, 0)
+
+	tag = strings.ToLower(strings.TrimPrefix(tag, "#"))
+
+	err := i.db.SelectContext(ctx, &images, query, userID, from, to, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query images: %w", err)
+	}
+
+	return images, nil
+}
+
+// escapeLike makes LIKE treat the wildcards in s as plain characters.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/fichca/image-loader/internal/entity"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+type ImportRepo struct {
+	db *sqlx.DB
+}
+
+func NewImportRepo(db *sqlx.DB) *ImportRepo {
+	return &ImportRepo{
+		db: db,
+	}
+}
+
+func (i *ImportRepo) CreateJob(ctx context.Context, userID int, urls []string) (int, error) {
+	tx, err := i.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+
+	err = tx.QueryRowxContext(ctx, `INSERT INTO import_jobs(user_id) VALUES ($1) RETURNING id`, userID).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert import job: %w", err)
+	}
+
+	for _, url := range urls {
+		_, err = tx.ExecContext(ctx, `INSERT INTO import_items(job_id, url) VALUES ($1, $2)`, id, url)
+		if err != nil {
+			return 0, fmt.Errorf("failed to insert import item: %w", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("failed to commit import job: %w", err)
+	}
+
+	return id, nil
+}
+
+func (i *ImportRepo) GetJobById(ctx context.Context, id int) (entity.ImportJob, error) {
+	query := `SELECT * FROM import_jobs WHERE id = $1`
+
+	var job entity.ImportJob
+
+	row := i.db.QueryRowxContext(ctx, query, id)
+
+	err := row.StructScan(&job)
+	if err != nil {
+		return entity.ImportJob{}, fmt.Errorf("failed to scan struct import job: %w", err)
+	}
+
+	return job, nil
+}
+
+func (i *ImportRepo) GetItemsByJobId(ctx context.Context, jobID int) ([]entity.ImportItem, error) {
+	query := `SELECT * FROM import_items WHERE job_id = $1 ORDER BY id`
+
+	items := make([]entity.ImportItem, 0)
+
+	err := i.db.SelectContext(ctx, &items, query, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query import items: %w", err)
+	}
+
+	return items, nil
+}
+
+func (i *ImportRepo) GetPendingJobIds(ctx context.Context) ([]int, error) {
+	query := `SELECT id FROM import_jobs WHERE status = $1 ORDER BY id`
+
+	ids := make([]int, 0)
+
+	err := i.db.SelectContext(ctx, &ids, query, entity.ImportStatusPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending import jobs: %w", err)
+	}
+
+	return ids, nil
+}
+
+// ClaimJob moves a pending job to running, false means another worker already took it.
+func (i *ImportRepo) ClaimJob(ctx context.Context, id int) (bool, error) {
+	query := `UPDATE import_jobs SET (status, updated_at) = ($1, now()) WHERE id = $2 AND status = $3`
+
+	res, err := i.db.ExecContext(ctx, query, entity.ImportStatusRunning, id, entity.ImportStatusPending)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim import job: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim import job: %w", err)
+	}
+
+	return n == 1, nil
+}
+
+// ResetStaleJobs returns running jobs that made no progress for the given time back to pending.
+func (i *ImportRepo) ResetStaleJobs(ctx context.Context, staleAfter time.Duration) error {
+	query := `UPDATE import_jobs SET status = $1 WHERE status = $2 AND updated_at < $3`
+
+	_, err := i.db.ExecContext(ctx, query, entity.ImportStatusPending, entity.ImportStatusRunning, time.Now().Add(-staleAfter))
+	if err != nil {
+		return fmt.Errorf("failed to reset stale import jobs: %w", err)
+	}
+
+	return nil
+}
+
+func (i *ImportRepo) UpdateJobStatus(ctx context.Context, id int, status string) error {
+	query := `UPDATE import_jobs SET (status, updated_at) = ($1, now()) WHERE id = $2`
+
+	_, err := i.db.ExecContext(ctx, query, status, id)
+	if err != nil {
+		return fmt.Errorf("failed to update import job: %w", err)
+	}
+
+	return nil
+}
+
+func (i *ImportRepo) UpdateItem(ctx context.Context, item entity.ImportItem) error {
+	tx, err := i.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE import_items SET (status, image_id, error) = (:status, :image_id, :error) WHERE id = :id`
+
+	_, err = tx.NamedExecContext(ctx, query, &item)
+	if err != nil {
+		return fmt.Errorf("failed to update import item: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE import_jobs SET updated_at = now() WHERE id = $1`, item.JobID)
+	if err != nil {
+		return fmt.Errorf("failed to touch import job: %w", err)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/fichca/image-loader/internal/entity"
+	"github.com/jmoiron/sqlx"
+)
+
+type NotificationRepo struct {
+	db *sqlx.DB
+}
+
+func NewNotificationRepo(db *sqlx.DB) *NotificationRepo {
+	return &NotificationRepo{
+		db: db,
+	}
+}
+
+func (n *NotificationRepo) GetByUserId(ctx context.Context, userID int) (entity.NotificationSettings, error) {
+	query := `SELECT * FROM notification_settings WHERE user_id = $1`
+
+	var settings entity.NotificationSettings
+
+	err := n.db.QueryRowxContext(ctx, query, userID).StructScan(&settings)
+	if err != nil {
+		return entity.NotificationSettings{}, fmt.Errorf("failed to scan struct notification settings: %w", err)
+	}
+
+	return settings, nil
+}
+
+func (n *NotificationRepo) Save(ctx context.Context, settings entity.NotificationSettings) error {
+	query := `INSERT INTO notification_settings(user_id, image_uploaded, image_deleted, profile_updated) 
+              VALUES (:user_id, :image_uploaded, :image_deleted, :profile_updated) 
+              ON CONFLICT (user_id) DO UPDATE SET (image_uploaded, image_deleted, profile_updated) = 
+                  (:image_uploaded, :image_deleted, :profile_updated)`
+
+	_, err := n.db.NamedExecContext(ctx, query, settings)
+	if err != nil {
+		return fmt.Errorf("failed to save notification settings: %w", err)
+	}
+
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/fichca/image-loader/internal/entity"
 	"github.com/jmoiron/sqlx"
+	"time"
 )
 
 type TgAuthRepo struct {
@@ -17,30 +18,133 @@ func NewTgAuthRepo(db *sqlx.DB) *TgAuthRepo {
 	}
 }
 
-func (t TgAuthRepo) Authorize(ctx context.Context, userID int, telegramID int64) error {
-	query := `INSERT INTO tg_auth(user_id, telegram_id) VALUES ($1, $2)`
+// LinkWithCode consumes the link code and links the Telegram account to the code's user in one
+// transaction, so the code is only used up when the account gets linked. It reports false when the
+// account is linked already and returns sql.ErrNoRows when the code is invalid or expired.
+func (t TgAuthRepo) LinkWithCode(ctx context.Context, code string, telegramID int64) (bool, error) {
+	tx, err := t.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var userID int
+
+	query := `DELETE FROM tg_link_codes WHERE code = $1 AND expires_at > $2 RETURNING user_id`
 
-	_, err := t.db.ExecContext(ctx, query, userID, telegramID)
+	err = tx.QueryRowxContext(ctx, query, code, time.Now()).Scan(&userID)
 	if err != nil {
-		return fmt.Errorf("failed to tg auth: %w", err)
+		return false, fmt.Errorf("failed to consume tg link code: %w", err)
 	}
 
-	return nil
+	query = `INSERT INTO tg_auth(user_id, telegram_id) VALUES ($1, $2) ON CONFLICT (telegram_id) DO NOTHING`
+
+	res, err := tx.ExecContext(ctx, query, userID, telegramID)
+	if err != nil {
+		return false, fmt.Errorf("failed to tg auth: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to tg auth: %w", err)
+	}
+	if n == 0 {
+		return false, nil
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, fmt.Errorf("failed to commit tg link: %w", err)
+	}
+
+	return true, nil
 }
 
+// CheckTgAuth returns the user the Telegram account is linked to and records the account's activity.
+// The activity is written at most once a minute, every update of a linked user goes through here.
 func (t TgAuthRepo) CheckTgAuth(ctx context.Context, tgID int64) (userID int, err error) {
-	query := `SELECT * 
-              FROM tg_auth tga 
-              WHERE tga.telegram_id = $1`
+	query := `SELECT user_id FROM tg_auth WHERE telegram_id = $1`
 
-	var tgAuth entity.TgAuth
+	err = t.db.QueryRowxContext(ctx, query, tgID).Scan(&userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to tg auth: %w", err)
+	}
 
-	row := t.db.QueryRowxContext(ctx, query, tgID)
+	query = `UPDATE tg_auth SET last_active_at = now()
+             WHERE telegram_id = $1 AND (last_active_at IS NULL OR last_active_at < now() - interval '1 minute')`
 
-	err = row.StructScan(&tgAuth)
+	_, err = t.db.ExecContext(ctx, query, tgID)
 	if err != nil {
-		return 0, fmt.Errorf("failed to tg auth: %w", err)
+		return 0, fmt.Errorf("failed to record tg activity: %w", err)
+	}
+
+	return userID, nil
+}
+
+func (t TgAuthRepo) GetLinksByUserId(ctx context.Context, userID int) ([]entity.TgAuth, error) {
+	query := `SELECT * FROM tg_auth WHERE user_id = $1 ORDER BY linked_at, id`
+
+	links := make([]entity.TgAuth, 0)
+
+	err := t.db.SelectContext(ctx, &links, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tg links: %w", err)
+	}
+
+	return links, nil
+}
+
+// DeleteLinks unlinks the user's Telegram accounts, all of them when telegramID is zero.
+// It reports how many accounts were unlinked.
+func (t TgAuthRepo) DeleteLinks(ctx context.Context, userID int, telegramID int64) (int64, error) {
+	query := `DELETE FROM tg_auth WHERE user_id = $1 AND ($2::int8 = 0 OR telegram_id = $2)`
+
+	res, err := t.db.ExecContext(ctx, query, userID, telegramID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete tg links: %w", err)
+	}
+
+	return res.RowsAffected()
+}
+
+func (t TgAuthRepo) AddLinkCode(ctx context.Context, code entity.TgLinkCode) error {
+	query := `INSERT INTO tg_link_codes(code, user_id, expires_at) VALUES (:code, :user_id, :expires_at)`
+
+	_, err := t.db.NamedExecContext(ctx, query, &code)
+	if err != nil {
+		return fmt.Errorf("failed to insert tg link code: %w", err)
+	}
+
+	return nil
+}
+
+// Unlink removes the link of the Telegram account and reports whether there was one.
+func (t TgAuthRepo) Unlink(ctx context.Context, tgID int64) (bool, error) {
+	query := `DELETE FROM tg_auth WHERE telegram_id = $1`
+
+	res, err := t.db.ExecContext(ctx, query, tgID)
+	if err != nil {
+		return false, fmt.Errorf("failed to unlink tg account: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to unlink tg account: %w", err)
+	}
+
+	return n > 0, nil
+}
+
+// GetTelegramIDs returns the Telegram accounts linked to the user, their private chats have the same ids.
+func (t TgAuthRepo) GetTelegramIDs(ctx context.Context, userID int) ([]int64, error) {
+	query := `SELECT telegram_id FROM tg_auth WHERE user_id = $1`
+
+	ids := make([]int64, 0)
+
+	err := t.db.SelectContext(ctx, &ids, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tg accounts: %w", err)
 	}
 
-	return tgAuth.UserID, nil
+	return ids, nil
 }
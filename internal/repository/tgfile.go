@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/fichca/image-loader/internal/entity"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type TgFileRepo struct {
+	db *sqlx.DB
+}
+
+func NewTgFileRepo(db *sqlx.DB) *TgFileRepo {
+	return &TgFileRepo{
+		db: db,
+	}
+}
+
+// GetFileIDs returns the cached file_ids of the images variant by image id, images without one are left out.
+func (t *TgFileRepo) GetFileIDs(ctx context.Context, imageIDs []int, variant string) (map[int]string, error) {
+	query := `SELECT * FROM tg_file_ids WHERE image_id = ANY($1) AND variant = $2`
+
+	fileIDs := make([]entity.TgFileID, 0)
+
+	err := t.db.SelectContext(ctx, &fileIDs, query, pq.Array(imageIDs), variant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tg file ids: %w", err)
+	}
+
+	result := make(map[int]string, len(fileIDs))
+	for _, fileID := range fileIDs {
+		result[fileID.ImageID] = fileID.FileID
+	}
+
+	return result, nil
+}
+
+func (t *TgFileRepo) Save(ctx context.Context, fileID entity.TgFileID) error {
+	query := `INSERT INTO tg_file_ids(image_id, variant, file_id) VALUES (:image_id, :variant, :file_id)
+              ON CONFLICT (image_id, variant) DO UPDATE SET (file_id, created_at) = (:file_id, now())`
+
+	_, err := t.db.NamedExecContext(ctx, query, fileID)
+	if err != nil {
+		return fmt.Errorf("failed to save tg file id: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteByImageIds drops every cached variant of the images.
+func (t *TgFileRepo) DeleteByImageIds(ctx context.Context, imageIDs []int) error {
+	query := `DELETE FROM tg_file_ids WHERE image_id = ANY($1)`
+
+	_, err := t.db.ExecContext(ctx, query, pq.Array(imageIDs))
+	if err != nil {
+		return fmt.Errorf("failed to delete tg file ids: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/fichca/image-loader/internal/entity"
+	"github.com/jmoiron/sqlx"
+)
+
+type TgLanguageRepo struct {
+	db *sqlx.DB
+}
+
+func NewTgLanguageRepo(db *sqlx.DB) *TgLanguageRepo {
+	return &TgLanguageRepo{
+		db: db,
+	}
+}
+
+func (t *TgLanguageRepo) Get(ctx context.Context, telegramID int64) (entity.TgLanguage, error) {
+	query := `SELECT * FROM tg_languages WHERE telegram_id = $1`
+
+	var language entity.TgLanguage
+
+	err := t.db.QueryRowxContext(ctx, query, telegramID).StructScan(&language)
+	if err != nil {
+		return entity.TgLanguage{}, fmt.Errorf("failed to scan struct tg language: %w", err)
+	}
+
+	return language, nil
+}
+
+func (t *TgLanguageRepo) Save(ctx context.Context, language entity.TgLanguage) error {
+	query := `INSERT INTO tg_languages(telegram_id, language, updated_at) VALUES (:telegram_id, :language, :updated_at)
+              ON CONFLICT (telegram_id) DO UPDATE SET (language, updated_at) = (:language, :updated_at)`
+
+	_, err := t.db.NamedExecContext(ctx, query, language)
+	if err != nil {
+		return fmt.Errorf("failed to save tg language: %w", err)
+	}
+
+	return nil
+}
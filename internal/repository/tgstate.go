@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/fichca/image-loader/internal/entity"
+	"github.com/jmoiron/sqlx"
+)
+
+type TgStateRepo struct {
+	db *sqlx.DB
+}
+
+func NewTgStateRepo(db *sqlx.DB) *TgStateRepo {
+	return &TgStateRepo{
+		db: db,
+	}
+}
+
+func (t *TgStateRepo) Get(ctx context.Context, chatID int64) (entity.TgChatState, error) {
+	query := `SELECT * FROM tg_chat_states WHERE chat_id = $1`
+
+	var state entity.TgChatState
+
+	err := t.db.QueryRowxContext(ctx, query, chatID).StructScan(&state)
+	if err != nil {
+		return entity.TgChatState{}, fmt.Errorf("failed to scan struct tg chat state: %w", err)
+	}
+
+	return state, nil
+}
+
+func (t *TgStateRepo) Save(ctx context.Context, state entity.TgChatState) error {
+	query := `INSERT INTO tg_chat_states(chat_id, state, data, updated_at) VALUES (:chat_id, :state, :data, :updated_at)
+              ON CONFLICT (chat_id) DO UPDATE SET (state, data, updated_at) = (:state, :data, :updated_at)`
+
+	_, err := t.db.NamedExecContext(ctx, query, state)
+	if err != nil {
+		return fmt.Errorf("failed to save tg chat state: %w", err)
+	}
+
+	return nil
+}
+
+func (t *TgStateRepo) Delete(ctx context.Context, chatID int64) error {
+	query := `DELETE FROM tg_chat_states WHERE chat_id = $1`
+
+	_, err := t.db.ExecContext(ctx, query, chatID)
+	if err != nil {
+		return fmt.Errorf("failed to delete tg chat state: %w", err)
+	}
+
+	return nil
+}
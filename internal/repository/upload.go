@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/fichca/image-loader/internal/entity"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+type UploadRepo struct {
+	db *sqlx.DB
+}
+
+func NewUploadRepo(db *sqlx.DB) *UploadRepo {
+	return &UploadRepo{
+		db: db,
+	}
+}
+
+func (u *UploadRepo) Add(ctx context.Context, upload entity.Upload) error {
+	query := `INSERT INTO image_uploads(id, user_id, object_name, multipart_id, upload_length, file_name, metadata) 
+              VALUES (:id, :user_id, :object_name, :multipart_id, :upload_length, :file_name, :metadata)`
+
+	_, err := u.db.NamedExecContext(ctx, query, &upload)
+	if err != nil {
+		return fmt.Errorf("failed to insert upload: %w", err)
+	}
+
+	return nil
+}
+
+func (u *UploadRepo) GetById(ctx context.Context, id string) (entity.Upload, error) {
+	query := `SELECT * FROM image_uploads WHERE id = $1`
+
+	var upload entity.Upload
+
+	row := u.db.QueryRowxContext(ctx, query, id)
+
+	err := row.StructScan(&upload)
+	if err != nil {
+		return entity.Upload{}, fmt.Errorf("failed to scan struct upload: %w", err)
+	}
+
+	return upload, nil
+}
+
+// UpdateProgress stores the new offset of the upload only if nobody has moved it since prevOffset was read.
+func (u *UploadRepo) UpdateProgress(ctx context.Context, upload entity.Upload, prevOffset int64) (bool, error) {
+	query := `UPDATE image_uploads SET (upload_offset, part_count, tail_size) = ($1, $2, $3) 
+              WHERE id = $4 AND upload_offset = $5`
+
+	res, err := u.db.ExecContext(ctx, query, upload.Offset, upload.PartCount, upload.TailSize, upload.ID, prevOffset)
+	if err != nil {
+		return false, fmt.Errorf("failed to update upload: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to update upload: %w", err)
+	}
+
+	return n == 1, nil
+}
+
+// MarkAssembled records that the parts of the upload were joined into its object.
+func (u *UploadRepo) MarkAssembled(ctx context.Context, id string) error {
+	query := `UPDATE image_uploads SET assembled = true WHERE id = $1`
+
+	_, err := u.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to mark upload assembled: %w", err)
+	}
+	return nil
+}
+
+// SetImage records the image made from the upload.
+func (u *UploadRepo) SetImage(ctx context.Context, id string, imageID int) error {
+	query := `UPDATE image_uploads SET image_id = $1 WHERE id = $2`
+
+	_, err := u.db.ExecContext(ctx, query, imageID, id)
+	if err != nil {
+		return fmt.Errorf("failed to set upload image: %w", err)
+	}
+	return nil
+}
+
+// GetCreatedBefore returns up to limit uploads created before t, the oldest first.
+func (u *UploadRepo) GetCreatedBefore(ctx context.Context, t time.Time, limit int) ([]entity.Upload, error) {
+	query := `SELECT * FROM image_uploads WHERE created_at < $1 ORDER BY created_at LIMIT $2`
+
+	uploads := make([]entity.Upload, 0)
+
+	err := u.db.SelectContext(ctx, &uploads, query, t, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expired uploads: %w", err)
+	}
+
+	return uploads, nil
+}
+
+func (u *UploadRepo) DeleteById(ctx context.Context, id string) error {
+	query := `DELETE FROM image_uploads WHERE id = $1`
+
+	_, err := u.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete upload: %w", err)
+	}
+	return nil
+}
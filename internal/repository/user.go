@@ -3,11 +3,15 @@ package repository
 import (
 	"context"
 	"fmt"
+	"github.com/fichca/image-loader/internal/apperr"
 	"github.com/fichca/image-loader/internal/entity"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/jmoiron/sqlx"
+	"strings"
 )
 
+var ErrLoginTaken = apperr.New(apperr.KindConflict, "login_taken", "login is already taken")
+
 type UserRepo struct {
 	db *sqlx.DB
 }
@@ -23,7 +27,7 @@ func (u *UserRepo) Add(ctx context.Context, user entity.User) error {
 
 	_, err := u.db.NamedExecContext(ctx, query, &user)
 	if err != nil {
-		return fmt.Errorf("failed to insert user: %w", err)
+		return fmt.Errorf("failed to insert user: %w", conflictErr(err))
 	}
 
 	return nil
@@ -44,47 +48,126 @@ func (u *UserRepo) GetById(ctx context.Context, id int) (entity.User, error) {
 	return us, nil
 }
 
-func (u *UserRepo) Update(ctx context.Context, user entity.User) error {
-	query := `UPDATE users SET (name, description, login, password) = (:name, :description, :login, :password) WHERE id = :id`
+// UpdateProfile changes the name, login and description of the user and reports whether it exists.
+func (u *UserRepo) UpdateProfile(ctx context.Context, user entity.User) (bool, error) {
+	query := `UPDATE users SET (name, description, login) = (:name, :description, :login) WHERE id = :id`
 
-	_, err := u.db.NamedExecContext(ctx, query, user)
+	res, err := u.db.NamedExecContext(ctx, query, user)
 	if err != nil {
-		return fmt.Errorf("failed to insert user: %w", err)
+		return false, fmt.Errorf("failed to update user profile: %w", conflictErr(err))
 	}
 
-	return nil
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to update user profile: %w", err)
+	}
+
+	return updated > 0, nil
 }
 
-func (u *UserRepo) DeleteById(ctx context.Context, id int) error {
-	query := `DELETE FROM users WHERE id = $1`
+// UpdatePassword replaces the password of the user when current is its password, it reports
+// whether the password was replaced.
+func (u *UserRepo) UpdatePassword(ctx context.Context, id int, current, password string) (bool, error) {
+	query := `UPDATE users SET password = $3 WHERE id = $1 AND password = $2`
 
-	_, err := u.db.ExecContext(ctx, query, id)
+	res, err := u.db.ExecContext(ctx, query, id, current, password)
 	if err != nil {
-		return fmt.Errorf("failed to delete user: %w", err)
+		return false, fmt.Errorf("failed to update user password: %w", err)
 	}
-	return nil
+
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to update user password: %w", err)
+	}
+
+	return updated > 0, nil
 }
 
-func (u *UserRepo) GetAll(ctx context.Context) ([]entity.User, error) {
-	query := `SELECT * FROM users `
-	rows, err := u.db.Queryx(query)
+// DeleteById removes the user and reports whether it existed.
+func (u *UserRepo) DeleteById(ctx context.Context, id int) (bool, error) {
+	query := `DELETE FROM users WHERE id = $1`
+
+	res, err := u.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete user: %w", err)
+	}
 
+	deleted, err := res.RowsAffected()
 	if err != nil {
-		return make([]entity.User, 0), fmt.Errorf("failed to scan users: %w", err)
+		return false, fmt.Errorf("failed to delete user: %w", err)
 	}
 
+	return deleted > 0, nil
+}
+
+// GetPage returns the users of the query found by its search text, see userSearch.
+func (u *UserRepo) GetPage(ctx context.Context, query entity.UserQuery) ([]entity.User, error) {
+	q, args := userPageQuery(query)
+
 	users := make([]entity.User, 0)
-	for rows.Next() {
-		var user entity.User
-		err := rows.StructScan(&user)
-		if err != nil {
-			return make([]entity.User, 0), fmt.Errorf("failed to scan user: %w", err)
-		}
-		users = append(users, user)
+
+	err := u.db.SelectContext(ctx, &users, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %w", err)
 	}
+
 	return users, nil
 }
 
+// Count returns how many users GetPage finds for the search text over all pages.
+func (u *UserRepo) Count(ctx context.Context, search string) (int, error) {
+	where, args := userSearch(search)
+	query := `SELECT count(*) FROM users WHERE ` + where
+
+	var count int
+
+	err := u.db.GetContext(ctx, &count, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	return count, nil
+}
+
+func userPageQuery(query entity.UserQuery) (string, []any) {
+	where, args := userSearch(query.Search)
+
+	op, order := ">", "ASC"
+	if query.Desc {
+		op, order = "<", "DESC"
+	}
+
+	orderBy := "id " + order
+	if query.Sort == "name" {
+		orderBy = "name " + order + ", id " + order
+	}
+
+	if query.AfterID > 0 {
+		if query.Sort == "name" {
+			args = append(args, query.AfterName, query.AfterID)
+			where += fmt.Sprintf(" AND (name, id) %s ($%d, $%d)", op, len(args)-1, len(args))
+		} else {
+			args = append(args, query.AfterID)
+			where += fmt.Sprintf(" AND id %s $%d", op, len(args))
+		}
+	}
+
+	args = append(args, query.Limit)
+	return fmt.Sprintf(`SELECT * FROM users WHERE %s ORDER BY %s LIMIT $%d`, where, orderBy, len(args)), args
+}
+
+// userSearch returns the condition matching the users found by search with its arguments, numbered from $1.
+// Names match by prefix, ignoring case, and logins only as a whole, so the list cannot be used to find
+// which logins exist. The prefix is passed as a ready LIKE pattern, so the planner sees a literal prefix
+// and can use users_name_prefix_idx. An empty search matches every user.
+func userSearch(search string) (string, []any) {
+	if search == "" {
+		return "TRUE", nil
+	}
+
+	return "(lower(name) LIKE $1 OR login = $2)", []any{strings.ToLower(escapeLike(search)) + "%", search}
+}
+
 func (u *UserRepo) GetUserByLoginAndPassword(ctx context.Context, login, password string) (entity.User, error) {
 	query := `SELECT * FROM users WHERE login = $1 AND password = $2`
 
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"github.com/fichca/image-loader/internal/entity"
+	"reflect"
+	"testing"
+)
+
+func TestUserPageQuery(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     entity.UserQuery
+		wantQuery string
+		wantArgs  []any
+	}{
+		{
+			name:      "first page",
+			query:     entity.UserQuery{Limit: 20},
+			wantQuery: `SELECT * FROM users WHERE TRUE ORDER BY id ASC LIMIT $1`,
+			wantArgs:  []any{20},
+		},
+		{
+			name:      "search",
+			query:     entity.UserQuery{Search: "Bob", Limit: 20},
+			wantQuery: `SELECT * FROM users WHERE (lower(name) LIKE $1 OR login = $2) ORDER BY id ASC LIMIT $3`,
+			wantArgs:  []any{"bob%", "Bob", 20},
+		},
+		{
+			name:      "search with wildcards",
+			query:     entity.UserQuery{Search: `50%_a\b`, Limit: 20},
+			wantQuery: `SELECT * FROM users WHERE (lower(name) LIKE $1 OR login = $2) ORDER BY id ASC LIMIT $3`,
+			wantArgs:  []any{`50\%\_a\\b%`, `50%_a\b`, 20},
+		},
+		{
+			name:      "next page by id",
+			query:     entity.UserQuery{AfterID: 7, Desc: true, Limit: 20},
+			wantQuery: `SELECT * FROM users WHERE TRUE AND id < $1 ORDER BY id DESC LIMIT $2`,
+			wantArgs:  []any{int64(7), 20},
+		},
+		{
+			name:      "next page by name with search",
+			query:     entity.UserQuery{Search: "bo", Sort: "name", AfterID: 7, AfterName: "bob", Limit: 20},
+			wantQuery: `SELECT * FROM users WHERE (lower(name) LIKE $1 OR login = $2) AND (name, id) > ($3, $4) ORDER BY name ASC, id ASC LIMIT $5`,
+			wantArgs:  []any{"bo%", "bo", "bob", int64(7), 20},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args := userPageQuery(tt.query)
+			if query != tt.wantQuery {
+				t.Errorf("got query\n%s\nwant\n%s", query, tt.wantQuery)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("got args %#v, want %#v", args, tt.wantArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package response
+
+import (
+	"encoding/json"
+	"github.com/fichca/image-loader/internal/apperr"
+	"github.com/fichca/image-loader/internal/i18n"
+	"net/http"
+)
+
+const ProblemContentType = "application/problem+json"
+
+// CodeInternal is the code of errors that are not an *apperr.Error, their text is never shown to clients.
+const CodeInternal = "internal"
+
+// Problem is an RFC 7807 problem details body. Code is a stable identifier of the error,
+// Title and Detail are localized and meant for people. Errors lists the invalid fields of the request.
+type Problem struct {
+	Type     string         `json:"type"`
+	Title    string         `json:"title"`
+	Status   int            `json:"status"`
+	Detail   string         `json:"detail,omitempty"`
+	Instance string         `json:"instance,omitempty"`
+	Code     string         `json:"code"`
+	Errors   []FieldProblem `json:"errors,omitempty"`
+}
+
+type FieldProblem struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+var kindStatuses = map[apperr.Kind]int{
+	apperr.KindValidation:           http.StatusBadRequest,
+	apperr.KindUnauthorized:         http.StatusUnauthorized,
+	apperr.KindForbidden:            http.StatusForbidden,
+	apperr.KindNotFound:             http.StatusNotFound,
+	apperr.KindConflict:             http.StatusConflict,
+	apperr.KindPreconditionFailed:   http.StatusPreconditionFailed,
+	apperr.KindTooLarge:             http.StatusRequestEntityTooLarge,
+	apperr.KindUnsupportedMediaType: http.StatusUnsupportedMediaType,
+}
+
+var statusTitles = map[int]i18n.Key{
+	http.StatusBadRequest:            i18n.StatusBadRequest,
+	http.StatusUnauthorized:          i18n.StatusUnauthorized,
+	http.StatusForbidden:             i18n.StatusForbidden,
+	http.StatusNotFound:              i18n.StatusNotFound,
+	http.StatusConflict:              i18n.StatusConflict,
+	http.StatusPreconditionFailed:    i18n.StatusPreconditionFailed,
+	http.StatusRequestEntityTooLarge: i18n.StatusTooLarge,
+	http.StatusUnsupportedMediaType:  i18n.StatusUnsupportedMediaType,
+	http.StatusInternalServerError:   i18n.StatusInternal,
+}
+
+// NewProblem describes err in the language of the request. The status and the code come from
+// the *apperr.Error in its chain, any other error is an internal one.
+func NewProblem(r *http.Request, err error) Problem {
+	lang := i18n.FromContext(r.Context())
+
+	status, code := http.StatusInternalServerError, CodeInternal
+	appErr, ok := apperr.As(err)
+	if ok {
+		status, code = kindStatuses[appErr.Kind], appErr.Code
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+	}
+
+	problem := Problem{
+		Type:     "about:blank",
+		Title:    i18n.T(lang, statusTitles[status]),
+		Status:   status,
+		Instance: r.URL.Path,
+		Code:     code,
+	}
+	if detail, ok := i18n.Lookup(lang, i18n.Key(code)); ok {
+		problem.Detail = detail
+	}
+	if appErr != nil {
+		problem.Errors = fieldProblems(lang, appErr.Fields)
+	}
+
+	return problem
+}
+
+func fieldProblems(lang i18n.Lang, fields []apperr.FieldError) []FieldProblem {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	problems := make([]FieldProblem, 0, len(fields))
+	for _, field := range fields {
+		args := make([]any, 0, 1)
+		if field.Param != "" {
+			args = append(args, field.Param)
+		}
+
+		problems = append(problems, FieldProblem{
+			Field:   field.Field,
+			Code:    field.Code,
+			Message: i18n.T(lang, i18n.FieldKey(field.Code), args...),
+		})
+	}
+	return problems
+}
+
+func WriteProblem(w http.ResponseWriter, problem Problem) error {
+	b, err := json.Marshal(&problem)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(problem.Status)
+	_, err = w.Write(b)
+	return err
+}
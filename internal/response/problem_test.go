@@ -0,0 +1,95 @@
+package response
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/fichca/image-loader/internal/apperr"
+	"github.com/fichca/image-loader/internal/i18n"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewProblemStatusAndCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"validation", apperr.New(apperr.KindValidation, "invalid_parameter", "bad"), http.StatusBadRequest, "invalid_parameter"},
+		{"unauthorized", apperr.New(apperr.KindUnauthorized, "invalid_credentials", "bad"), http.StatusUnauthorized, "invalid_credentials"},
+		{"forbidden", apperr.New(apperr.KindForbidden, "forbidden", "bad"), http.StatusForbidden, "forbidden"},
+		{"not found", apperr.New(apperr.KindNotFound, "user_not_found", "bad"), http.StatusNotFound, "user_not_found"},
+		{"conflict", apperr.New(apperr.KindConflict, "login_taken", "bad"), http.StatusConflict, "login_taken"},
+		{"precondition failed", apperr.New(apperr.KindPreconditionFailed, "version_mismatch", "bad"), http.StatusPreconditionFailed, "version_mismatch"},
+		{"too large", apperr.New(apperr.KindTooLarge, "too_large", "bad"), http.StatusRequestEntityTooLarge, "too_large"},
+		{"unsupported media type", apperr.New(apperr.KindUnsupportedMediaType, "unsupported_type", "bad"), http.StatusUnsupportedMediaType, "unsupported_type"},
+		{"wrapped", fmt.Errorf("failed to get user: %w", apperr.New(apperr.KindNotFound, "user_not_found", "bad")), http.StatusNotFound, "user_not_found"},
+		{"unknown kind", apperr.New("teapot", "teapot", "bad"), http.StatusInternalServerError, "teapot"},
+		{"plain error", errors.New("pq: connection refused"), http.StatusInternalServerError, CodeInternal},
+		{"no rows", fmt.Errorf("failed to get user: %w", sql.ErrNoRows), http.StatusInternalServerError, CodeInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problem := NewProblem(httptest.NewRequest(http.MethodGet, "/api/v1/users/1", nil), tt.err)
+
+			if problem.Status != tt.status || problem.Code != tt.code {
+				t.Errorf("got status %d and code %q, want %d and %q", problem.Status, problem.Code, tt.status, tt.code)
+			}
+			if problem.Title == "" {
+				t.Errorf("got no title for status %d", problem.Status)
+			}
+			if problem.Instance != "/api/v1/users/1" {
+				t.Errorf("got instance %q, want the request path", problem.Instance)
+			}
+		})
+	}
+}
+
+func TestNewProblemLocalized(t *testing.T) {
+	err := apperr.New(apperr.KindValidation, string(i18n.ErrInvalidLinkCode), "link code is invalid or expired")
+	err.Fields = []apperr.FieldError{{Field: "login", Code: "min_length", Param: "3"}}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/users", nil)
+	r = r.WithContext(i18n.WithLang(r.Context(), i18n.Russian))
+
+	problem := NewProblem(r, err)
+
+	if want := i18n.T(i18n.Russian, i18n.StatusBadRequest); problem.Title != want {
+		t.Errorf("got title %q, want %q", problem.Title, want)
+	}
+	if want := i18n.T(i18n.Russian, i18n.ErrInvalidLinkCode); problem.Detail != want {
+		t.Errorf("got detail %q, want %q", problem.Detail, want)
+	}
+	if len(problem.Errors) != 1 {
+		t.Fatalf("got field problems %+v, want 1", problem.Errors)
+	}
+	want := FieldProblem{Field: "login", Code: "min_length", Message: i18n.T(i18n.Russian, i18n.FieldMinLength, "3")}
+	if problem.Errors[0] != want {
+		t.Errorf("got field problem %+v, want %+v", problem.Errors[0], want)
+	}
+}
+
+func TestWriteProblemHidesInternalErrors(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/me", nil)
+	w := httptest.NewRecorder()
+
+	err := WriteProblem(w, NewProblem(r, errors.New("pq: password authentication failed")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	if got := w.Header().Get("Content-Type"); got != ProblemContentType {
+		t.Errorf("got content type %q, want %q", got, ProblemContentType)
+	}
+	if strings.Contains(w.Body.String(), "pq:") {
+		t.Errorf("the body shows the internal error: %s", w.Body)
+	}
+}
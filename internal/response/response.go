@@ -2,6 +2,8 @@ package response
 
 import "encoding/json"
 
+const JSONContentType = "application/json"
+
 type Response struct {
 	Data  any  `json:"data"`
 	Error bool `json:"error"`
@@ -2,35 +2,55 @@ package server
 
 import (
 	"context"
-	"encoding/json"
 	"github.com/fichca/image-loader/internal/dto"
 	"github.com/fichca/image-loader/internal/response"
 	"github.com/go-chi/chi"
 	"github.com/sirupsen/logrus"
 	"io"
 	"net/http"
+	"strconv"
 )
 
 type authService interface {
 	Authorize(ctx context.Context, login, password string) (string, error)
+	IssueTelegramLinkCode(ctx context.Context, userID int) (dto.TelegramLinkCode, error)
+	GetTelegramLinks(ctx context.Context, userID int) ([]dto.TelegramLink, error)
+	DeleteTelegramLink(ctx context.Context, userID int, tgID int64) error
+	DeleteTelegramLinks(ctx context.Context, userID int) error
 }
 
 type authHandler struct {
-	logger *logrus.Logger
-	r      *chi.Mux
-	as     authService
+	logger         *logrus.Logger
+	r              *chi.Mux
+	as             authService
+	authMiddleware func(next http.Handler) http.Handler
 }
 
-func NewAuthHandler(logger *logrus.Logger, as authService, r *chi.Mux) *authHandler {
+func NewAuthHandler(logger *logrus.Logger, as authService, r *chi.Mux, authMiddleware func(next http.Handler) http.Handler) *authHandler {
 	return &authHandler{
-		logger: logger,
-		r:      r,
-		as:     as,
+		logger:         logger,
+		r:              r,
+		as:             as,
+		authMiddleware: authMiddleware,
 	}
 }
 
 func (ah *authHandler) RegisterAuthRoutes() {
-	ah.r.Get("/user/auth", ah.HandleAuthorize)
+	ah.r.Post(APIPrefix+"/auth/token", ah.HandleAuthorize)
+
+	ah.r.Group(func(r chi.Router) {
+		r.Use(ah.authMiddleware)
+		r.Post(APIPrefix+"/telegram/link-codes", ah.HandleIssueTelegramLinkCode)
+		r.Get(APIPrefix+"/telegram/links", ah.HandleGetTelegramLinks)
+		r.Delete(APIPrefix+"/telegram/links", ah.HandleDeleteTelegramLinks)
+		r.Delete(APIPrefix+"/telegram/links/{telegramID}", ah.HandleDeleteTelegramLink)
+	})
+
+	ah.r.With(deprecated(APIPrefix+"/auth/token")).Get("/user/auth", ah.HandleAuthorize)
+	ah.r.With(deprecated(APIPrefix+"/telegram/link-codes"), ah.authMiddleware).Post("/user/telegram/link-code", ah.HandleIssueTelegramLinkCode)
+	ah.r.With(deprecated(APIPrefix+"/telegram/links"), ah.authMiddleware).Get("/user/telegram-links", ah.HandleGetTelegramLinks)
+	ah.r.With(deprecated(APIPrefix+"/telegram/links"), ah.authMiddleware).Delete("/user/telegram-links", ah.HandleDeleteTelegramLinks)
+	ah.r.With(deprecated(APIPrefix+"/telegram/links/{telegramID}"), ah.authMiddleware).Delete("/user/telegram-links/{telegramID}", ah.HandleDeleteTelegramLink)
 }
 
 // HandleAuthorize issues a JWT
@@ -42,16 +62,16 @@ func (ah *authHandler) RegisterAuthRoutes() {
 //	@Produce      json
 //	@Param        user    body     dto.AuthUserDto  true  "authorize user"
 //	@Success      200  {array}   response.Response
-//	@Failure      400  {object}  response.Response
-//	@Failure      404  {object}  response.Response
-//	@Failure      500  {object}  response.Response
-//	@Router       /user/auth [get]
+//	@Failure      400  {object}  response.Problem
+//	@Failure      401  {object}  response.Problem
+//	@Failure      500  {object}  response.Problem
+//	@Router       /api/v1/auth/token [post]
 func (ah *authHandler) HandleAuthorize(w http.ResponseWriter, r *http.Request) {
 	var user dto.AuthUserDto
 
-	err := json.NewDecoder(r.Body).Decode(&user)
+	err := decodeBody(r, &user)
 	if err != nil {
-		ah.handleError(err, http.StatusBadRequest, w)
+		ah.handleError(err, w, r)
 		return
 	}
 
@@ -64,28 +84,160 @@ func (ah *authHandler) HandleAuthorize(w http.ResponseWriter, r *http.Request) {
 
 	token, err := ah.as.Authorize(r.Context(), user.Login, user.Password)
 	if err != nil {
-		ah.handleError(err, http.StatusInternalServerError, w)
+		ah.handleError(err, w, r)
 		return
 	}
 
 	b, err := response.ParseResponse(token, false)
 	if err != nil {
-		ah.handleError(err, http.StatusInternalServerError, w)
+		ah.handleError(err, w, r)
 		return
 	}
 
+	w.Header().Set("Content-Type", response.JSONContentType)
 	w.WriteHeader(http.StatusOK)
 	_, err = w.Write(b)
 	if err != nil {
-		ah.handleError(err, http.StatusInternalServerError, w)
+		ah.handleError(err, w, r)
+		return
+	}
+}
+
+// HandleIssueTelegramLinkCode issues a one-time code for linking a Telegram account
+//
+//	@Summary      IssueTelegramLinkCode
+//	@Description  issue a short-lived code to send to the bot as /start <code>, or open the deep link
+//	@Tags         auth
+//	@Produce      json
+//	@Success      200  {object}  dto.TelegramLinkCode
+//	@Failure      401  {object}  response.Problem
+//	@Failure      500  {object}  response.Problem
+//	@Router       /api/v1/telegram/link-codes [post]
+func (ah *authHandler) HandleIssueTelegramLinkCode(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromCtx(r.Context())
+	if err != nil {
+		ah.handleError(err, w, r)
 		return
 	}
+
+	code, err := ah.as.IssueTelegramLinkCode(r.Context(), userID)
+	if err != nil {
+		ah.handleError(err, w, r)
+		return
+	}
+
+	b, err := response.ParseResponse(code, false)
+	if err != nil {
+		ah.handleError(err, w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", response.JSONContentType)
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(b)
+	if err != nil {
+		ah.logger.Error(err)
+	}
 }
 
-func (ah *authHandler) handleError(err error, status int, w http.ResponseWriter) {
+// HandleGetTelegramLinks lists the linked Telegram accounts
+//
+//	@Summary      GetTelegramLinks
+//	@Description  list the Telegram accounts linked to the authorized user
+//	@Tags         auth
+//	@Produce      json
+//	@Success      200  {array}   dto.TelegramLink
+//	@Failure      401  {object}  response.Problem
+//	@Failure      500  {object}  response.Problem
+//	@Router       /api/v1/telegram/links [get]
+func (ah *authHandler) HandleGetTelegramLinks(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromCtx(r.Context())
+	if err != nil {
+		ah.handleError(err, w, r)
+		return
+	}
+
+	links, err := ah.as.GetTelegramLinks(r.Context(), userID)
+	if err != nil {
+		ah.handleError(err, w, r)
+		return
+	}
+
+	b, err := response.ParseResponse(links, false)
+	if err != nil {
+		ah.handleError(err, w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", response.JSONContentType)
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(b)
+	if err != nil {
+		ah.logger.Error(err)
+	}
+}
+
+// HandleDeleteTelegramLink unlinks a Telegram account
+//
+//	@Summary      DeleteTelegramLink
+//	@Description  unlink one Telegram account of the authorized user
+//	@Tags         auth
+//	@Param        telegramID  path  int  true  "Telegram user ID"
+//	@Success      204
+//	@Failure      400  {object}  response.Problem
+//	@Failure      404  {object}  response.Problem
+//	@Failure      500  {object}  response.Problem
+//	@Router       /api/v1/telegram/links/{telegramID} [delete]
+func (ah *authHandler) HandleDeleteTelegramLink(w http.ResponseWriter, r *http.Request) {
+	tgID, err := strconv.ParseInt(chi.URLParam(r, "telegramID"), 10, 64)
+	if err != nil {
+		ah.handleError(invalidParameter(err), w, r)
+		return
+	}
+
+	userID, err := userIDFromCtx(r.Context())
+	if err != nil {
+		ah.handleError(err, w, r)
+		return
+	}
+
+	err = ah.as.DeleteTelegramLink(r.Context(), userID, tgID)
+	if err != nil {
+		ah.handleError(err, w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleDeleteTelegramLinks unlinks every Telegram account
+//
+//	@Summary      DeleteTelegramLinks
+//	@Description  unlink all Telegram accounts of the authorized user
+//	@Tags         auth
+//	@Success      204
+//	@Failure      500  {object}  response.Problem
+//	@Router       /api/v1/telegram/links [delete]
+func (ah *authHandler) HandleDeleteTelegramLinks(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromCtx(r.Context())
+	if err != nil {
+		ah.handleError(err, w, r)
+		return
+	}
+
+	err = ah.as.DeleteTelegramLinks(r.Context(), userID)
+	if err != nil {
+		ah.handleError(err, w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (ah *authHandler) handleError(err error, w http.ResponseWriter, r *http.Request) {
 	ah.logger.Error(err)
-	w.WriteHeader(status)
-	_, err = w.Write([]byte(err.Error()))
+
+	err = response.WriteProblem(w, response.NewProblem(r, err))
 	if err != nil {
 		ah.logger.Error(err)
 	}
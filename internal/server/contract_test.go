@@ -0,0 +1,408 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/fichca/image-loader/internal/constants"
+	"github.com/fichca/image-loader/internal/dto"
+	"github.com/fichca/image-loader/internal/mergepatch"
+	"github.com/fichca/image-loader/internal/openapi/openapitest"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The fakes answer every call with a fixed, fully populated value, so every documented field
+// of the responses is checked against the spec.
+
+var testTime = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+type fakeUserService struct{}
+
+func (fakeUserService) Add(ctx context.Context, user dto.UserDto) error {
+	return nil
+}
+
+func (fakeUserService) GetById(ctx context.Context, id int) (dto.UserResponse, error) {
+	return dto.UserResponse{ID: int64(id), Name: "John", Login: "john", Description: "about", ImageUrls: []string{"http://minio/1.png"}}, nil
+}
+
+func (fakeUserService) GetPublicById(ctx context.Context, id int) (dto.PublicUser, error) {
+	return dto.PublicUser{ID: int64(id), Name: "Jane", Description: "about"}, nil
+}
+
+func (fakeUserService) GetMe(ctx context.Context, userID int) (dto.Me, error) {
+	return dto.Me{
+		ID:          int64(userID),
+		Name:        "John",
+		Login:       "john",
+		Description: "about",
+		Images:      dto.ImageSummary{Count: 2, TotalSize: 2048, LastAddedAt: &testTime},
+	}, nil
+}
+
+func (fakeUserService) Update(ctx context.Context, userID int, user dto.UserUpdate) error {
+	return nil
+}
+
+func (fakeUserService) Patch(ctx context.Context, userID, id int, patch []byte) error {
+	return nil
+}
+
+func (fakeUserService) ChangePassword(ctx context.Context, userID, id int, change dto.PasswordChange) error {
+	return nil
+}
+
+func (fakeUserService) DeleteById(ctx context.Context, userID, id int) error {
+	return nil
+}
+
+func (fakeUserService) GetPage(ctx context.Context, query dto.UserQuery) (dto.UserPage, error) {
+	total := 3
+	return dto.UserPage{
+		Users:      []dto.PublicUser{{ID: 1, Name: "Jane", Description: "about"}, {ID: 2, Name: "John"}},
+		NextCursor: "next",
+		Total:      &total,
+	}, nil
+}
+
+type fakeFileService struct{}
+
+func (fakeFileService) AddImages(ctx context.Context, userID int, files []dto.ImageFile) []dto.ImageResult {
+	results := make([]dto.ImageResult, 0, len(files))
+	for i, file := range files {
+		results = append(results, dto.ImageResult{Name: file.Name, ID: i + 1})
+	}
+	return results
+}
+
+func (fakeFileService) ReserveUpload(ctx context.Context, upload dto.DirectUpload) (dto.PresignedUpload, error) {
+	return dto.PresignedUpload{
+		ImageID:   1,
+		URL:       "http://minio/images",
+		Fields:    map[string]string{"key": "1.png", "policy": "policy"},
+		ExpiresAt: testTime,
+	}, nil
+}
+
+func (fakeFileService) CompleteUpload(ctx context.Context, userID, imageID int) (dto.ImageInfo, error) {
+	return dto.ImageInfo{ID: imageID, Name: "1.png", ContentType: "image/png", Size: 1024}, nil
+}
+
+func (fakeFileService) WriteArchive(ctx context.Context, userID int, filter dto.ArchiveFilter, w io.Writer) error {
+	_, err := w.Write([]byte("PK\x05\x06" + strings.Repeat("\x00", 18)))
+	return err
+}
+
+func (fakeFileService) MaxSize() int64 {
+	return 0
+}
+
+type fakeUploadService struct{}
+
+func (fakeUploadService) MaxSize() int64 {
+	return 1 << 20
+}
+
+func (fakeUploadService) CreateUpload(ctx context.Context, upload dto.Upload) (dto.Upload, error) {
+	upload.ID = "abc"
+	return upload, nil
+}
+
+func (fakeUploadService) GetUpload(ctx context.Context, userID int, id string) (dto.Upload, error) {
+	return dto.Upload{ID: id, UserID: userID, Length: 10, Offset: 5}, nil
+}
+
+func (fakeUploadService) WriteChunk(ctx context.Context, userID int, id string, offset int64, data io.Reader) (int64, error) {
+	n, err := io.Copy(io.Discard, data)
+	return offset + n, err
+}
+
+func (fakeUploadService) Terminate(ctx context.Context, userID int, id string) error {
+	return nil
+}
+
+type fakeImportService struct{}
+
+func (fakeImportService) CreateJob(ctx context.Context, userID int, urls []string) (dto.ImportJob, error) {
+	job := dto.ImportJob{ID: 1, Status: "pending", CreatedAt: testTime, UpdatedAt: testTime}
+	for _, url := range urls {
+		job.Items = append(job.Items, dto.ImportItem{URL: url, Status: "pending"})
+	}
+	return job, nil
+}
+
+func (fakeImportService) GetJob(ctx context.Context, userID, id int) (dto.ImportJob, error) {
+	return dto.ImportJob{
+		ID:     id,
+		Status: "done",
+		Items: []dto.ImportItem{
+			{URL: "http://example.com/1.png", Status: "done", ImageID: 1},
+			{URL: "http://example.com/2.png", Status: "failed", Error: "not an image"},
+		},
+		CreatedAt: testTime,
+		UpdatedAt: testTime,
+	}, nil
+}
+
+type fakeNotificationService struct{}
+
+func (fakeNotificationService) GetSettings(ctx context.Context, userID int) (dto.NotificationSettings, error) {
+	return dto.NotificationSettings{ImageUploaded: true, ProfileUpdated: true}, nil
+}
+
+func (fakeNotificationService) UpdateSettings(ctx context.Context, userID int, settings dto.NotificationSettings) error {
+	return nil
+}
+
+type fakeAuthService struct{}
+
+func (fakeAuthService) Authorize(ctx context.Context, login, password string) (string, error) {
+	return "token", nil
+}
+
+func (fakeAuthService) IssueTelegramLinkCode(ctx context.Context, userID int) (dto.TelegramLinkCode, error) {
+	return dto.TelegramLinkCode{Code: "code", DeepLink: "https://t.me/bot?start=code", ExpiresAt: testTime}, nil
+}
+
+func (fakeAuthService) GetTelegramLinks(ctx context.Context, userID int) ([]dto.TelegramLink, error) {
+	return []dto.TelegramLink{
+		{TelegramID: 42, LinkedAt: testTime, LastActiveAt: &testTime},
+		{TelegramID: 43, LinkedAt: testTime},
+	}, nil
+}
+
+func (fakeAuthService) DeleteTelegramLink(ctx context.Context, userID int, tgID int64) error {
+	return nil
+}
+
+func (fakeAuthService) DeleteTelegramLinks(ctx context.Context, userID int) error {
+	return nil
+}
+
+// allowAuth authorizes every request as the user 1.
+func allowAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), constants.IdCtxKey, 1)))
+	})
+}
+
+func newContractRouter() http.Handler {
+	return newTestRouter(allowAuth, testServices{
+		users:         fakeUserService{},
+		files:         fakeFileService{},
+		uploads:       fakeUploadService{},
+		imports:       fakeImportService{},
+		notifications: fakeNotificationService{},
+		auth:          fakeAuthService{},
+	})
+}
+
+type contractCase struct {
+	name    string
+	method  string
+	pattern string
+	path    string
+	header  map[string]string
+	body    []byte
+	status  int
+}
+
+func jsonBody(v any) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func multipartBody() ([]byte, string) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for _, name := range []string{"a.png", "b.png"} {
+		part, err := mw.CreateFormFile("fileKey", name)
+		if err != nil {
+			panic(err)
+		}
+		_, err = part.Write([]byte("\x89PNG\r\n\x1a\n"))
+		if err != nil {
+			panic(err)
+		}
+	}
+	err := mw.Close()
+	if err != nil {
+		panic(err)
+	}
+	return buf.Bytes(), mw.FormDataContentType()
+}
+
+// contractCases is a successful request to every operation of the spec.
+func contractCases() []contractCase {
+	jsonType := map[string]string{"Content-Type": "application/json"}
+	tus := map[string]string{"Tus-Resumable": tusVersion}
+	form, formType := multipartBody()
+
+	return []contractCase{
+		{"add user", http.MethodPost, "/api/v1/users", "/api/v1/users", jsonType,
+			jsonBody(map[string]any{"name": "John", "login": "john", "password": "password1", "description": "about"}), http.StatusOK},
+		{"list users", http.MethodGet, "/api/v1/users", "/api/v1/users?search=jo&sort=-name&limit=2&count=true", nil, nil, http.StatusOK},
+		{"get me", http.MethodGet, "/api/v1/me", "/api/v1/me", nil, nil, http.StatusOK},
+		{"get own user", http.MethodGet, "/api/v1/users/{userID}", "/api/v1/users/1", nil, nil, http.StatusOK},
+		{"get other user", http.MethodGet, "/api/v1/users/{userID}", "/api/v1/users/2", nil, nil, http.StatusOK},
+		{"update user", http.MethodPut, "/api/v1/users/{userID}", "/api/v1/users/1", jsonType,
+			jsonBody(map[string]any{"id": 1, "name": "John", "login": "john", "description": "about"}), http.StatusOK},
+		{"patch user", http.MethodPatch, "/api/v1/users/{userID}", "/api/v1/users/1", map[string]string{"Content-Type": mergepatch.ContentType},
+			jsonBody(map[string]any{"name": "Johnny", "description": nil}), http.StatusOK},
+		{"delete user", http.MethodDelete, "/api/v1/users/{userID}", "/api/v1/users/1", nil, nil, http.StatusOK},
+		{"change password", http.MethodPost, "/api/v1/users/{userID}/password", "/api/v1/users/1/password", jsonType,
+			jsonBody(map[string]any{"currentPassword": "password1", "newPassword": "password2"}), http.StatusNoContent},
+		{"authorize", http.MethodPost, "/api/v1/auth/token", "/api/v1/auth/token", jsonType,
+			jsonBody(map[string]any{"login": "john", "password": "password1"}), http.StatusOK},
+		{"issue link code", http.MethodPost, "/api/v1/telegram/link-codes", "/api/v1/telegram/link-codes", nil, nil, http.StatusOK},
+		{"get links", http.MethodGet, "/api/v1/telegram/links", "/api/v1/telegram/links", nil, nil, http.StatusOK},
+		{"delete links", http.MethodDelete, "/api/v1/telegram/links", "/api/v1/telegram/links", nil, nil, http.StatusNoContent},
+		{"delete link", http.MethodDelete, "/api/v1/telegram/links/{telegramID}", "/api/v1/telegram/links/42", nil, nil, http.StatusNoContent},
+		{"get notifications", http.MethodGet, "/api/v1/notification-settings", "/api/v1/notification-settings", nil, nil, http.StatusOK},
+		{"update notifications", http.MethodPut, "/api/v1/notification-settings", "/api/v1/notification-settings", jsonType,
+			jsonBody(map[string]any{"imageUploaded": true, "imageDeleted": false, "profileUpdated": true}), http.StatusOK},
+		{"add images", http.MethodPost, "/api/v1/images", "/api/v1/images", map[string]string{"Content-Type": formType}, form, http.StatusOK},
+		{"create upload url", http.MethodPost, "/api/v1/images/upload-urls", "/api/v1/images/upload-urls", jsonType,
+			jsonBody(map[string]any{"fileName": "1.png", "contentType": "image/png", "size": 1024}), http.StatusCreated},
+		{"complete upload", http.MethodPost, "/api/v1/images/{imageID}/complete", "/api/v1/images/1/complete", nil, nil, http.StatusOK},
+		{"download archive", http.MethodGet, "/api/v1/images/archive", "/api/v1/images/archive?from=2024-01-01T00:00:00Z", nil, nil, http.StatusOK},
+		{"create import", http.MethodPost, "/api/v1/imports", "/api/v1/imports", jsonType,
+			jsonBody(map[string]any{"urls": []string{"http://example.com/1.png"}}), http.StatusAccepted},
+		{"get import", http.MethodGet, "/api/v1/imports/{jobID}", "/api/v1/imports/1", nil, nil, http.StatusOK},
+		{"upload options", http.MethodOptions, "/api/v1/uploads", "/api/v1/uploads", nil, nil, http.StatusNoContent},
+		{"upload item options", http.MethodOptions, "/api/v1/uploads/{uploadID}", "/api/v1/uploads/abc", nil, nil, http.StatusNoContent},
+		{"create upload", http.MethodPost, "/api/v1/uploads", "/api/v1/uploads",
+			map[string]string{"Tus-Resumable": tusVersion, "Upload-Length": "10", "Upload-Metadata": "filename MS5wbmc="}, nil, http.StatusCreated},
+		{"get upload offset", http.MethodHead, "/api/v1/uploads/{uploadID}", "/api/v1/uploads/abc", tus, nil, http.StatusOK},
+		{"write chunk", http.MethodPatch, "/api/v1/uploads/{uploadID}", "/api/v1/uploads/abc",
+			map[string]string{"Tus-Resumable": tusVersion, "Upload-Offset": "5", "Content-Type": tusChunkType}, []byte("12345"), http.StatusNoContent},
+		{"terminate upload", http.MethodDelete, "/api/v1/uploads/{uploadID}", "/api/v1/uploads/abc", tus, nil, http.StatusNoContent},
+	}
+}
+
+// check sends the request of c to r, after checking it is a request the spec documents when
+// valid is set, and checks the status and the response against the spec.
+func (c contractCase) check(t *testing.T, r http.Handler, valid bool) {
+	t.Helper()
+
+	req := httptest.NewRequest(c.method, c.path, bytes.NewReader(c.body))
+	for key, value := range c.header {
+		req.Header.Set(key, value)
+	}
+
+	err := openapitest.ValidateRequest(req, c.pattern, c.body)
+	if valid && err != nil {
+		t.Fatalf("the request does not match the spec: %v", err)
+	}
+	if !valid && err == nil {
+		t.Fatal("the request matches the spec, want an invalid one")
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != c.status {
+		t.Fatalf("got status %d, want %d: %s", w.Code, c.status, w.Body)
+	}
+
+	err = openapitest.ValidateResponse(c.method, c.pattern, w.Code, w.Header(), w.Body.Bytes())
+	if err != nil {
+		t.Errorf("the response does not match the spec: %v", err)
+	}
+}
+
+func TestContract(t *testing.T) {
+	r := newContractRouter()
+
+	for _, c := range contractCases() {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			c.check(t, r, true)
+		})
+	}
+}
+
+func TestContractCoversSpec(t *testing.T) {
+	covered := make(map[string]bool)
+	for _, c := range contractCases() {
+		covered[c.method+" "+c.pattern] = true
+	}
+
+	for _, operation := range openapitest.Operations() {
+		if !covered[operation] {
+			t.Errorf("%s has no contract case", operation)
+		}
+	}
+}
+
+// TestContractMissingProperties drops each property of the JSON bodies in turn: the handler must
+// answer 400 exactly when the spec says the property is required.
+func TestContractMissingProperties(t *testing.T) {
+	r := newContractRouter()
+
+	for _, c := range contractCases() {
+		var body map[string]any
+		if c.header["Content-Type"] == "" || json.Unmarshal(c.body, &body) != nil {
+			continue
+		}
+
+		for property := range body {
+			partial := make(map[string]any, len(body)-1)
+			for key, value := range body {
+				if key != property {
+					partial[key] = value
+				}
+			}
+
+			missing := c
+			missing.body = jsonBody(partial)
+
+			req := httptest.NewRequest(c.method, c.path, nil)
+			req.Header.Set("Content-Type", c.header["Content-Type"])
+			required := openapitest.ValidateRequest(req, c.pattern, missing.body) != nil
+			if required {
+				missing.status = http.StatusBadRequest
+			}
+
+			t.Run(c.name+" without "+property, func(t *testing.T) {
+				missing.check(t, r, !required)
+			})
+		}
+	}
+}
+
+// TestContractInvalidPathParameters sends a path parameter the spec types as an integer as text.
+func TestContractInvalidPathParameters(t *testing.T) {
+	r := newContractRouter()
+
+	for _, c := range contractCases() {
+		operation, err := openapitest.Lookup(c.method, c.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, param := range operation.Parameters {
+			if param.In != "path" || param.Schema.Type != "integer" {
+				continue
+			}
+
+			invalid := c
+			invalid.path = strings.Replace(c.pattern, "{"+param.Name+"}", "abc", 1)
+			invalid.path = routeParam.ReplaceAllString(invalid.path, "1")
+			invalid.status = http.StatusBadRequest
+
+			t.Run(c.name+" with text "+param.Name, func(t *testing.T) {
+				invalid.check(t, r, false)
+			})
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"github.com/fichca/image-loader/internal/openapi"
+	"github.com/fichca/image-loader/internal/response"
+	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+type docsHandler struct {
+	logger    *logrus.Logger
+	r         *chi.Mux
+	serverURL string
+}
+
+// NewDocsHandler serves the API description, baseURL is where clients reach the API. Without it
+// the spec has the relative server "/", the server is never taken from the request.
+func NewDocsHandler(logger *logrus.Logger, r *chi.Mux, baseURL string) *docsHandler {
+	serverURL := strings.TrimSuffix(baseURL, "/")
+	if serverURL == "" {
+		serverURL = "/"
+	}
+
+	return &docsHandler{
+		logger:    logger,
+		r:         r,
+		serverURL: serverURL,
+	}
+}
+
+func (dh *docsHandler) RegisterDocsRoutes() {
+	dh.r.Get("/openapi.json", dh.HandleGetSpec)
+	dh.r.Get("/docs", http.RedirectHandler("/docs/", http.StatusMovedPermanently).ServeHTTP)
+	dh.r.Handle("/docs/*", http.StripPrefix("/docs/", http.FileServer(http.FS(openapi.UI()))))
+}
+
+// HandleGetSpec returns the OpenAPI document of the API
+func (dh *docsHandler) HandleGetSpec(w http.ResponseWriter, r *http.Request) {
+	b, err := openapi.SpecFor(dh.serverURL)
+	if err != nil {
+		dh.handleError(err, w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", response.JSONContentType)
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(b)
+	if err != nil {
+		dh.logger.Error(err)
+	}
+}
+
+func (dh *docsHandler) handleError(err error, w http.ResponseWriter, r *http.Request) {
+	dh.logger.Error(err)
+
+	err = response.WriteProblem(w, response.NewProblem(r, err))
+	if err != nil {
+		dh.logger.Error(err)
+	}
+}
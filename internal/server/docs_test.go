@@ -0,0 +1,78 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newDocsRouter(baseURL string) *chi.Mux {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	r := chi.NewRouter()
+	NewDocsHandler(logger, r, baseURL).RegisterDocsRoutes()
+	return r
+}
+
+func TestSpecServerFromBaseURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseURL string
+		want    string
+	}{
+		{"base url", "https://images.example.com", "https://images.example.com"},
+		{"trailing slash", "https://images.example.com/", "https://images.example.com"},
+		{"no base url", "", "/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://internal:8080/openapi.json", nil)
+			req.Header.Set("X-Forwarded-Proto", "javascript")
+			req.Header.Set("X-Forwarded-Host", "evil.example.com")
+			rec := httptest.NewRecorder()
+
+			newDocsRouter(tt.baseURL).ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d", rec.Code, http.StatusOK)
+			}
+			var spec struct {
+				Servers []struct {
+					URL string `json:"url"`
+				} `json:"servers"`
+			}
+			err := json.Unmarshal(rec.Body.Bytes(), &spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(spec.Servers) != 1 || spec.Servers[0].URL != tt.want {
+				t.Errorf("got servers %+v, want only %q", spec.Servers, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocsServeSwaggerUI(t *testing.T) {
+	r := newDocsRouter("")
+
+	for _, path := range []string{"/docs/", "/docs/swagger-ui-bundle.js", "/docs/swagger-initializer.js"} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("got status %d for %s, want %d", rec.Code, path, http.StatusOK)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs/swagger-initializer.js", nil))
+	if !strings.Contains(rec.Body.String(), `url: "../openapi.json"`) {
+		t.Error("Swagger UI does not load the spec served next to it")
+	}
+}
@@ -1,34 +1,68 @@
 package server
 
 import (
+	"archive/zip"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/fichca/image-loader/internal/constants"
 	"github.com/fichca/image-loader/internal/dto"
 	"github.com/fichca/image-loader/internal/response"
 	"github.com/go-chi/chi"
 	"github.com/sirupsen/logrus"
+	"io"
 	"mime/multipart"
 	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type fileService interface {
-	AddImage(ctx context.Context, image dto.Image) error
+	AddImages(ctx context.Context, userID int, files []dto.ImageFile) []dto.ImageResult
+	ReserveUpload(ctx context.Context, upload dto.DirectUpload) (dto.PresignedUpload, error)
+	CompleteUpload(ctx context.Context, userID, imageID int) (dto.ImageInfo, error)
+	WriteArchive(ctx context.Context, userID int, filter dto.ArchiveFilter, w io.Writer) error
+	MaxSize() int64
 }
 
+// maxFormMemory is how much of a multipart form is kept in memory, the rest goes to temporary files.
+const maxFormMemory = 32 << 20
+
+// maxArchiveEntries and maxArchiveSize bound the files of one uploaded zip and their uncompressed size,
+// the zip reader fails on entries that hold more than their header says.
+const (
+	maxArchiveEntries = 1000
+	maxArchiveSize    = 1 << 30
+)
+
+// maxFormOverhead is allowed on top of the files of a request for the headers and boundaries of its parts.
+const maxFormOverhead = 1 << 20
+
 type fileHandler struct {
 	logger         *logrus.Logger
 	r              *chi.Mux
 	fs             fileService
 	authMiddleware func(next http.Handler) http.Handler
+	// maxBodySize bounds an upload request before it is spooled to disk, it may carry one image
+	// of the largest size or one archive of the largest size.
+	maxBodySize int64
 }
 
 func NewFileHandler(logger *logrus.Logger, fs fileService, r *chi.Mux, authMiddleware func(next http.Handler) http.Handler) *fileHandler {
+	maxBodySize := fs.MaxSize()
+	if maxBodySize < maxArchiveSize {
+		maxBodySize = maxArchiveSize
+	}
+
 	return &fileHandler{
 		logger:         logger,
 		r:              r,
 		fs:             fs,
 		authMiddleware: authMiddleware,
+		maxBodySize:    maxBodySize + maxFormOverhead,
 	}
 }
 
@@ -36,70 +70,340 @@ func (fh *fileHandler) RegisterFileRoutes() {
 
 	fh.r.Group(func(r chi.Router) {
 		r.Use(fh.authMiddleware)
-		r.Post("/image/add", fh.HandleAddFile)
+		r.Post(APIPrefix+"/images", fh.HandleAddFile)
+		r.Post(APIPrefix+"/images/upload-urls", fh.HandleCreateUploadURL)
+		r.Post(APIPrefix+"/images/{imageID}/complete", fh.HandleCompleteUpload)
+		r.Get(APIPrefix+"/images/archive", fh.HandleDownloadArchive)
 	})
+
+	fh.r.With(deprecated(APIPrefix+"/images"), fh.authMiddleware).Post("/image/add", fh.HandleAddFile)
+	fh.r.With(deprecated(APIPrefix+"/images/upload-urls"), fh.authMiddleware).Post("/image/upload-url", fh.HandleCreateUploadURL)
+	fh.r.With(deprecated(APIPrefix+"/images/{imageID}/complete"), fh.authMiddleware).Post("/image/{imageID}/complete", fh.HandleCompleteUpload)
+	fh.r.With(deprecated(APIPrefix+"/images/archive"), fh.authMiddleware).Get("/image/archive", fh.HandleDownloadArchive)
 }
 
-// HandleAddFile add image to minio
+// HandleAddFile add images to minio
 //
 //	@Summary        AddFile
-//	@Description    add image to minio
+//	@Description    add images to minio, every file field of the form is stored and files sent as "archive" are unpacked as zip
 //	@Tags           image
-//	@Accept         json
+//	@Accept         mpfd
 //	@Produce        json
-//	@Param          fileKey     formData        file    true    "upload images"
-//	@Success        200        {array}     response.Response
-//	@Failure        400        {object}    response.Response
-//	@Failure        404        {object}    response.Response
-//	@Failure        500        {object}    response.Response
-//	@Router            /image/add [post]
+//	@Param          fileKey     formData        file    false    "upload images"
+//	@Param          archive     formData        file    false    "zip archive with images"
+//	@Success        200        {array}     dto.ImageResult
+//	@Failure        400        {object}    response.Problem
+//	@Failure        404        {object}    response.Problem
+//	@Failure        413        {object}    response.Problem
+//	@Failure        415        {object}    response.Problem
+//	@Failure        500        {object}    response.Problem
+//	@Router            /api/v1/images [post]
 func (fh *fileHandler) HandleAddFile(w http.ResponseWriter, r *http.Request) {
-	file, header, err := r.FormFile("fileKey")
+	r.Body = http.MaxBytesReader(w, r.Body, fh.maxBodySize)
+
+	err := r.ParseMultipartForm(maxFormMemory)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		fh.handleError(errBodyTooLarge, w, r)
+		return
+	}
 	if err != nil {
-		fh.handleError(err, http.StatusBadRequest, w)
+		fh.handleError(invalidBody(err), w, r)
+		return
 	}
 
-	defer func(file multipart.File) {
-		err := file.Close()
+	defer func(form *multipart.Form) {
+		err := form.RemoveAll()
 		if err != nil {
-			fh.handleError(err, http.StatusBadRequest, w)
+			fh.logger.Error(err)
 		}
-	}(file)
+	}(r.MultipartForm)
+
+	files, archives, err := formImageFiles(r.MultipartForm)
+	defer func() {
+		for _, archive := range archives {
+			err := archive.Close()
+			if err != nil {
+				fh.logger.Error(err)
+			}
+		}
+	}()
+	if errors.Is(err, errArchiveTooLarge) {
+		fh.handleError(errArchiveTooLarge, w, r)
+		return
+	}
+	if err != nil {
+		fh.handleError(invalidBody(err), w, r)
+		return
+	}
+	if len(files) == 0 {
+		fh.handleError(errNoFiles, w, r)
+		return
+	}
+
 	userID, err := userIDFromCtx(r.Context())
 	if err != nil {
-		fh.handleError(err, http.StatusInternalServerError, w)
+		fh.handleError(err, w, r)
 		return
 	}
 
-	err = fh.fs.AddImage(r.Context(), dto.Image{
-		UserID:    userID,
-		Name:      header.Filename,
-		Data:      file,
-		Extension: ".jpg",
-	})
+	results := fh.fs.AddImages(r.Context(), userID, files)
+
+	fh.writeResponse(results, http.StatusOK, w, r)
+}
+
+// HandleCreateUploadURL reserves an image and presigns a direct upload to minio
+//
+//	@Summary        CreateUploadURL
+//	@Description    reserve an image and get a presigned POST policy to upload it directly to minio
+//	@Tags           image
+//	@Accept         json
+//	@Produce        json
+//	@Param          upload    body        dto.DirectUpload    true    "file to upload"
+//	@Success        201       {object}    dto.PresignedUpload
+//	@Failure        400       {object}    response.Problem
+//	@Failure        413       {object}    response.Problem
+//	@Failure        415       {object}    response.Problem
+//	@Failure        500       {object}    response.Problem
+//	@Router         /api/v1/images/upload-urls [post]
+func (fh *fileHandler) HandleCreateUploadURL(w http.ResponseWriter, r *http.Request) {
+	var upload dto.DirectUpload
+
+	err := decodeBody(r, &upload)
+	if err != nil {
+		fh.handleError(err, w, r)
+		return
+	}
+
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			fh.logger.Error(err)
+		}
+	}(r.Body)
 
+	upload.UserID, err = userIDFromCtx(r.Context())
 	if err != nil {
-		fh.handleError(err, http.StatusInternalServerError, w)
+		fh.handleError(err, w, r)
+		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	presigned, err := fh.fs.ReserveUpload(r.Context(), upload)
+	if err != nil {
+		fh.handleError(err, w, r)
+		return
+	}
+
+	fh.writeResponse(presigned, http.StatusCreated, w, r)
 }
 
-func (fh *fileHandler) handleError(err error, status int, w http.ResponseWriter) {
-	fh.logger.Error(err)
-	w.WriteHeader(status)
+// HandleCompleteUpload finalizes a directly uploaded image
+//
+//	@Summary        CompleteUpload
+//	@Description    verify the directly uploaded object and finalize image metadata
+//	@Tags           image
+//	@Produce        json
+//	@Param          imageID    path        int    true    "image ID"
+//	@Success        200        {object}    dto.ImageInfo
+//	@Failure        400        {object}    response.Problem
+//	@Failure        404        {object}    response.Problem
+//	@Failure        409        {object}    response.Problem
+//	@Failure        415        {object}    response.Problem
+//	@Failure        500        {object}    response.Problem
+//	@Router         /api/v1/images/{imageID}/complete [post]
+func (fh *fileHandler) HandleCompleteUpload(w http.ResponseWriter, r *http.Request) {
+	imageID, err := strconv.Atoi(chi.URLParam(r, "imageID"))
+	if err != nil {
+		fh.handleError(invalidParameter(err), w, r)
+		return
+	}
+
+	userID, err := userIDFromCtx(r.Context())
+	if err != nil {
+		fh.handleError(err, w, r)
+		return
+	}
+
+	info, err := fh.fs.CompleteUpload(r.Context(), userID, imageID)
+	if err != nil {
+		fh.handleError(err, w, r)
+		return
+	}
+
+	fh.writeResponse(info, http.StatusOK, w, r)
+}
 
-	b, err := response.ParseResponse(err.Error(), true)
+// HandleDownloadArchive streams the user's images as a zip
+//
+//	@Summary        DownloadArchive
+//	@Description    download images as a zip with a manifest.json, dates are RFC 3339 or YYYY-MM-DD
+//	@Tags           image
+//	@Produce        application/zip
+//	@Param          from    query       string    false    "created at or after"
+//	@Param          to      query       string    false    "created before, or on or before a date given as YYYY-MM-DD"
+//	@Param          tag     query       string    false    "only images with this tag, a leading # is ignored"
+//	@Success        200     {file}      file
+//	@Failure        400     {object}    response.Problem
+//	@Failure        500     {object}    response.Problem
+//	@Router         /api/v1/images/archive [get]
+func (fh *fileHandler) HandleDownloadArchive(w http.ResponseWriter, r *http.Request) {
+	var filter dto.ArchiveFilter
+	var err error
+
+	filter.From, _, err = parseDateParam(r.URL.Query().Get("from"))
+	if err != nil {
+		fh.handleError(invalidParameter(err), w, r)
+		return
+	}
+
+	to, dateOnly, err := parseDateParam(r.URL.Query().Get("to"))
+	if err != nil {
+		fh.handleError(invalidParameter(err), w, r)
+		return
+	}
+	// a date given without a time includes the whole day
+	if dateOnly {
+		to = to.AddDate(0, 0, 1)
+	}
+	filter.To = to
+	filter.Tag = r.URL.Query().Get("tag")
+
+	userID, err := userIDFromCtx(r.Context())
+	if err != nil {
+		fh.handleError(err, w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="images.zip"`)
+	w.WriteHeader(http.StatusOK)
+
+	// the status is already sent, a failure can only cut the archive short
+	err = fh.fs.WriteArchive(r.Context(), userID, filter, w)
 	if err != nil {
 		fh.logger.Error(err)
 	}
+}
+
+func (fh *fileHandler) writeResponse(data any, status int, w http.ResponseWriter, r *http.Request) {
+	b, err := response.ParseResponse(data, false)
+	if err != nil {
+		fh.handleError(err, w, r)
+		return
+	}
 
+	w.Header().Set("Content-Type", response.JSONContentType)
+	w.WriteHeader(status)
 	_, err = w.Write(b)
 	if err != nil {
 		fh.logger.Error(err)
 	}
 }
 
+func (fh *fileHandler) handleError(err error, w http.ResponseWriter, r *http.Request) {
+	fh.logger.Error(err)
+
+	err = response.WriteProblem(w, response.NewProblem(r, err))
+	if err != nil {
+		fh.logger.Error(err)
+	}
+}
+
+// formImageFiles collects the files of every form field in a stable order,
+// the files of the "archive" field are replaced by the entries of the zip.
+// The opened archives must be closed once the files are processed.
+func formImageFiles(form *multipart.Form) ([]dto.ImageFile, []io.Closer, error) {
+	fields := make([]string, 0, len(form.File))
+	for field := range form.File {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	files := make([]dto.ImageFile, 0)
+	archives := make([]io.Closer, 0)
+	for _, field := range fields {
+		for _, header := range form.File[field] {
+			if field == "archive" {
+				archive, err := header.Open()
+				if err != nil {
+					return nil, archives, err
+				}
+				archives = append(archives, archive)
+
+				entries, err := zipImageFiles(archive, header.Size)
+				if err != nil {
+					return nil, archives, fmt.Errorf("failed to read archive %s: %w", header.Filename, err)
+				}
+				files = append(files, entries...)
+				continue
+			}
+
+			header := header
+			files = append(files, dto.ImageFile{
+				Name: header.Filename,
+				Size: header.Size,
+				Open: func() (io.ReadCloser, error) {
+					return header.Open()
+				},
+			})
+		}
+	}
+
+	return files, archives, nil
+}
+
+func zipImageFiles(archive io.ReaderAt, size int64) ([]dto.ImageFile, error) {
+	reader, err := zip.NewReader(archive, size)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(reader.File) > maxArchiveEntries {
+		return nil, errArchiveTooLarge
+	}
+
+	files := make([]dto.ImageFile, 0, len(reader.File))
+	var total uint64
+	for _, entry := range reader.File {
+		name := path.Base(entry.Name)
+		if entry.FileInfo().IsDir() || strings.HasPrefix(entry.Name, "__MACOSX/") || strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		total += entry.UncompressedSize64
+		if total > maxArchiveSize {
+			return nil, errArchiveTooLarge
+		}
+
+		entry := entry
+		files = append(files, dto.ImageFile{
+			Name: name,
+			Size: int64(entry.UncompressedSize64),
+			Open: entry.Open,
+		})
+	}
+
+	return files, nil
+}
+
+// parseDateParam parses an RFC 3339 time or a YYYY-MM-DD date, reporting which one it was.
+func parseDateParam(value string) (time.Time, bool, error) {
+	if value == "" {
+		return time.Time{}, false, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, false, nil
+	}
+
+	t, err = time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid date %q", value)
+	}
+	return t, true, nil
+}
+
 func userIDFromCtx(ctx context.Context) (int, error) {
 	idAny := ctx.Value(constants.IdCtxKey)
 
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/fichca/image-loader/internal/dto"
+	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// zipOf zips an entry with one byte of data for every name, names ending in / are directories.
+func zipOf(t *testing.T, names ...string) *bytes.Reader {
+	t.Helper()
+
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for _, name := range names {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name[len(name)-1] == '/' {
+			continue
+		}
+		_, err = w.Write([]byte{0})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := zw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bytes.NewReader(b.Bytes())
+}
+
+func TestZipImageFilesSkipsNonImages(t *testing.T) {
+	archive := zipOf(t, "a.png", "photos/", "photos/b.jpg", "__MACOSX/photos/._b.jpg", ".DS_Store", "photos/.hidden.png")
+
+	files, err := zipImageFiles(archive, archive.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"a.png", "b.jpg"}
+	if len(files) != len(want) {
+		t.Fatalf("got %d files, want %v", len(files), want)
+	}
+	for i, file := range files {
+		if file.Name != want[i] || file.Size != 1 {
+			t.Errorf("got file %q of %d bytes, want %q of 1 byte", file.Name, file.Size, want[i])
+		}
+	}
+}
+
+// testArchive zips entries, each entry claims size uncompressed bytes whatever its data is.
+func testArchive(t *testing.T, entries int, size uint64) *bytes.Reader {
+	t.Helper()
+
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for i := 0; i < entries; i++ {
+		w, err := zw.CreateRaw(&zip.FileHeader{
+			Name:               fmt.Sprintf("%d.png", i),
+			Method:             zip.Store,
+			UncompressedSize64: size,
+			CompressedSize64:   1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = w.Write([]byte{0})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := zw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bytes.NewReader(b.Bytes())
+}
+
+func TestZipImageFilesLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries int
+		size    uint64
+		wantErr error
+	}{
+		{"within limits", 3, 1 << 20, nil},
+		{"largest archive", 2, maxArchiveSize / 2, nil},
+		{"too many entries", maxArchiveEntries + 1, 1, errArchiveTooLarge},
+		{"too large", 2, maxArchiveSize/2 + 1, errArchiveTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := testArchive(t, tt.entries, tt.size)
+
+			files, err := zipImageFiles(archive, archive.Size())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && len(files) != tt.entries {
+				t.Errorf("got %d files, want %d", len(files), tt.entries)
+			}
+		})
+	}
+}
+
+func TestAddFileBodyLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int
+		status int
+	}{
+		{"within limit", 1 << 10, http.StatusOK},
+		{"too large", 4 << 10, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := logrus.New()
+			logger.SetOutput(io.Discard)
+			fh := NewFileHandler(logger, fakeFileService{}, chi.NewRouter(), allowAuth)
+			fh.maxBodySize = 2 << 10
+
+			var body bytes.Buffer
+			mw := multipart.NewWriter(&body)
+			part, err := mw.CreateFormFile("file", "1.png")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = part.Write(append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, tt.size)...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = mw.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, APIPrefix+"/images", &body)
+			req.Header.Set("Content-Type", mw.FormDataContentType())
+
+			w := httptest.NewRecorder()
+			allowAuth(http.HandlerFunc(fh.HandleAddFile)).ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("got status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
+
+// archiveFileService records the filter of the archive it is asked for.
+type archiveFileService struct {
+	stubFileService
+	filter *dto.ArchiveFilter
+}
+
+func (s archiveFileService) WriteArchive(ctx context.Context, userID int, filter dto.ArchiveFilter, w io.Writer) error {
+	*s.filter = filter
+	return nil
+}
+
+func TestDownloadArchiveFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		params string
+		want   dto.ArchiveFilter
+		status int
+	}{
+		{"no filter", "", dto.ArchiveFilter{}, http.StatusOK},
+		{"times", "?from=2026-01-05T10:00:00Z&to=2026-01-05T12:00:00Z", dto.ArchiveFilter{
+			From: time.Date(2026, 1, 5, 10, 0, 0, 0, time.UTC),
+			To:   time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC),
+		}, http.StatusOK},
+		{"dates include the last day", "?from=2026-01-01&to=2026-01-05", dto.ArchiveFilter{
+			From: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+			To:   time.Date(2026, 1, 6, 0, 0, 0, 0, time.UTC),
+		}, http.StatusOK},
+		{"tag", "?tag=cats", dto.ArchiveFilter{Tag: "cats"}, http.StatusOK},
+		{"invalid from", "?from=yesterday", dto.ArchiveFilter{}, http.StatusBadRequest},
+		{"invalid to", "?to=2026-13-01", dto.ArchiveFilter{}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got dto.ArchiveFilter
+			r := newTestRouter(allowAuth, testServices{files: archiveFileService{filter: &got}})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, APIPrefix+"/images/archive"+tt.params, nil))
+
+			if w.Code != tt.status {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if !got.From.Equal(tt.want.From) || !got.To.Equal(tt.want.To) || got.Tag != tt.want.Tag {
+				t.Errorf("got filter %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"github.com/fichca/image-loader/internal/dto"
+	"github.com/fichca/image-loader/internal/response"
+	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+type importService interface {
+	CreateJob(ctx context.Context, userID int, urls []string) (dto.ImportJob, error)
+	GetJob(ctx context.Context, userID, id int) (dto.ImportJob, error)
+}
+
+type importHandler struct {
+	logger         *logrus.Logger
+	r              *chi.Mux
+	is             importService
+	authMiddleware func(next http.Handler) http.Handler
+}
+
+func NewImportHandler(logger *logrus.Logger, is importService, r *chi.Mux, authMiddleware func(next http.Handler) http.Handler) *importHandler {
+	return &importHandler{
+		logger:         logger,
+		r:              r,
+		is:             is,
+		authMiddleware: authMiddleware,
+	}
+}
+
+func (ih *importHandler) RegisterImportRoutes() {
+	ih.r.Group(func(r chi.Router) {
+		r.Use(ih.authMiddleware)
+		r.Post(APIPrefix+"/imports", ih.HandleCreateImport)
+		r.Get(APIPrefix+"/imports/{jobID}", ih.HandleGetImport)
+	})
+
+	ih.r.With(deprecated(APIPrefix+"/imports"), ih.authMiddleware).Post("/image/import", ih.HandleCreateImport)
+	ih.r.With(deprecated(APIPrefix+"/imports/{jobID}"), ih.authMiddleware).Get("/image/import/{jobID}", ih.HandleGetImport)
+}
+
+// HandleCreateImport queues images to be downloaded from remote urls
+//
+//	@Summary        CreateImport
+//	@Description    queue images to be downloaded from remote urls
+//	@Tags           image
+//	@Accept         json
+//	@Produce        json
+//	@Param          import    body        dto.ImportRequest    true    "urls to import"
+//	@Success        202       {object}    dto.ImportJob
+//	@Failure        400       {object}    response.Problem
+//	@Failure        500       {object}    response.Problem
+//	@Router         /api/v1/imports [post]
+func (ih *importHandler) HandleCreateImport(w http.ResponseWriter, r *http.Request) {
+	var req dto.ImportRequest
+
+	err := decodeBody(r, &req)
+	if err != nil {
+		ih.handleError(err, w, r)
+		return
+	}
+
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			ih.logger.Error(err)
+		}
+	}(r.Body)
+
+	userID, err := userIDFromCtx(r.Context())
+	if err != nil {
+		ih.handleError(err, w, r)
+		return
+	}
+
+	job, err := ih.is.CreateJob(r.Context(), userID, req.URLs)
+	if err != nil {
+		ih.handleError(err, w, r)
+		return
+	}
+
+	w.Header().Set("Location", APIPrefix+"/imports/"+strconv.Itoa(job.ID))
+	ih.writeResponse(job, http.StatusAccepted, w, r)
+}
+
+// HandleGetImport returns the state of an import job
+//
+//	@Summary        GetImport
+//	@Description    get the state of an import job
+//	@Tags           image
+//	@Produce        json
+//	@Param          jobID    path        int    true    "import job ID"
+//	@Success        200      {object}    dto.ImportJob
+//	@Failure        400      {object}    response.Problem
+//	@Failure        404      {object}    response.Problem
+//	@Failure        500      {object}    response.Problem
+//	@Router         /api/v1/imports/{jobID} [get]
+func (ih *importHandler) HandleGetImport(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "jobID"))
+	if err != nil {
+		ih.handleError(invalidParameter(err), w, r)
+		return
+	}
+
+	userID, err := userIDFromCtx(r.Context())
+	if err != nil {
+		ih.handleError(err, w, r)
+		return
+	}
+
+	job, err := ih.is.GetJob(r.Context(), userID, id)
+	if err != nil {
+		ih.handleError(err, w, r)
+		return
+	}
+
+	ih.writeResponse(job, http.StatusOK, w, r)
+}
+
+func (ih *importHandler) writeResponse(data any, status int, w http.ResponseWriter, r *http.Request) {
+	b, err := response.ParseResponse(data, false)
+	if err != nil {
+		ih.handleError(err, w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", response.JSONContentType)
+	w.WriteHeader(status)
+	_, err = w.Write(b)
+	if err != nil {
+		ih.logger.Error(err)
+	}
+}
+
+func (ih *importHandler) handleError(err error, w http.ResponseWriter, r *http.Request) {
+	ih.logger.Error(err)
+
+	err = response.WriteProblem(w, response.NewProblem(r, err))
+	if err != nil {
+		ih.logger.Error(err)
+	}
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"github.com/fichca/image-loader/internal/dto"
+	"github.com/fichca/image-loader/internal/response"
+	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+)
+
+type notificationService interface {
+	GetSettings(ctx context.Context, userID int) (dto.NotificationSettings, error)
+	UpdateSettings(ctx context.Context, userID int, settings dto.NotificationSettings) error
+}
+
+type notificationHandler struct {
+	logger         *logrus.Logger
+	r              *chi.Mux
+	ns             notificationService
+	authMiddleware func(next http.Handler) http.Handler
+}
+
+func NewNotificationHandler(logger *logrus.Logger, ns notificationService, r *chi.Mux, authMiddleware func(next http.Handler) http.Handler) *notificationHandler {
+	return &notificationHandler{
+		logger:         logger,
+		r:              r,
+		ns:             ns,
+		authMiddleware: authMiddleware,
+	}
+}
+
+func (nh *notificationHandler) RegisterNotificationRoutes() {
+	nh.r.Group(func(r chi.Router) {
+		r.Use(nh.authMiddleware)
+		r.Get(APIPrefix+"/notification-settings", nh.HandleGetNotifications)
+		r.Put(APIPrefix+"/notification-settings", nh.HandleUpdateNotifications)
+	})
+
+	nh.r.With(deprecated(APIPrefix+"/notification-settings"), nh.authMiddleware).Get("/user/notifications", nh.HandleGetNotifications)
+	nh.r.With(deprecated(APIPrefix+"/notification-settings"), nh.authMiddleware).Put("/user/notifications", nh.HandleUpdateNotifications)
+}
+
+// HandleGetNotifications returns which events are sent to the linked Telegram chats
+//
+//	@Summary        GetNotifications
+//	@Description    get the Telegram notification settings of the authorized user
+//	@Tags           user
+//	@Produce        json
+//	@Success        200    {object}    dto.NotificationSettings
+//	@Failure        500    {object}    response.Problem
+//	@Router         /api/v1/notification-settings [get]
+func (nh *notificationHandler) HandleGetNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromCtx(r.Context())
+	if err != nil {
+		nh.handleError(err, w, r)
+		return
+	}
+
+	settings, err := nh.ns.GetSettings(r.Context(), userID)
+	if err != nil {
+		nh.handleError(err, w, r)
+		return
+	}
+
+	nh.writeResponse(settings, http.StatusOK, w, r)
+}
+
+// HandleUpdateNotifications replaces the notification settings
+//
+//	@Summary        UpdateNotifications
+//	@Description    choose which events are sent to the linked Telegram chats
+//	@Tags           user
+//	@Accept         json
+//	@Produce        json
+//	@Param          settings    body        dto.NotificationSettings    true    "notification settings"
+//	@Success        200         {object}    dto.NotificationSettings
+//	@Failure        400         {object}    response.Problem
+//	@Failure        500         {object}    response.Problem
+//	@Router         /api/v1/notification-settings [put]
+func (nh *notificationHandler) HandleUpdateNotifications(w http.ResponseWriter, r *http.Request) {
+	var settings dto.NotificationSettings
+
+	err := decodeBody(r, &settings)
+	if err != nil {
+		nh.handleError(err, w, r)
+		return
+	}
+
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			nh.logger.Error(err)
+		}
+	}(r.Body)
+
+	userID, err := userIDFromCtx(r.Context())
+	if err != nil {
+		nh.handleError(err, w, r)
+		return
+	}
+
+	err = nh.ns.UpdateSettings(r.Context(), userID, settings)
+	if err != nil {
+		nh.handleError(err, w, r)
+		return
+	}
+
+	nh.writeResponse(settings, http.StatusOK, w, r)
+}
+
+func (nh *notificationHandler) writeResponse(data any, status int, w http.ResponseWriter, r *http.Request) {
+	b, err := response.ParseResponse(data, false)
+	if err != nil {
+		nh.handleError(err, w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", response.JSONContentType)
+	w.WriteHeader(status)
+	_, err = w.Write(b)
+	if err != nil {
+		nh.logger.Error(err)
+	}
+}
+
+func (nh *notificationHandler) handleError(err error, w http.ResponseWriter, r *http.Request) {
+	nh.logger.Error(err)
+
+	err = response.WriteProblem(w, response.NewProblem(r, err))
+	if err != nil {
+		nh.logger.Error(err)
+	}
+}
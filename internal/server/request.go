@@ -0,0 +1,51 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/fichca/image-loader/internal/apperr"
+	"github.com/fichca/image-loader/internal/mergepatch"
+	"github.com/fichca/image-loader/internal/validate"
+	"net/http"
+)
+
+// maxPatchSize bounds the merge patch documents read into memory, a profile patch is far smaller.
+const maxPatchSize = 64 << 10
+
+// Codes of the errors found in requests before they reach the services.
+const (
+	codeInvalidBody      = "invalid_body"
+	codeInvalidParameter = "invalid_parameter"
+	codeInvalidHeader    = "invalid_header"
+)
+
+var (
+	errNoFiles                = apperr.New(apperr.KindValidation, "no_files", "no files in request")
+	errUnsupportedContentType = apperr.New(apperr.KindUnsupportedMediaType, "unsupported_content_type", "content type must be "+tusChunkType)
+	errUnsupportedPatchType   = apperr.New(apperr.KindUnsupportedMediaType, "unsupported_content_type", "content type must be "+mergepatch.ContentType)
+	errUnsupportedTusVersion  = apperr.New(apperr.KindPreconditionFailed, "unsupported_tus_version", "unsupported tus version")
+	errInvalidUploadOffset    = apperr.New(apperr.KindValidation, codeInvalidHeader, "invalid Upload-Offset")
+	errArchiveTooLarge        = apperr.New(apperr.KindTooLarge, "archive_too_large", "archive has too many files or is too large")
+	errBodyTooLarge           = apperr.New(apperr.KindTooLarge, "body_too_large", "request body is too large")
+)
+
+func invalidBody(err error) error {
+	return apperr.Wrap(apperr.KindValidation, codeInvalidBody, err)
+}
+
+func invalidParameter(err error) error {
+	return apperr.Wrap(apperr.KindValidation, codeInvalidParameter, err)
+}
+
+func invalidHeader(err error) error {
+	return apperr.Wrap(apperr.KindValidation, codeInvalidHeader, err)
+}
+
+// decodeBody decodes the JSON request body into v and checks it against its validation rules.
+func decodeBody(r *http.Request, v any) error {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err != nil {
+		return invalidBody(err)
+	}
+
+	return validate.Struct(v)
+}
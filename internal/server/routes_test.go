@@ -0,0 +1,162 @@
+package server
+
+import (
+	"github.com/fichca/image-loader/internal/openapi"
+	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// denyAuth answers every request with 401, so routes are reached without any service behind them.
+func denyAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+}
+
+type stubUploadService struct {
+	uploadService
+}
+
+func (stubUploadService) MaxSize() int64 {
+	return 1 << 20
+}
+
+type stubFileService struct {
+	fileService
+}
+
+func (stubFileService) MaxSize() int64 {
+	return 0
+}
+
+// testServices are the services behind the test router, nil ones must not be reached.
+type testServices struct {
+	users         userService
+	files         fileService
+	uploads       uploadService
+	imports       importService
+	notifications notificationService
+	auth          authService
+}
+
+func newTestRouter(auth func(next http.Handler) http.Handler, s testServices) *chi.Mux {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	if s.uploads == nil {
+		s.uploads = stubUploadService{}
+	}
+	if s.files == nil {
+		s.files = stubFileService{}
+	}
+
+	r := chi.NewRouter()
+	NewUserHandler(logger, s.users, r, auth).RegisterUserRoutes()
+	NewFileHandler(logger, s.files, r, auth).RegisterFileRoutes()
+	NewUploadHandler(logger, s.uploads, r, auth).RegisterUploadRoutes()
+	NewImportHandler(logger, s.imports, r, auth).RegisterImportRoutes()
+	NewNotificationHandler(logger, s.notifications, r, auth).RegisterNotificationRoutes()
+	NewAuthHandler(logger, s.auth, r, auth).RegisterAuthRoutes()
+	return r
+}
+
+var routeParam = regexp.MustCompile(`\{[^}]+\}`)
+
+func serve(r http.Handler, method, pattern string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, routeParam.ReplaceAllString(pattern, "1"), nil))
+	return w
+}
+
+func TestDeprecatedRoutes(t *testing.T) {
+	r := newTestRouter(denyAuth, testServices{})
+
+	// The routes served before /api/v1, with the routes replacing them.
+	routes := []struct {
+		method, path, successor string
+	}{
+		{http.MethodPost, "/user/add", "/api/v1/users"},
+		{http.MethodGet, "/user", "/api/v1/users"},
+		{http.MethodGet, "/user/{userID}", "/api/v1/users/1"},
+		{http.MethodPut, "/user/update", ""},
+		{http.MethodDelete, "/user/{userID}", "/api/v1/users/1"},
+		{http.MethodGet, "/user/auth", "/api/v1/auth/token"},
+		{http.MethodPost, "/user/telegram/link-code", "/api/v1/telegram/link-codes"},
+		{http.MethodGet, "/user/telegram-links", "/api/v1/telegram/links"},
+		{http.MethodDelete, "/user/telegram-links", "/api/v1/telegram/links"},
+		{http.MethodDelete, "/user/telegram-links/{telegramID}", "/api/v1/telegram/links/1"},
+		{http.MethodGet, "/user/notifications", "/api/v1/notification-settings"},
+		{http.MethodPut, "/user/notifications", "/api/v1/notification-settings"},
+		{http.MethodPost, "/image/add", "/api/v1/images"},
+		{http.MethodPost, "/image/upload-url", "/api/v1/images/upload-urls"},
+		{http.MethodPost, "/image/{imageID}/complete", "/api/v1/images/1/complete"},
+		{http.MethodGet, "/image/archive", "/api/v1/images/archive"},
+		{http.MethodPost, "/image/import", "/api/v1/imports"},
+		{http.MethodGet, "/image/import/{jobID}", "/api/v1/imports/1"},
+		{http.MethodOptions, "/image/uploads", "/api/v1/uploads"},
+		{http.MethodOptions, "/image/uploads/{uploadID}", "/api/v1/uploads/1"},
+		{http.MethodPost, "/image/uploads", "/api/v1/uploads"},
+		{http.MethodHead, "/image/uploads/{uploadID}", "/api/v1/uploads/1"},
+		{http.MethodPatch, "/image/uploads/{uploadID}", "/api/v1/uploads/1"},
+		{http.MethodDelete, "/image/uploads/{uploadID}", "/api/v1/uploads/1"},
+	}
+
+	for _, route := range routes {
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			w := serve(r, route.method, route.path)
+
+			if w.Code == http.StatusNotFound || w.Code == http.StatusMethodNotAllowed {
+				t.Fatalf("got status %d, the route is not served", w.Code)
+			}
+			if got := w.Header().Get("Deprecation"); got != "true" {
+				t.Errorf("got Deprecation %q, want true", got)
+			}
+
+			link := w.Header().Get("Link")
+			if route.successor == "" {
+				if link != "" {
+					t.Errorf("got Link %q, want none", link)
+				}
+				return
+			}
+			if want := "<" + route.successor + `>; rel="successor-version"`; link != want {
+				t.Errorf("got Link %q, want %q", link, want)
+			}
+		})
+	}
+}
+
+func TestVersionedRoutesAreNotDeprecated(t *testing.T) {
+	r := newTestRouter(denyAuth, testServices{})
+
+	err := chi.Walk(r, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if !strings.HasPrefix(route, APIPrefix+"/") {
+			return nil
+		}
+
+		w := serve(r, method, route)
+		if w.Code == http.StatusNotFound || w.Code == http.StatusMethodNotAllowed {
+			t.Errorf("%s %s: got status %d, the route is not served", method, route, w.Code)
+		}
+		if got := w.Header().Get("Deprecation"); got != "" {
+			t.Errorf("%s %s: got Deprecation %q, want none", method, route, got)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRoutesMatchSpec(t *testing.T) {
+	err := openapi.CheckRoutes(newTestRouter(denyAuth, testServices{}), APIPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,297 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/fichca/image-loader/internal/dto"
+	"github.com/fichca/image-loader/internal/response"
+	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination"
+	tusChunkType  = "application/offset+octet-stream"
+	uploadsPath   = APIPrefix + "/uploads"
+
+	legacyUploadsPath = "/image/uploads"
+)
+
+type uploadService interface {
+	MaxSize() int64
+	CreateUpload(ctx context.Context, upload dto.Upload) (dto.Upload, error)
+	GetUpload(ctx context.Context, userID int, id string) (dto.Upload, error)
+	WriteChunk(ctx context.Context, userID int, id string, offset int64, data io.Reader) (int64, error)
+	Terminate(ctx context.Context, userID int, id string) error
+}
+
+type uploadHandler struct {
+	logger         *logrus.Logger
+	r              *chi.Mux
+	us             uploadService
+	authMiddleware func(next http.Handler) http.Handler
+}
+
+func NewUploadHandler(logger *logrus.Logger, us uploadService, r *chi.Mux, authMiddleware func(next http.Handler) http.Handler) *uploadHandler {
+	return &uploadHandler{
+		logger:         logger,
+		r:              r,
+		us:             us,
+		authMiddleware: authMiddleware,
+	}
+}
+
+// RegisterUploadRoutes mounts the tus 1.0 core protocol with the creation and termination extensions.
+func (uh *uploadHandler) RegisterUploadRoutes() {
+	uh.registerUploadRoutes(uh.r, uh.r, uploadsPath)
+	uh.registerUploadRoutes(uh.r.With(deprecated(uploadsPath)), uh.r.With(deprecated(uploadsPath+"/{uploadID}")), legacyUploadsPath)
+}
+
+// registerUploadRoutes mounts the collection routes of path on collection and the routes of single uploads on item.
+func (uh *uploadHandler) registerUploadRoutes(collection, item chi.Router, path string) {
+	collection.Options(path, uh.HandleUploadOptions)
+	item.Options(path+"/{uploadID}", uh.HandleUploadOptions)
+
+	collection.With(uh.authMiddleware, uh.tusResumable).Post(path, uh.HandleCreateUpload)
+
+	item = item.With(uh.authMiddleware, uh.tusResumable)
+	item.Head(path+"/{uploadID}", uh.HandleGetUploadOffset)
+	item.Patch(path+"/{uploadID}", uh.HandleWriteChunk)
+	item.Delete(path+"/{uploadID}", uh.HandleTerminateUpload)
+}
+
+// HandleUploadOptions describes the tus server configuration
+//
+//	@Summary        UploadOptions
+//	@Description    tus server configuration
+//	@Tags           upload
+//	@Success        204
+//	@Router         /api/v1/uploads [options]
+//	@Router         /api/v1/uploads/{uploadID} [options]
+func (uh *uploadHandler) HandleUploadOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	if uh.us.MaxSize() > 0 {
+		w.Header().Set("Tus-Max-Size", strconv.FormatInt(uh.us.MaxSize(), 10))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleCreateUpload creates a resumable upload
+//
+//	@Summary        CreateUpload
+//	@Description    create a tus upload, the file name is taken from the "filename" metadata
+//	@Tags           upload
+//	@Param          Tus-Resumable      header    string    true     "tus protocol version"
+//	@Param          Upload-Length      header    int       true     "size of the whole file"
+//	@Param          Upload-Metadata    header    string    false    "tus upload metadata"
+//	@Success        201
+//	@Failure        400    {object}    response.Problem
+//	@Failure        412    {object}    response.Problem
+//	@Failure        413    {object}    response.Problem
+//	@Failure        500    {object}    response.Problem
+//	@Router         /api/v1/uploads [post]
+func (uh *uploadHandler) HandleCreateUpload(w http.ResponseWriter, r *http.Request) {
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil {
+		uh.handleError(invalidHeader(fmt.Errorf("invalid Upload-Length: %w", err)), w, r)
+		return
+	}
+
+	metadata := r.Header.Get("Upload-Metadata")
+	values, err := parseUploadMetadata(metadata)
+	if err != nil {
+		uh.handleError(invalidHeader(err), w, r)
+		return
+	}
+
+	userID, err := userIDFromCtx(r.Context())
+	if err != nil {
+		uh.handleError(err, w, r)
+		return
+	}
+
+	upload, err := uh.us.CreateUpload(r.Context(), dto.Upload{
+		UserID:   userID,
+		Length:   length,
+		FileName: values["filename"],
+		Metadata: metadata,
+	})
+	if err != nil {
+		uh.handleError(err, w, r)
+		return
+	}
+
+	w.Header().Set("Location", uploadsPath+"/"+upload.ID)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// HandleGetUploadOffset reports how many bytes of the upload were received
+//
+//	@Summary        GetUploadOffset
+//	@Description    get the current offset of a tus upload
+//	@Tags           upload
+//	@Param          uploadID         path      string    true    "upload ID"
+//	@Param          Tus-Resumable    header    string    true    "tus protocol version"
+//	@Success        200
+//	@Failure        404
+//	@Failure        412
+//	@Router         /api/v1/uploads/{uploadID} [head]
+func (uh *uploadHandler) HandleGetUploadOffset(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromCtx(r.Context())
+	if err != nil {
+		uh.handleError(err, w, r)
+		return
+	}
+
+	upload, err := uh.us.GetUpload(r.Context(), userID, chi.URLParam(r, "uploadID"))
+	if err != nil {
+		uh.handleError(err, w, r)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if upload.Metadata != "" {
+		w.Header().Set("Upload-Metadata", upload.Metadata)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleWriteChunk appends a chunk to the upload
+//
+//	@Summary        WriteChunk
+//	@Description    append bytes to a tus upload, the image is stored once the last byte is received
+//	@Tags           upload
+//	@Accept         application/offset+octet-stream
+//	@Param          uploadID         path      string    true    "upload ID"
+//	@Param          Tus-Resumable    header    string    true    "tus protocol version"
+//	@Param          Upload-Offset    header    int       true    "offset the chunk starts at"
+//	@Success        204
+//	@Failure        400    {object}    response.Problem
+//	@Failure        404    {object}    response.Problem
+//	@Failure        409    {object}    response.Problem
+//	@Failure        412    {object}    response.Problem
+//	@Failure        413    {object}    response.Problem
+//	@Failure        415    {object}    response.Problem
+//	@Failure        500    {object}    response.Problem
+//	@Router         /api/v1/uploads/{uploadID} [patch]
+func (uh *uploadHandler) HandleWriteChunk(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != tusChunkType {
+		uh.handleError(errUnsupportedContentType, w, r)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		uh.handleError(errInvalidUploadOffset, w, r)
+		return
+	}
+
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			uh.logger.Error(err)
+		}
+	}(r.Body)
+
+	userID, err := userIDFromCtx(r.Context())
+	if err != nil {
+		uh.handleError(err, w, r)
+		return
+	}
+
+	newOffset, err := uh.us.WriteChunk(r.Context(), userID, chi.URLParam(r, "uploadID"), offset, r.Body)
+	if err != nil {
+		uh.handleError(err, w, r)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(newOffset, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleTerminateUpload cancels the upload
+//
+//	@Summary        TerminateUpload
+//	@Description    cancel a tus upload and drop the received bytes
+//	@Tags           upload
+//	@Param          uploadID         path      string    true    "upload ID"
+//	@Param          Tus-Resumable    header    string    true    "tus protocol version"
+//	@Success        204
+//	@Failure        404    {object}    response.Problem
+//	@Failure        412    {object}    response.Problem
+//	@Failure        500    {object}    response.Problem
+//	@Router         /api/v1/uploads/{uploadID} [delete]
+func (uh *uploadHandler) HandleTerminateUpload(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromCtx(r.Context())
+	if err != nil {
+		uh.handleError(err, w, r)
+		return
+	}
+
+	err = uh.us.Terminate(r.Context(), userID, chi.URLParam(r, "uploadID"))
+	if err != nil {
+		uh.handleError(err, w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (uh *uploadHandler) tusResumable(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tus-Resumable", tusVersion)
+		if r.Header.Get("Tus-Resumable") != tusVersion {
+			w.Header().Set("Tus-Version", tusVersion)
+			uh.handleError(errUnsupportedTusVersion, w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+func (uh *uploadHandler) handleError(err error, w http.ResponseWriter, r *http.Request) {
+	uh.logger.Error(err)
+
+	err = response.WriteProblem(w, response.NewProblem(r, err))
+	if err != nil {
+		uh.logger.Error(err)
+	}
+}
+
+// parseUploadMetadata decodes the tus Upload-Metadata header: comma separated "key base64(value)" pairs.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	values := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return values, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		kv := strings.Fields(pair)
+		switch len(kv) {
+		case 1:
+			values[kv[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(kv[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid Upload-Metadata value for %q: %w", kv[0], err)
+			}
+			values[kv[0]] = string(value)
+		default:
+			return nil, errors.New("invalid Upload-Metadata")
+		}
+	}
+
+	return values, nil
+}
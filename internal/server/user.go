@@ -3,20 +3,34 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/fichca/image-loader/internal/dto"
+	"github.com/fichca/image-loader/internal/mergepatch"
+	"github.com/fichca/image-loader/internal/response"
+	"github.com/fichca/image-loader/internal/validate"
 	"github.com/go-chi/chi"
 	"github.com/sirupsen/logrus"
 	"io"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
+// defaultUsersLimit is the size of a users page when the limit parameter is not given.
+const defaultUsersLimit = 20
+
 type userService interface {
 	Add(ctx context.Context, user dto.UserDto) error
 	GetById(ctx context.Context, id int) (dto.UserResponse, error)
-	Update(ctx context.Context, user dto.UserDto) error
-	DeleteById(ctx context.Context, id int) error
-	GetAll(ctx context.Context) ([]dto.UserDto, error)
+	GetPublicById(ctx context.Context, id int) (dto.PublicUser, error)
+	GetMe(ctx context.Context, userID int) (dto.Me, error)
+	Update(ctx context.Context, userID int, user dto.UserUpdate) error
+	Patch(ctx context.Context, userID, id int, patch []byte) error
+	ChangePassword(ctx context.Context, userID, id int, change dto.PasswordChange) error
+	DeleteById(ctx context.Context, userID, id int) error
+	GetPage(ctx context.Context, query dto.UserQuery) (dto.UserPage, error)
 }
 
 type userHandler struct {
@@ -36,16 +50,25 @@ func NewUserHandler(logger *logrus.Logger, us userService, r *chi.Mux, authMiddl
 }
 
 func (uh *userHandler) RegisterUserRoutes() {
-	uh.r.Post("/user/add", uh.HandleAddUser)
+	uh.r.Post(APIPrefix+"/users", uh.HandleAddUser)
 
 	uh.r.Group(func(r chi.Router) {
 		r.Use(uh.authMiddleware)
 
-		r.Get("/user/{userID}", uh.HandleGetByIdUser)
-		r.Put("/user/update", uh.HandleUpdateUser)
-		r.Delete("/user/{userID}", uh.HandleDeleteByIdUser)
-		r.Get("/user", uh.HandleGetAllUsers)
+		r.Get(APIPrefix+"/me", uh.HandleGetMe)
+		r.Get(APIPrefix+"/users", uh.HandleGetAllUsers)
+		r.Get(APIPrefix+"/users/{userID}", uh.HandleGetByIdUser)
+		r.Put(APIPrefix+"/users/{userID}", uh.HandleUpdateUser)
+		r.Patch(APIPrefix+"/users/{userID}", uh.HandlePatchUser)
+		r.Post(APIPrefix+"/users/{userID}/password", uh.HandleChangePassword)
+		r.Delete(APIPrefix+"/users/{userID}", uh.HandleDeleteByIdUser)
 	})
+
+	uh.r.With(deprecated(APIPrefix+"/users")).Post("/user/add", uh.HandleAddUser)
+	uh.r.With(deprecated(APIPrefix+"/users/{userID}"), uh.authMiddleware).Get("/user/{userID}", uh.HandleGetByIdUser)
+	uh.r.With(deprecated(""), uh.authMiddleware).Put("/user/update", uh.HandleUpdateUser)
+	uh.r.With(deprecated(APIPrefix+"/users/{userID}"), uh.authMiddleware).Delete("/user/{userID}", uh.HandleDeleteByIdUser)
+	uh.r.With(deprecated(APIPrefix+"/users"), uh.authMiddleware).Get("/user", uh.HandleGetAllUsers)
 }
 
 // HandleAddUser adds a new user
@@ -57,16 +80,17 @@ func (uh *userHandler) RegisterUserRoutes() {
 //	@Produce      json
 //	@Param        user    body     dto.UserDto  true  "add a new user"
 //	@Success      200  {array}   response.Response
-//	@Failure      400  {object}  response.Response
-//	@Failure      404  {object}  response.Response
-//	@Failure      500  {object}  response.Response
-//	@Router       /user/add [post]
+//	@Failure      400  {object}  response.Problem
+//	@Failure      404  {object}  response.Problem
+//	@Failure      409  {object}  response.Problem
+//	@Failure      500  {object}  response.Problem
+//	@Router       /api/v1/users [post]
 func (uh *userHandler) HandleAddUser(w http.ResponseWriter, r *http.Request) {
 	var user dto.UserDto
 
-	err := json.NewDecoder(r.Body).Decode(&user)
+	err := decodeBody(r, &user)
 	if err != nil {
-		uh.handleError(err, http.StatusBadRequest, w)
+		uh.handleError(err, w, r)
 		return
 	}
 
@@ -79,47 +103,96 @@ func (uh *userHandler) HandleAddUser(w http.ResponseWriter, r *http.Request) {
 
 	err = uh.us.Add(context.Background(), user)
 	if err != nil {
-		uh.handleError(err, http.StatusInternalServerError, w)
+		uh.handleError(err, w, r)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
 
-// HandleGetByIdUser get user by id
+// HandleGetMe returns the profile of the authorized user
+//
+//	@Summary        GetMe
+//	@Description    get the profile of the authorized user with a summary of its images
+//	@Tags           user
+//	@Produce        json
+//	@Success        200    {object}    dto.Me
+//	@Failure        401    {object}    response.Problem
+//	@Failure        500    {object}    response.Problem
+//	@Router         /api/v1/me [get]
+func (uh *userHandler) HandleGetMe(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromCtx(r.Context())
+	if err != nil {
+		uh.handleError(err, w, r)
+		return
+	}
+
+	me, err := uh.us.GetMe(r.Context(), userID)
+	if err != nil {
+		uh.handleError(err, w, r)
+		return
+	}
+
+	b, err := json.Marshal(&me)
+	if err != nil {
+		uh.handleError(err, w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", response.JSONContentType)
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(b)
+	if err != nil {
+		uh.logger.Error(err)
+	}
+}
+
+// HandleGetByIdUser get user by id, other users get its public view
 //
 //	@Summary        GetUserById
-//	@Description    get user
+//	@Description    get user, other users get a dto.PublicUser without the login and images
 //	@Tags            user
 //	@Accept            json
 //	@Produce        json
-//	@Param            id    path        string    true    "get user by ID"
-//	@Success        200    {array}        dto.UserResponse
-//	@Failure        400    {object}    response.Response
-//	@Failure        404    {object}    response.Response
-//	@Failure        500    {object}    response.Response
-//	@Router            /user/{userID} [get]
+//	@Param            userID    path        int    true    "user ID"
+//	@Success        200    {object}    dto.UserResponse
+//	@Failure        400    {object}    response.Problem
+//	@Failure        404    {object}    response.Problem
+//	@Failure        500    {object}    response.Problem
+//	@Router            /api/v1/users/{userID} [get]
 func (uh *userHandler) HandleGetByIdUser(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "userID")
 
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		uh.handleError(err, http.StatusBadRequest, w)
+		uh.handleError(invalidParameter(err), w, r)
+		return
+	}
+
+	userID, err := userIDFromCtx(r.Context())
+	if err != nil {
+		uh.handleError(err, w, r)
 		return
 	}
 
-	user, err := uh.us.GetById(context.Background(), id)
+	var user any
+	if id == userID {
+		user, err = uh.us.GetById(r.Context(), id)
+	} else {
+		user, err = uh.us.GetPublicById(r.Context(), id)
+	}
 	if err != nil {
-		uh.handleError(err, http.StatusInternalServerError, w)
+		uh.handleError(err, w, r)
 		return
 	}
 
 	b, err := json.Marshal(&user)
 	if err != nil {
-		uh.handleError(err, http.StatusInternalServerError, w)
+		uh.handleError(err, w, r)
 		return
 	}
 
+	w.Header().Set("Content-Type", response.JSONContentType)
 	w.WriteHeader(http.StatusOK)
 	_, err = w.Write(b)
 	if err != nil {
@@ -130,22 +203,25 @@ func (uh *userHandler) HandleGetByIdUser(w http.ResponseWriter, r *http.Request)
 // HandleUpdateUser update user
 //
 //	@Summary        UpdateUser
-//	@Description    update user
+//	@Description    update the name, login and description of a user, the password is kept
 //	@Tags            user
 //	@Accept            json
 //	@Produce        json
-//	@Param            user    body        dto.UserDto    true    "update user"
+//	@Param            userID  path        int               true    "user ID"
+//	@Param            user    body        dto.UserUpdate    true    "update user"
 //	@Success        200
-//	@Failure        400        {object}    response.Response
-//	@Failure        404        {object}    response.Response
-//	@Failure        500        {object}    response.Response
-//	@Router            /user/update [put]
+//	@Failure        400        {object}    response.Problem
+//	@Failure        403        {object}    response.Problem
+//	@Failure        404        {object}    response.Problem
+//	@Failure        409        {object}    response.Problem
+//	@Failure        500        {object}    response.Problem
+//	@Router            /api/v1/users/{userID} [put]
 func (uh *userHandler) HandleUpdateUser(w http.ResponseWriter, r *http.Request) {
-	var user dto.UserDto
+	var user dto.UserUpdate
 
-	err := json.NewDecoder(r.Body).Decode(&user)
+	err := decodeBody(r, &user)
 	if err != nil {
-		uh.handleError(err, http.StatusBadRequest, w)
+		uh.handleError(err, w, r)
 		return
 	}
 
@@ -156,15 +232,147 @@ func (uh *userHandler) HandleUpdateUser(w http.ResponseWriter, r *http.Request)
 		}
 	}(r.Body)
 
-	err = uh.us.Update(r.Context(), user)
+	// The deprecated route takes the account from the body, the versioned one from the path.
+	if idStr := chi.URLParam(r, "userID"); idStr != "" {
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			uh.handleError(invalidParameter(err), w, r)
+			return
+		}
+		user.ID = int64(id)
+	}
+
+	userID, err := userIDFromCtx(r.Context())
+	if err != nil {
+		uh.handleError(err, w, r)
+		return
+	}
+
+	err = uh.us.Update(r.Context(), userID, user)
 	if err != nil {
-		uh.handleError(err, http.StatusInternalServerError, w)
+		uh.handleError(err, w, r)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
 
+// HandlePatchUser changes the given fields of a user
+//
+//	@Summary        PatchUser
+//	@Description    change the name, login or description of a user with a JSON merge patch, null clears the description
+//	@Tags           user
+//	@Accept         application/merge-patch+json
+//	@Produce        json
+//	@Param          userID    path        int                true    "user ID"
+//	@Param          patch     body        dto.UserProfile    true    "merge patch"
+//	@Success        200
+//	@Failure        400       {object}    response.Problem
+//	@Failure        403       {object}    response.Problem
+//	@Failure        404       {object}    response.Problem
+//	@Failure        409       {object}    response.Problem
+//	@Failure        413       {object}    response.Problem
+//	@Failure        415       {object}    response.Problem
+//	@Failure        500       {object}    response.Problem
+//	@Router         /api/v1/users/{userID} [patch]
+func (uh *userHandler) HandlePatchUser(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != mergepatch.ContentType {
+		uh.handleError(errUnsupportedPatchType, w, r)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		uh.handleError(invalidParameter(err), w, r)
+		return
+	}
+
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPatchSize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		uh.handleError(errBodyTooLarge, w, r)
+		return
+	}
+	if err != nil {
+		uh.handleError(invalidBody(err), w, r)
+		return
+	}
+
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			uh.logger.Error(err)
+		}
+	}(r.Body)
+
+	userID, err := userIDFromCtx(r.Context())
+	if err != nil {
+		uh.handleError(err, w, r)
+		return
+	}
+
+	err = uh.us.Patch(r.Context(), userID, id, patch)
+	if err != nil {
+		uh.handleError(err, w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleChangePassword replaces the password of a user
+//
+//	@Summary        ChangePassword
+//	@Description    replace the password of a user, the current password is required
+//	@Tags           user
+//	@Accept         json
+//	@Produce        json
+//	@Param          userID      path        int                   true    "user ID"
+//	@Param          password    body        dto.PasswordChange    true    "current and new password"
+//	@Success        204
+//	@Failure        400         {object}    response.Problem
+//	@Failure        403         {object}    response.Problem
+//	@Failure        404         {object}    response.Problem
+//	@Failure        500         {object}    response.Problem
+//	@Router         /api/v1/users/{userID}/password [post]
+func (uh *userHandler) HandleChangePassword(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		uh.handleError(invalidParameter(err), w, r)
+		return
+	}
+
+	var change dto.PasswordChange
+
+	err = decodeBody(r, &change)
+	if err != nil {
+		uh.handleError(err, w, r)
+		return
+	}
+
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			uh.logger.Error(err)
+		}
+	}(r.Body)
+
+	userID, err := userIDFromCtx(r.Context())
+	if err != nil {
+		uh.handleError(err, w, r)
+		return
+	}
+
+	err = uh.us.ChangePassword(r.Context(), userID, id, change)
+	if err != nil {
+		uh.handleError(err, w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // HandleDeleteByIdUser delete a user
 //
 //	@Summary        DeleteUser
@@ -172,56 +380,83 @@ func (uh *userHandler) HandleUpdateUser(w http.ResponseWriter, r *http.Request)
 //	@Tags            user
 //	@Accept            json
 //	@Produce        json
-//	@Param            id    path        string    true    "delete user"
+//	@Param            userID    path        int    true    "user ID"
 //	@Success        200
-//	@Failure        400    {object}    response.Response
-//	@Failure        404    {object}    response.Response
-//	@Failure        500    {object}    response.Response
-//	@Router            /user/{userID} [delete]
+//	@Failure        400    {object}    response.Problem
+//	@Failure        403    {object}    response.Problem
+//	@Failure        404    {object}    response.Problem
+//	@Failure        500    {object}    response.Problem
+//	@Router            /api/v1/users/{userID} [delete]
 func (uh *userHandler) HandleDeleteByIdUser(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "userID")
 
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		uh.handleError(err, http.StatusBadRequest, w)
+		uh.handleError(invalidParameter(err), w, r)
+		return
+	}
+
+	userID, err := userIDFromCtx(r.Context())
+	if err != nil {
+		uh.handleError(err, w, r)
 		return
 	}
 
-	err = uh.us.DeleteById(context.Background(), id)
+	err = uh.us.DeleteById(context.Background(), userID, id)
 	if err != nil {
-		uh.handleError(err, http.StatusInternalServerError, w)
+		uh.handleError(err, w, r)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
 
-// HandleGetAllUsers get all users
+// HandleGetAllUsers get a page of users
 //
 //	@Summary        GetAllUser
-//	@Description    get all users
+//	@Description    get a page of users, the Link header holds the URL of the next page and X-Total-Count the number of users when count is set
 //	@Tags           user
 //	@Accept         json
 //	@Produce        json
-//	@Success        200    {array}        dto.UserDto
-//	@Failure        400    {object}    response.Response
-//	@Failure        404    {object}    response.Response
-//	@Failure        500    {object}    response.Response
-//	@Router            /user/ [get]
+//	@Param          search    query       string     false    "name prefix, case insensitive, or whole login"
+//	@Param          sort      query       string     false    "id, name, -id or -name"
+//	@Param          cursor    query       string     false    "cursor of the next page"
+//	@Param          limit     query       int        false    "page size, 20 by default"
+//	@Param          count     query       boolean    false    "count the users found"
+//	@Success        200    {array}        dto.PublicUser
+//	@Failure        400    {object}    response.Problem
+//	@Failure        404    {object}    response.Problem
+//	@Failure        500    {object}    response.Problem
+//	@Router            /api/v1/users [get]
 func (uh *userHandler) HandleGetAllUsers(w http.ResponseWriter, r *http.Request) {
+	query, err := parseUserQuery(r)
+	if err != nil {
+		uh.handleError(err, w, r)
+		return
+	}
 
-	users, err := uh.us.GetAll(context.Background())
+	page, err := uh.us.GetPage(r.Context(), query)
 	if err != nil {
-		uh.handleError(err, http.StatusInternalServerError, w)
+		uh.handleError(err, w, r)
 		return
 	}
 
-	b, err := json.Marshal(&users)
+	if page.NextCursor != "" {
+		params := r.URL.Query()
+		params.Set("cursor", page.NextCursor)
+		w.Header().Add("Link", "<"+r.URL.Path+"?"+params.Encode()+`>; rel="next"`)
+	}
+	if page.Total != nil {
+		w.Header().Set("X-Total-Count", strconv.Itoa(*page.Total))
+	}
+
+	b, err := json.Marshal(&page.Users)
 	if err != nil {
-		uh.handleError(err, http.StatusInternalServerError, w)
+		uh.handleError(err, w, r)
 		return
 	}
 
+	w.Header().Set("Content-Type", response.JSONContentType)
 	w.WriteHeader(http.StatusOK)
 	_, err = w.Write(b)
 	if err != nil {
@@ -230,10 +465,46 @@ func (uh *userHandler) HandleGetAllUsers(w http.ResponseWriter, r *http.Request)
 
 }
 
-func (uh *userHandler) handleError(err error, status int, w http.ResponseWriter) {
+// parseUserQuery reads the list parameters of the users list.
+func parseUserQuery(r *http.Request) (dto.UserQuery, error) {
+	params := r.URL.Query()
+	query := dto.UserQuery{
+		Search: params.Get("search"),
+		Sort:   "id",
+		Cursor: params.Get("cursor"),
+		Limit:  defaultUsersLimit,
+	}
+
+	if sort := params.Get("sort"); sort != "" {
+		query.Desc = strings.HasPrefix(sort, "-")
+		query.Sort = strings.TrimPrefix(sort, "-")
+		if query.Sort != "id" && query.Sort != "name" {
+			return query, invalidParameter(fmt.Errorf("unknown sort %q", sort))
+		}
+	}
+
+	var err error
+	if limit := params.Get("limit"); limit != "" {
+		query.Limit, err = strconv.Atoi(limit)
+		if err != nil {
+			return query, invalidParameter(err)
+		}
+	}
+
+	if count := params.Get("count"); count != "" {
+		query.Count, err = strconv.ParseBool(count)
+		if err != nil {
+			return query, invalidParameter(err)
+		}
+	}
+
+	return query, validate.Struct(query)
+}
+
+func (uh *userHandler) handleError(err error, w http.ResponseWriter, r *http.Request) {
 	uh.logger.Error(err)
-	w.WriteHeader(status)
-	_, err = w.Write([]byte(err.Error()))
+
+	err = response.WriteProblem(w, response.NewProblem(r, err))
 	if err != nil {
 		uh.logger.Error(err)
 	}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"github.com/fichca/image-loader/internal/dto"
+	"github.com/fichca/image-loader/internal/mergepatch"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// viewUserService answers with the full view of a user or the public one.
+type viewUserService struct {
+	userService
+}
+
+func (viewUserService) GetById(ctx context.Context, id int) (dto.UserResponse, error) {
+	return dto.UserResponse{ID: int64(id), Name: "Ann", Login: "ann"}, nil
+}
+
+func (viewUserService) GetPublicById(ctx context.Context, id int) (dto.PublicUser, error) {
+	return dto.PublicUser{ID: int64(id), Name: "Bob"}, nil
+}
+
+// pagingUserService records the query of the users list and answers with page.
+type pagingUserService struct {
+	fakeUserService
+	page  dto.UserPage
+	query *dto.UserQuery
+}
+
+func (s pagingUserService) GetPage(ctx context.Context, query dto.UserQuery) (dto.UserPage, error) {
+	*s.query = query
+	return s.page, nil
+}
+
+func TestGetUserByIdView(t *testing.T) {
+	tests := []struct {
+		name      string
+		id        string
+		wantLogin bool
+	}{
+		{"own account", "1", true},
+		{"another user", "2", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(allowAuth, testServices{users: viewUserService{}})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, APIPrefix+"/users/"+tt.id, nil))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+			}
+			if got := strings.Contains(w.Body.String(), `"login"`); got != tt.wantLogin {
+				t.Errorf("got login shown %v, want %v: %s", got, tt.wantLogin, w.Body)
+			}
+		})
+	}
+}
+
+func TestGetAllUsersQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		params string
+		want   dto.UserQuery
+		status int
+	}{
+		{"defaults", "", dto.UserQuery{Sort: "id", Limit: defaultUsersLimit}, http.StatusOK},
+		{"descending name", "?sort=-name&limit=5&search=bo&cursor=abc&count=true",
+			dto.UserQuery{Search: "bo", Sort: "name", Desc: true, Cursor: "abc", Limit: 5, Count: true}, http.StatusOK},
+		{"descending id", "?sort=-id", dto.UserQuery{Sort: "id", Desc: true, Limit: defaultUsersLimit}, http.StatusOK},
+		{"unknown sort", "?sort=login", dto.UserQuery{}, http.StatusBadRequest},
+		{"limit not a number", "?limit=ten", dto.UserQuery{}, http.StatusBadRequest},
+		{"limit too small", "?limit=0", dto.UserQuery{}, http.StatusBadRequest},
+		{"limit too large", "?limit=101", dto.UserQuery{}, http.StatusBadRequest},
+		{"count not a boolean", "?count=maybe", dto.UserQuery{}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got dto.UserQuery
+			r := newTestRouter(allowAuth, testServices{users: pagingUserService{query: &got}})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, APIPrefix+"/users"+tt.params, nil))
+
+			if w.Code != tt.status {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if got != tt.want {
+				t.Errorf("got query %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAllUsersPageHeaders(t *testing.T) {
+	total := 7
+
+	tests := []struct {
+		name      string
+		page      dto.UserPage
+		wantLink  string
+		wantCount string
+	}{
+		{
+			name:      "next page",
+			page:      dto.UserPage{Users: []dto.PublicUser{{ID: 1}}, NextCursor: "next", Total: &total},
+			wantLink:  `</api/v1/users?cursor=next&limit=1&search=bo>; rel="next"`,
+			wantCount: "7",
+		},
+		{
+			name: "last page",
+			page: dto.UserPage{Users: []dto.PublicUser{{ID: 1}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var query dto.UserQuery
+			r := newTestRouter(allowAuth, testServices{users: pagingUserService{page: tt.page, query: &query}})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, APIPrefix+"/users?search=bo&limit=1&cursor=prev", nil))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d: %s", w.Code, w.Body)
+			}
+			if got := w.Header().Get("Link"); got != tt.wantLink {
+				t.Errorf("got Link %q, want %q", got, tt.wantLink)
+			}
+			if got := w.Header().Get("X-Total-Count"); got != tt.wantCount {
+				t.Errorf("got X-Total-Count %q, want %q", got, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestPatchUserBodyLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int
+		status int
+	}{
+		{"largest patch", maxPatchSize, http.StatusOK},
+		{"too large", maxPatchSize + 1, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"description":"` + strings.Repeat("a", tt.size-len(`{"description":""}`)) + `"}`
+			req := httptest.NewRequest(http.MethodPatch, APIPrefix+"/users/1", strings.NewReader(body))
+			req.Header.Set("Content-Type", mergepatch.ContentType)
+
+			w := httptest.NewRecorder()
+			newTestRouter(allowAuth, testServices{users: fakeUserService{}}).ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("got status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
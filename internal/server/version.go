@@ -0,0 +1,40 @@
+package server
+
+import (
+	"github.com/go-chi/chi"
+	"net/http"
+	"strings"
+)
+
+// APIPrefix is the prefix of the current API version.
+const APIPrefix = "/api/v1"
+
+// deprecated marks a route kept from before /api/v1. Responses carry the Deprecation header and
+// a Link to the route replacing it, successor is that route's pattern or empty when the old
+// route does not tell which URL replaces it.
+func deprecated(successor string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", "true")
+			if successor != "" {
+				w.Header().Set("Link", "<"+successorURL(r, successor)+`>; rel="successor-version"`)
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// successorURL fills the parameters of the successor pattern with the ones of the request.
+func successorURL(r *http.Request, pattern string) string {
+	routeCtx := chi.RouteContext(r.Context())
+	if routeCtx == nil {
+		return pattern
+	}
+
+	replacements := make([]string, 0, 2*len(routeCtx.URLParams.Keys))
+	for i, key := range routeCtx.URLParams.Keys {
+		replacements = append(replacements, "{"+key+"}", routeCtx.URLParams.Values[i])
+	}
+	return strings.NewReplacer(replacements...).Replace(pattern)
+}
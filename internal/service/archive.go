@@ -0,0 +1,191 @@
+package service
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/fichca/image-loader/internal/dto"
+	"github.com/fichca/image-loader/internal/entity"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	manifestName = "manifest.json"
+	// archivePeekSize is how much of an object is read ahead, the rest is streamed into the archive.
+	archivePeekSize = 64 << 10
+)
+
+type archiveObject struct {
+	data io.ReadCloser
+	err  error
+}
+
+// archiveReader reads an object through the buffer its head was peeked into.
+type archiveReader struct {
+	io.Reader
+	io.Closer
+}
+
+// WriteArchive streams a zip with the user's images followed by a manifest describing them.
+// At most archivePrefetch objects are opened ahead of the one being written and only archivePeekSize bytes
+// of each are buffered, the rest is copied straight into the archive, so memory stays bounded however many
+// and however large images the user has. Images that fail to open are skipped and reported in the manifest,
+// a failure while an image is being copied cuts the archive short.
+func (fs *FileService) WriteArchive(ctx context.Context, userID int, filter dto.ArchiveFilter, w io.Writer) error {
+	images, err := fs.imageRepository.GetAllByUserIdCreatedBetween(ctx, userID, toNullTime(filter.From), toNullTime(filter.To), filter.Tag)
+	if err != nil {
+		return fmt.Errorf("failed to get images by userID: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	objects := make([]chan archiveObject, len(images))
+	for i := range objects {
+		objects[i] = make(chan archiveObject, 1)
+	}
+
+	started, next := 0, 0
+	prefetch := func(limit int) {
+		for ; started < len(images) && started < limit; started++ {
+			go func(i int) {
+				data, err := fs.openObject(ctx, images[i].Name)
+				objects[i] <- archiveObject{data: data, err: err}
+			}(started)
+		}
+	}
+	// objects opened ahead are closed when the archive is cut short
+	defer func() {
+		cancel()
+		for ; next < started; next++ {
+			object := <-objects[next]
+			if object.data != nil {
+				_ = object.data.Close()
+			}
+		}
+	}()
+
+	zw := zip.NewWriter(w)
+	names := make(map[string]int)
+	manifest := make([]dto.ArchiveEntry, 0, len(images))
+
+	for i, image := range images {
+		prefetch(i + fs.archivePrefetch)
+		object := <-objects[i]
+		next = i + 1
+
+		entry := toArchiveEntry(image)
+		if object.err != nil {
+			entry.Error = object.err.Error()
+			manifest = append(manifest, entry)
+			continue
+		}
+
+		entry.FileName = uniqueArchiveName(names, archiveName(image))
+		entry.Size, err = writeArchiveEntry(zw, entry.FileName, image.CreatedAt, object.data)
+		if err != nil {
+			return err
+		}
+
+		manifest = append(manifest, entry)
+	}
+
+	fw, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     manifestName,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add manifest to archive: %w", err)
+	}
+
+	enc := json.NewEncoder(fw)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	return zw.Close()
+}
+
+// openObject opens an object and reads its head, so that an object that is missing or cannot be read
+// is found before its entry is started.
+func (fs *FileService) openObject(ctx context.Context, name string) (io.ReadCloser, error) {
+	object, err := fs.fileStorage.GetObject(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReaderSize(object, archivePeekSize)
+	_, err = r.Peek(archivePeekSize)
+	if err != nil && !errors.Is(err, io.EOF) {
+		_ = object.Close()
+		return nil, err
+	}
+
+	return archiveReader{Reader: r, Closer: object}, nil
+}
+
+// writeArchiveEntry copies data into a new entry of the archive and closes it, returning the size copied.
+func writeArchiveEntry(zw *zip.Writer, name string, modified time.Time, data io.ReadCloser) (int64, error) {
+	defer data.Close()
+
+	fw, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Store,
+		Modified: modified,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to add %s to archive: %w", name, err)
+	}
+
+	n, err := io.Copy(fw, data)
+	if err != nil {
+		return n, fmt.Errorf("failed to write %s to archive: %w", name, err)
+	}
+
+	return n, nil
+}
+
+// archiveName prefers the name the image was uploaded with and falls back to the storage name.
+func archiveName(image entity.Image) string {
+	name := path.Base(strings.ReplaceAll(image.OriginalName.String, "\\", "/"))
+	if name == "." || name == "/" || name == manifestName {
+		return image.Name
+	}
+	return name
+}
+
+func uniqueArchiveName(names map[string]int, name string) string {
+	n := names[name]
+	names[name] = n + 1
+	if n == 0 {
+		return name
+	}
+
+	extension := path.Ext(name)
+	unique := strings.TrimSuffix(name, extension) + " (" + strconv.Itoa(n) + ")" + extension
+	return uniqueArchiveName(names, unique)
+}
+
+func toArchiveEntry(image entity.Image) dto.ArchiveEntry {
+	return dto.ArchiveEntry{
+		ID:           image.ID,
+		OriginalName: image.OriginalName.String,
+		ContentType:  image.ContentType.String,
+		CreatedAt:    image.CreatedAt,
+	}
+}
+
+func toNullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
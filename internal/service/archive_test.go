@@ -0,0 +1,172 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/fichca/image-loader/internal/dto"
+	"github.com/fichca/image-loader/internal/entity"
+	"github.com/sirupsen/logrus"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// archiveRepo returns images and records the tag it was asked for.
+type archiveRepo struct {
+	imageRepository
+	images []entity.Image
+	tag    string
+}
+
+func (r *archiveRepo) GetAllByUserIdCreatedBetween(ctx context.Context, userID int, from, to sql.NullTime, tag string) ([]entity.Image, error) {
+	r.tag = tag
+	return r.images, nil
+}
+
+// archiveStorage serves objects and counts the ones still open.
+type archiveStorage struct {
+	imageStorage
+	objects map[string][]byte
+
+	mu   sync.Mutex
+	open int
+}
+
+func (s *archiveStorage) GetObject(ctx context.Context, name string) (io.ReadCloser, error) {
+	data, ok := s.objects[name]
+	if !ok {
+		return nil, errors.New("object not found")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.open++
+	return &archiveObjectReader{Reader: bytes.NewReader(data), storage: s}, nil
+}
+
+type archiveObjectReader struct {
+	io.Reader
+	storage *archiveStorage
+}
+
+func (r *archiveObjectReader) Close() error {
+	r.storage.mu.Lock()
+	defer r.storage.mu.Unlock()
+	r.storage.open--
+	return nil
+}
+
+// failingWriter fails once more than n bytes are written.
+type failingWriter struct {
+	n int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		return 0, errInjected
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func newArchiveService(repo *archiveRepo, storage *archiveStorage) *FileService {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	return NewFileService(storage, repo, discardEvents{}, logger, 0, 15*time.Minute, 1, 2)
+}
+
+func archiveImage(id int, name, originalName string) entity.Image {
+	return entity.Image{
+		ID:           id,
+		Name:         name,
+		OriginalName: sql.NullString{String: originalName, Valid: true},
+		CreatedAt:    time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestWriteArchive(t *testing.T) {
+	large := bytes.Repeat([]byte{1}, 3*archivePeekSize+1)
+	repo := &archiveRepo{images: []entity.Image{
+		archiveImage(1, "1.png", "cat.png"),
+		archiveImage(2, "2.png", "missing.png"),
+		archiveImage(3, "3.png", "cat.png"),
+	}}
+	storage := &archiveStorage{objects: map[string][]byte{"1.png": large, "3.png": []byte("small")}}
+
+	var buf bytes.Buffer
+	err := newArchiveService(repo, storage).WriteArchive(context.Background(), 1, dto.ArchiveFilter{Tag: "cats"}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.tag != "cats" {
+		t.Errorf("got tag %q, want %q", repo.tag, "cats")
+	}
+	if storage.open != 0 {
+		t.Errorf("got %d objects left open", storage.open)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := make(map[string][]byte)
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = data
+	}
+
+	if !bytes.Equal(files["cat.png"], large) {
+		t.Errorf("got %d bytes of cat.png, want %d", len(files["cat.png"]), len(large))
+	}
+	if string(files["cat (1).png"]) != "small" {
+		t.Errorf("got cat (1).png %q, want %q", files["cat (1).png"], "small")
+	}
+
+	var manifest []dto.ArchiveEntry
+	err = json.Unmarshal(files[manifestName], &manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest) != 3 {
+		t.Fatalf("got %d manifest entries, want 3", len(manifest))
+	}
+	if manifest[0].Size != int64(len(large)) {
+		t.Errorf("got size %d, want %d", manifest[0].Size, len(large))
+	}
+	if manifest[1].Error == "" || manifest[1].FileName != "" {
+		t.Errorf("got entry %+v for the missing image, want an error and no file", manifest[1])
+	}
+}
+
+func TestWriteArchiveCutShortClosesObjects(t *testing.T) {
+	repo := &archiveRepo{}
+	storage := &archiveStorage{objects: make(map[string][]byte)}
+	for i := 1; i <= 5; i++ {
+		name := string(rune('0'+i)) + ".png"
+		repo.images = append(repo.images, archiveImage(i, name, name))
+		storage.objects[name] = bytes.Repeat([]byte{1}, archivePeekSize)
+	}
+
+	err := newArchiveService(repo, storage).WriteArchive(context.Background(), 1, dto.ArchiveFilter{},
+		&failingWriter{n: archivePeekSize})
+	if !errors.Is(err, errInjected) {
+		t.Fatalf("got error %v, want %v", err, errInjected)
+	}
+	if storage.open != 0 {
+		t.Errorf("got %d objects left open", storage.open)
+	}
+}
@@ -2,7 +2,12 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"github.com/fichca/image-loader/internal/apperr"
 	"github.com/fichca/image-loader/internal/dto"
 	"github.com/fichca/image-loader/internal/entity"
 	"github.com/golang-jwt/jwt/v5"
@@ -10,44 +15,66 @@ import (
 	"time"
 )
 
+var (
+	ErrInvalidCredentials    = apperr.New(apperr.KindUnauthorized, "invalid_credentials", "incorrect login or password")
+	ErrInvalidLinkCode       = apperr.New(apperr.KindValidation, "invalid_link_code", "link code is invalid or expired")
+	ErrTelegramAlreadyLinked = apperr.New(apperr.KindConflict, "telegram_already_linked", "telegram account is already linked")
+	ErrTelegramNotLinked     = apperr.New(apperr.KindNotFound, "telegram_not_linked", "telegram account is not linked")
+	ErrTelegramLinkNotFound  = apperr.New(apperr.KindNotFound, "telegram_link_not_found", "telegram link not found")
+)
+
 type authRepository interface {
+	GetById(ctx context.Context, id int) (entity.User, error)
 	GetUserByLoginAndPassword(ctx context.Context, login, password string) (entity.User, error)
 }
 
 type tgAuthRepo interface {
-	Authorize(ctx context.Context, userID int, telegramID int64) error
+	LinkWithCode(ctx context.Context, code string, telegramID int64) (bool, error)
 	CheckTgAuth(ctx context.Context, tgID int64) (int, error)
+	AddLinkCode(ctx context.Context, code entity.TgLinkCode) error
+	Unlink(ctx context.Context, tgID int64) (bool, error)
+	GetTelegramIDs(ctx context.Context, userID int) ([]int64, error)
+	GetLinksByUserId(ctx context.Context, userID int) ([]entity.TgAuth, error)
+	DeleteLinks(ctx context.Context, userID int, telegramID int64) (int64, error)
 }
 
 type AuthService struct {
-	userRepo   authRepository
-	tgAuthRepo tgAuthRepo
-	jwtKeyword string
+	userRepo    authRepository
+	tgAuthRepo  tgAuthRepo
+	jwtKeyword  string
+	botUsername string
+	linkCodeTTL time.Duration
 }
 
-func NewAuthService(userRepo authRepository, tgAuthRepo tgAuthRepo, jwtKeyword string) *AuthService {
+func NewAuthService(userRepo authRepository, tgAuthRepo tgAuthRepo, jwtKeyword, botUsername string, linkCodeTTL time.Duration) *AuthService {
 	return &AuthService{
-		userRepo:   userRepo,
-		jwtKeyword: jwtKeyword,
-		tgAuthRepo: tgAuthRepo,
+		userRepo:    userRepo,
+		jwtKeyword:  jwtKeyword,
+		tgAuthRepo:  tgAuthRepo,
+		botUsername: botUsername,
+		linkCodeTTL: linkCodeTTL,
 	}
 }
 
+// tokenIssuer is the iss claim of the tokens the service signs.
+const tokenIssuer = "image-loader"
+
+// Authorize checks the credentials and issues a token whose subject is the user's ID.
 func (a *AuthService) Authorize(ctx context.Context, login, password string) (string, error) {
 	user, err := a.userRepo.GetUserByLoginAndPassword(ctx, login, password)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrInvalidCredentials
+	}
 	if err != nil {
 		return "", fmt.Errorf("failed to authorize user: %w", err)
 	}
 	now := time.Now()
-	issuer := fmt.Sprintf("%s %s", login, password)
 	claims := jwt.RegisteredClaims{
-		Issuer:    issuer,
-		Subject:   "authorized",
-		Audience:  []string{"1"},
+		Issuer:    tokenIssuer,
+		Subject:   strconv.FormatInt(user.ID, 10),
 		ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour * 24)),
 		NotBefore: jwt.NewNumericDate(now),
 		IssuedAt:  jwt.NewNumericDate(now),
-		ID:        strconv.Itoa(int(user.ID)),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -59,33 +86,135 @@ func (a *AuthService) Authorize(ctx context.Context, login, password string) (st
 	return tokenString, nil
 }
 
-func (a *AuthService) ValidateUser(ctx context.Context, authUser dto.AuthUserDto) (userID int64, err error) {
-	user, err := a.userRepo.GetUserByLoginAndPassword(ctx, authUser.Login, authUser.Password)
+// ValidateUser checks that the user a token was issued to still exists.
+func (a *AuthService) ValidateUser(ctx context.Context, userID int) error {
+	_, err := a.userRepo.GetById(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUserNotFound
+	}
 	if err != nil {
-		return 0, fmt.Errorf("login and password dosen't match: %w", err)
+		return fmt.Errorf("failed to validate user: %w", err)
 	}
-	return user.ID, nil
+	return nil
 }
 
-func (a *AuthService) AuthorizeTG(ctx context.Context, tgID int64, login, password string) error {
-	user, err := a.userRepo.GetUserByLoginAndPassword(ctx, login, password)
+// IssueTelegramLinkCode creates a one-time code that links the Telegram account it is sent from
+// to the user, together with the bot deep link that sends it.
+func (a *AuthService) IssueTelegramLinkCode(ctx context.Context, userID int) (dto.TelegramLinkCode, error) {
+	b := make([]byte, 12)
+	_, err := rand.Read(b)
 	if err != nil {
-		return err
+		return dto.TelegramLinkCode{}, fmt.Errorf("failed to generate link code: %w", err)
+	}
+
+	code := entity.TgLinkCode{
+		Code:      hex.EncodeToString(b),
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(a.linkCodeTTL),
+	}
+
+	err = a.tgAuthRepo.AddLinkCode(ctx, code)
+	if err != nil {
+		return dto.TelegramLinkCode{}, err
+	}
+
+	result := dto.TelegramLinkCode{
+		Code:      code.Code,
+		ExpiresAt: code.ExpiresAt,
 	}
+	if a.botUsername != "" {
+		result.DeepLink = fmt.Sprintf("https://t.me/%s?start=%s", a.botUsername, code.Code)
+	}
+
+	return result, nil
+}
 
-	_, err = a.ValidateTGUser(ctx, tgID)
+// LinkTelegram consumes the link code and links the Telegram account to the code's user,
+// a code sent from an account that is linked already stays valid.
+func (a *AuthService) LinkTelegram(ctx context.Context, code string, tgID int64) error {
+	_, err := a.ValidateTGUser(ctx, tgID)
 	if err == nil {
+		return ErrTelegramAlreadyLinked
+	}
+
+	linked, err := a.tgAuthRepo.LinkWithCode(ctx, code, tgID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInvalidLinkCode
+	}
+	if err != nil {
+		return err
+	}
+	if !linked {
+		return ErrTelegramAlreadyLinked
+	}
+
+	return nil
+}
+
+// GetTelegramLinks returns the Telegram accounts linked to the user.
+func (a *AuthService) GetTelegramLinks(ctx context.Context, userID int) ([]dto.TelegramLink, error) {
+	links, err := a.tgAuthRepo.GetLinksByUserId(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]dto.TelegramLink, 0, len(links))
+	for _, link := range links {
+		tgLink := dto.TelegramLink{
+			TelegramID: link.TelegramID,
+			LinkedAt:   link.LinkedAt,
+		}
+		if link.LastActiveAt.Valid {
+			lastActiveAt := link.LastActiveAt.Time
+			tgLink.LastActiveAt = &lastActiveAt
+		}
+		result = append(result, tgLink)
+	}
+
+	return result, nil
+}
+
+// DeleteTelegramLink unlinks one of the user's Telegram accounts.
+func (a *AuthService) DeleteTelegramLink(ctx context.Context, userID int, tgID int64) error {
+	if tgID == 0 {
+		return ErrTelegramLinkNotFound
+	}
+
+	n, err := a.tgAuthRepo.DeleteLinks(ctx, userID, tgID)
+	if err != nil {
 		return err
 	}
+	if n == 0 {
+		return ErrTelegramLinkNotFound
+	}
+
+	return nil
+}
+
+// DeleteTelegramLinks unlinks every Telegram account of the user.
+func (a *AuthService) DeleteTelegramLinks(ctx context.Context, userID int) error {
+	_, err := a.tgAuthRepo.DeleteLinks(ctx, userID, 0)
+	return err
+}
 
-	err = a.tgAuthRepo.Authorize(ctx, int(user.ID), tgID)
+// UnlinkTelegram removes the link between the Telegram account and its user.
+func (a *AuthService) UnlinkTelegram(ctx context.Context, tgID int64) error {
+	unlinked, err := a.tgAuthRepo.Unlink(ctx, tgID)
 	if err != nil {
 		return err
 	}
+	if !unlinked {
+		return ErrTelegramNotLinked
+	}
 
 	return nil
 }
 
+// GetTelegramIDs returns the Telegram accounts linked to the user.
+func (a *AuthService) GetTelegramIDs(ctx context.Context, userID int) ([]int64, error) {
+	return a.tgAuthRepo.GetTelegramIDs(ctx, userID)
+}
+
 func (a *AuthService) ValidateTGUser(ctx context.Context, tgID int64) (userID int, err error) {
 	userId, err := a.tgAuthRepo.CheckTgAuth(ctx, tgID)
 	if err != nil {
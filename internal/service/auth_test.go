@@ -0,0 +1,261 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"github.com/fichca/image-loader/internal/entity"
+	"github.com/golang-jwt/jwt/v5"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeAuthRepo struct{}
+
+func (fakeAuthRepo) GetById(ctx context.Context, id int) (entity.User, error) {
+	if id != 5 {
+		return entity.User{}, sql.ErrNoRows
+	}
+	return entity.User{ID: 5, Login: "john"}, nil
+}
+
+func (fakeAuthRepo) GetUserByLoginAndPassword(ctx context.Context, login, password string) (entity.User, error) {
+	if login != "john" || password != "password1" {
+		return entity.User{}, sql.ErrNoRows
+	}
+	return entity.User{ID: 5, Login: login, Password: password}, nil
+}
+
+func TestAuthorizeToken(t *testing.T) {
+	as := NewAuthService(fakeAuthRepo{}, nil, "secret", "", 0)
+
+	token, err := as.Authorize(context.Background(), "john", "password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var claims jwt.RegisteredClaims
+	_, err = jwt.ParseWithClaims(token, &claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte("secret"), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "5" {
+		t.Errorf("got subject %q, want the user ID 5", claims.Subject)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(payload), "password1") || strings.Contains(string(payload), "john") {
+		t.Errorf("the token carries the credentials: %s", payload)
+	}
+
+	err = as.ValidateUser(context.Background(), 5)
+	if err != nil {
+		t.Errorf("got error %v validating the token user", err)
+	}
+}
+
+func TestAuthorizeInvalidCredentials(t *testing.T) {
+	as := NewAuthService(fakeAuthRepo{}, nil, "secret", "", 0)
+
+	_, err := as.Authorize(context.Background(), "john", "wrong")
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("got error %v, want %v", err, ErrInvalidCredentials)
+	}
+}
+
+func TestValidateDeletedUser(t *testing.T) {
+	as := NewAuthService(fakeAuthRepo{}, nil, "secret", "", 0)
+
+	err := as.ValidateUser(context.Background(), 6)
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("got error %v, want %v", err, ErrUserNotFound)
+	}
+}
+
+// fakeTgAuthRepo keeps links like the tg_auth table does, one user per Telegram account and any number of
+// accounts per user. A code is only used up when it links an account, as in TgAuthRepo.LinkWithCode.
+type fakeTgAuthRepo struct {
+	tgAuthRepo
+	codes map[string]entity.TgLinkCode
+	links map[int64]int
+}
+
+func newFakeTgAuthRepo() *fakeTgAuthRepo {
+	return &fakeTgAuthRepo{codes: make(map[string]entity.TgLinkCode), links: make(map[int64]int)}
+}
+
+func (r *fakeTgAuthRepo) AddLinkCode(ctx context.Context, code entity.TgLinkCode) error {
+	r.codes[code.Code] = code
+	return nil
+}
+
+func (r *fakeTgAuthRepo) LinkWithCode(ctx context.Context, code string, telegramID int64) (bool, error) {
+	linkCode, ok := r.codes[code]
+	if !ok || !linkCode.ExpiresAt.After(time.Now()) {
+		return false, sql.ErrNoRows
+	}
+	if _, linked := r.links[telegramID]; linked {
+		return false, nil
+	}
+
+	delete(r.codes, code)
+	r.links[telegramID] = linkCode.UserID
+	return true, nil
+}
+
+func (r *fakeTgAuthRepo) CheckTgAuth(ctx context.Context, tgID int64) (int, error) {
+	userID, ok := r.links[tgID]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return userID, nil
+}
+
+func (r *fakeTgAuthRepo) GetLinksByUserId(ctx context.Context, userID int) ([]entity.TgAuth, error) {
+	links := make([]entity.TgAuth, 0)
+	for tgID, linkedUserID := range r.links {
+		if linkedUserID == userID {
+			links = append(links, entity.TgAuth{UserID: userID, TelegramID: tgID})
+		}
+	}
+	return links, nil
+}
+
+func (r *fakeTgAuthRepo) DeleteLinks(ctx context.Context, userID int, telegramID int64) (int64, error) {
+	var n int64
+	for tgID, linkedUserID := range r.links {
+		if linkedUserID == userID && (telegramID == 0 || tgID == telegramID) {
+			delete(r.links, tgID)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *fakeTgAuthRepo) Unlink(ctx context.Context, tgID int64) (bool, error) {
+	_, ok := r.links[tgID]
+	delete(r.links, tgID)
+	return ok, nil
+}
+
+func issueLinkCode(t *testing.T, as *AuthService, userID int) string {
+	t.Helper()
+
+	code, err := as.IssueTelegramLinkCode(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code.Code
+}
+
+func TestLinkTelegram(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeTgAuthRepo()
+	as := NewAuthService(fakeAuthRepo{}, repo, "secret", "bot", time.Hour)
+
+	err := as.LinkTelegram(ctx, issueLinkCode(t, as, 5), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a user links any number of accounts
+	err = as.LinkTelegram(ctx, issueLinkCode(t, as, 5), 101)
+	if err != nil {
+		t.Fatal(err)
+	}
+	links, err := as.GetTelegramLinks(ctx, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 2 {
+		t.Errorf("got %d links, want 2", len(links))
+	}
+
+	// an account is linked to one user only, the code of another user is kept for another account
+	code := issueLinkCode(t, as, 6)
+	err = as.LinkTelegram(ctx, code, 100)
+	if !errors.Is(err, ErrTelegramAlreadyLinked) {
+		t.Errorf("got error %v linking a linked account, want %v", err, ErrTelegramAlreadyLinked)
+	}
+	if userID, _ := as.ValidateTGUser(ctx, 100); userID != 5 {
+		t.Errorf("got account linked to user %d, want 5", userID)
+	}
+	err = as.LinkTelegram(ctx, code, 102)
+	if err != nil {
+		t.Errorf("got error %v linking with a code kept after a failed link", err)
+	}
+
+	// a code is used once
+	err = as.LinkTelegram(ctx, code, 103)
+	if !errors.Is(err, ErrInvalidLinkCode) {
+		t.Errorf("got error %v reusing a code, want %v", err, ErrInvalidLinkCode)
+	}
+}
+
+func TestLinkTelegramExpiredCode(t *testing.T) {
+	as := NewAuthService(fakeAuthRepo{}, newFakeTgAuthRepo(), "secret", "bot", -time.Minute)
+
+	err := as.LinkTelegram(context.Background(), issueLinkCode(t, as, 5), 100)
+	if !errors.Is(err, ErrInvalidLinkCode) {
+		t.Errorf("got error %v, want %v", err, ErrInvalidLinkCode)
+	}
+}
+
+func TestDeleteTelegramLink(t *testing.T) {
+	tests := []struct {
+		name    string
+		userID  int
+		tgID    int64
+		wantErr error
+	}{
+		{"own link", 5, 100, nil},
+		{"link of another user", 6, 100, ErrTelegramLinkNotFound},
+		{"unknown account", 5, 200, ErrTelegramLinkNotFound},
+		{"no account", 5, 0, ErrTelegramLinkNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeTgAuthRepo()
+			repo.links[100] = 5
+			repo.links[101] = 5
+			as := NewAuthService(fakeAuthRepo{}, repo, "secret", "", time.Hour)
+
+			err := as.DeleteTelegramLink(context.Background(), tt.userID, tt.tgID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+
+			want := 2
+			if tt.wantErr == nil {
+				want = 1
+			}
+			if len(repo.links) != want {
+				t.Errorf("got %d links left, want %d", len(repo.links), want)
+			}
+		})
+	}
+}
+
+func TestUnlinkTelegram(t *testing.T) {
+	repo := newFakeTgAuthRepo()
+	repo.links[100] = 5
+	as := NewAuthService(fakeAuthRepo{}, repo, "secret", "", time.Hour)
+
+	err := as.UnlinkTelegram(context.Background(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = as.UnlinkTelegram(context.Background(), 100)
+	if !errors.Is(err, ErrTelegramNotLinked) {
+		t.Errorf("got error %v unlinking twice, want %v", err, ErrTelegramNotLinked)
+	}
+}
@@ -1,56 +1,472 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"github.com/fichca/image-loader/internal/apperr"
 	"github.com/fichca/image-loader/internal/dto"
 	"github.com/fichca/image-loader/internal/entity"
+	"github.com/fichca/image-loader/internal/event"
 	"github.com/gofrs/uuid"
+	"github.com/sirupsen/logrus"
 	"io"
+	"net/http"
+	"sync"
+	"time"
 )
 
+// sniffLen is the amount of bytes http.DetectContentType looks at.
+const sniffLen = 512
+
+// Images reserved for a direct upload are removed when they are still pending pendingImageGrace
+// after their upload policy expired.
+const (
+	pendingImageGrace    = time.Hour
+	pendingCleanInterval = time.Hour
+	pendingCleanBatch    = 100
+)
+
+var (
+	ErrImageNotFound         = apperr.New(apperr.KindNotFound, "image_not_found", "image not found")
+	ErrImageNotUploaded      = apperr.New(apperr.KindValidation, "image_not_uploaded", "image object was not uploaded")
+	ErrUnsupportedImageType  = apperr.New(apperr.KindUnsupportedMediaType, "unsupported_image_type", "unsupported image type")
+	ErrImageAlreadyCompleted = apperr.New(apperr.KindConflict, "image_already_completed", "image upload is already completed")
+	ErrImageTypeMismatch     = apperr.New(apperr.KindUnsupportedMediaType, "image_type_mismatch", "image content does not match its content type")
+)
+
+// imageExtensions lists the content types accepted as images with the extension their objects get.
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
 type imageStorage interface {
 	PutObject(ctx context.Context, image string, data io.Reader) error
 	GetImageUrls(ctx context.Context, imageNames []string) ([]string, error)
 	GetObjects(ctx context.Context, imageNames []string) ([]io.Reader, error)
+	PresignedPostPolicy(ctx context.Context, name, contentType string, size int64, expires time.Duration) (string, map[string]string, error)
+	StatObject(ctx context.Context, name string) (size int64, exists bool, err error)
+	ReadObjectHead(ctx context.Context, name string, n int64) ([]byte, error)
+	RemoveObject(ctx context.Context, name string) error
+	GetObject(ctx context.Context, name string) (io.ReadCloser, error)
 }
 
 type imageRepository interface {
-	Add(ctx context.Context, modelImage entity.Image) error
+	Add(ctx context.Context, modelImage entity.Image) (int, error)
+	Reserve(ctx context.Context, image entity.Image) (int, error)
+	Finalize(ctx context.Context, image entity.Image) error
+	GetById(ctx context.Context, id int) (entity.Image, error)
+	DeleteById(ctx context.Context, id int) error
+	GetPendingCreatedBefore(ctx context.Context, t time.Time, limit int) ([]entity.Image, error)
+	DeletePending(ctx context.Context, id int) (bool, error)
 	GetAllByUserId(ctx context.Context, userID int) ([]entity.Image, error)
+	GetSummaryByUserId(ctx context.Context, userID int) (entity.ImageSummary, error)
+	GetAllByUserIdCreatedBetween(ctx context.Context, userID int, from, to sql.NullTime, tag string) ([]entity.Image, error)
+	GetPageByUserId(ctx context.Context, userID, cursor int, before bool, limit int) ([]entity.Image, error)
+	SearchByUserId(ctx context.Context, userID int, search string, offset, limit int) ([]entity.Image, error)
+}
+type eventPublisher interface {
+	Publish(ctx context.Context, e event.Event)
 }
+
 type FileService struct {
-	fileStorage     imageStorage
-	imageRepository imageRepository
+	fileStorage      imageStorage
+	imageRepository  imageRepository
+	events           eventPublisher
+	logger           *logrus.Logger
+	maxSize          int64
+	presignExpiry    time.Duration
+	batchConcurrency int
+	archivePrefetch  int
 }
 
-func NewFileService(fileStorage imageStorage, imageRepository imageRepository) *FileService {
+func NewFileService(fileStorage imageStorage, imageRepository imageRepository, events eventPublisher, logger *logrus.Logger,
+	maxSize int64, presignExpiry time.Duration, batchConcurrency, archivePrefetch int) *FileService {
+	if batchConcurrency < 1 {
+		batchConcurrency = 1
+	}
+	if archivePrefetch < 1 {
+		archivePrefetch = 1
+	}
+
 	return &FileService{
-		fileStorage:     fileStorage,
-		imageRepository: imageRepository,
+		fileStorage:      fileStorage,
+		imageRepository:  imageRepository,
+		events:           events,
+		logger:           logger,
+		maxSize:          maxSize,
+		presignExpiry:    presignExpiry,
+		batchConcurrency: batchConcurrency,
+		archivePrefetch:  archivePrefetch,
+	}
+}
+
+// MaxSize returns the largest image accepted, it is 0 when images of any size are accepted.
+func (fs *FileService) MaxSize() int64 {
+	return fs.maxSize
+}
+
+// Run removes the images reserved for direct uploads that were never completed until ctx is done.
+func (fs *FileService) Run(ctx context.Context) {
+	ticker := time.NewTicker(pendingCleanInterval)
+	defer ticker.Stop()
+
+	for {
+		fs.removeAbandoned(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
 }
 
-func (fs *FileService) AddImage(ctx context.Context, image dto.Image) error {
+func (fs *FileService) removeAbandoned(ctx context.Context) {
+	for {
+		images, err := fs.imageRepository.GetPendingCreatedBefore(ctx, time.Now().Add(-fs.presignExpiry-pendingImageGrace),
+			pendingCleanBatch)
+		if err != nil {
+			fs.logger.Error(err)
+			return
+		}
+
+		failed := false
+		for _, image := range images {
+			err = fs.removePending(ctx, image)
+			if err != nil {
+				fs.logger.Error(fmt.Errorf("failed to remove abandoned image %d: %w", image.ID, err))
+				failed = true
+			}
+		}
+
+		// the images that failed would come first again, they are retried on the next tick
+		if failed || len(images) < pendingCleanBatch {
+			return
+		}
+	}
+}
+
+// removePending deletes the reservation before the object, so an upload completed meanwhile is kept.
+func (fs *FileService) removePending(ctx context.Context, image entity.Image) error {
+	deleted, err := fs.imageRepository.DeletePending(ctx, image.ID)
+	if err != nil || !deleted {
+		return err
+	}
+
+	err = fs.fileStorage.RemoveObject(ctx, image.Name)
+	if err != nil {
+		return fmt.Errorf("failed to remove image object: %w", err)
+	}
+	return nil
+}
+
+// AddImage stores the image and returns its id. The object gets the extension of the type detected
+// from the data, whatever the name says, and data that is not an image is rejected with ErrUnsupportedImageType.
+// The image stays pending until its object is stored, so a failed put leaves nothing in the gallery.
+// ImageUploaded is published unless ctx is part of a batch, see withBatch.
+func (fs *FileService) AddImage(ctx context.Context, image dto.Image) (int, error) {
+	contentType, data, err := sniffImage(image.Data)
+	if err != nil {
+		return 0, err
+	}
+	image.Extension = imageExtensions[contentType]
+	image.OriginalName = image.Name
+
 	imageName, err := uuid.NewV4()
 	if err != nil {
-		return fmt.Errorf("failed to generate image name: %w", err)
+		return 0, fmt.Errorf("failed to generate image name: %w", err)
 	}
 	image.Name = imageName.String() + image.Extension
 
-	err = fs.imageRepository.Add(ctx, toImageEntity(image))
+	id, err := fs.imageRepository.Add(ctx, toImageEntity(image))
+	if err != nil {
+		return 0, fmt.Errorf("failed to save image data to db: %w", err)
+	}
+
+	counted := &countingReader{r: data}
+	err = fs.fileStorage.PutObject(ctx, image.Name, counted)
+	if err != nil {
+		// a reservation left behind is removed with the abandoned direct uploads
+		deleteErr := fs.imageRepository.DeleteById(ctx, id)
+		if deleteErr != nil {
+			fs.logger.Error(deleteErr)
+		}
+		return 0, fmt.Errorf("failed to put image to fileStore: %w", err)
+	}
+
+	err = fs.imageRepository.Finalize(ctx, entity.Image{
+		ID:          id,
+		ContentType: sql.NullString{String: contentType, Valid: true},
+		Size:        sql.NullInt64{Int64: counted.n, Valid: true},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if !inBatch(ctx) {
+		fs.events.Publish(ctx, event.Event{Type: event.ImageUploaded, UserID: image.UserID, ImageID: id, ImageName: image.OriginalName})
+	}
+
+	return id, nil
+}
+
+type batchKey struct{}
+
+// withBatch marks the images added with ctx as part of a batch. AddImage publishes no event for them,
+// the batch announces all of them at once with PublishUploaded, so a large zip or import does not
+// flood the subscribers and the event queue.
+func withBatch(ctx context.Context) context.Context {
+	return context.WithValue(ctx, batchKey{}, true)
+}
+
+func inBatch(ctx context.Context) bool {
+	batch, _ := ctx.Value(batchKey{}).(bool)
+	return batch
+}
+
+// PublishUploaded announces the images a batch added: a single one as ImageUploaded and more
+// as one ImagesUploaded event with their number. Failed results are left out.
+func (fs *FileService) PublishUploaded(ctx context.Context, userID int, results []dto.ImageResult) {
+	uploaded := make([]dto.ImageResult, 0, len(results))
+	for _, result := range results {
+		if result.Error == "" {
+			uploaded = append(uploaded, result)
+		}
+	}
+
+	switch len(uploaded) {
+	case 0:
+	case 1:
+		fs.events.Publish(ctx, event.Event{Type: event.ImageUploaded, UserID: userID, ImageID: uploaded[0].ID, ImageName: uploaded[0].Name})
+	default:
+		fs.events.Publish(ctx, event.Event{Type: event.ImagesUploaded, UserID: userID, Count: len(uploaded)})
+	}
+}
+
+// AddImages stores the files with at most batchConcurrency of them in flight.
+// Every file gets its own result in the order the files were given, the stored ones are announced together.
+func (fs *FileService) AddImages(ctx context.Context, userID int, files []dto.ImageFile) []dto.ImageResult {
+	batchCtx := withBatch(ctx)
+	results := make([]dto.ImageResult, len(files))
+	sem := make(chan struct{}, fs.batchConcurrency)
+	wg := sync.WaitGroup{}
+
+	for i := range files {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			results[i] = dto.ImageResult{Name: files[i].Name}
+			id, err := fs.addImageFile(batchCtx, userID, files[i])
+			if err != nil {
+				results[i].Error = err.Error()
+				return
+			}
+			results[i].ID = id
+		}(i)
+	}
+
+	wg.Wait()
+	fs.PublishUploaded(ctx, userID, results)
+
+	return results
+}
+
+func (fs *FileService) addImageFile(ctx context.Context, userID int, file dto.ImageFile) (int, error) {
+	if fs.maxSize > 0 && file.Size > fs.maxSize {
+		return 0, ErrUploadTooLarge
+	}
+
+	data, err := file.Open()
+	if err != nil {
+		return 0, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer data.Close()
+
+	return fs.AddImage(ctx, dto.Image{
+		UserID: userID,
+		Name:   file.Name,
+		Data:   data,
+	})
+}
+
+// sniffImage detects the type of the data from its first bytes and returns the content type of the image
+// with a reader of the whole data. Data that is not an image is rejected with ErrUnsupportedImageType.
+func sniffImage(data io.Reader) (string, io.Reader, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(data, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	head = head[:n]
+
+	contentType := http.DetectContentType(head)
+	if _, ok := imageExtensions[contentType]; !ok {
+		return "", nil, fmt.Errorf("%w: %s", ErrUnsupportedImageType, contentType)
+	}
+
+	return contentType, io.MultiReader(bytes.NewReader(head), data), nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// ReserveUpload creates a pending image and a POST policy that lets the client upload it straight to the storage.
+func (fs *FileService) ReserveUpload(ctx context.Context, upload dto.DirectUpload) (dto.PresignedUpload, error) {
+	extension, ok := imageExtensions[upload.ContentType]
+	if !ok {
+		return dto.PresignedUpload{}, ErrUnsupportedImageType
+	}
+	if upload.Size <= 0 {
+		return dto.PresignedUpload{}, ErrUploadEmpty
+	}
+	if fs.maxSize > 0 && upload.Size > fs.maxSize {
+		return dto.PresignedUpload{}, ErrUploadTooLarge
+	}
+
+	imageName, err := uuid.NewV4()
 	if err != nil {
-		return fmt.Errorf("failed to save image data to db: %w", err)
+		return dto.PresignedUpload{}, fmt.Errorf("failed to generate image name: %w", err)
 	}
+	name := imageName.String() + extension
 
-	err = fs.fileStorage.PutObject(ctx, image.Name, image.Data)
+	id, err := fs.imageRepository.Reserve(ctx, entity.Image{
+		UserID:       upload.UserID,
+		Name:         name,
+		Extension:    extension,
+		ContentType:  sql.NullString{String: upload.ContentType, Valid: true},
+		Size:         sql.NullInt64{Int64: upload.Size, Valid: true},
+		OriginalName: sql.NullString{String: upload.FileName, Valid: upload.FileName != ""},
+	})
 	if err != nil {
-		return fmt.Errorf("failed to put image to fileStore: %w", err)
+		return dto.PresignedUpload{}, fmt.Errorf("failed to reserve image: %w", err)
 	}
 
+	expiresAt := time.Now().Add(fs.presignExpiry)
+	url, fields, err := fs.fileStorage.PresignedPostPolicy(ctx, name, upload.ContentType, upload.Size, fs.presignExpiry)
+	if err != nil {
+		return dto.PresignedUpload{}, fmt.Errorf("failed to presign upload: %w", err)
+	}
+
+	return dto.PresignedUpload{
+		ImageID:   id,
+		URL:       url,
+		Fields:    fields,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// CompleteUpload checks the directly uploaded object and makes the image visible.
+// An object that turns out not to be an image is removed together with its reservation.
+func (fs *FileService) CompleteUpload(ctx context.Context, userID, imageID int) (dto.ImageInfo, error) {
+	image, err := fs.imageRepository.GetById(ctx, imageID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && image.UserID != userID) {
+		return dto.ImageInfo{}, ErrImageNotFound
+	}
+	if err != nil {
+		return dto.ImageInfo{}, err
+	}
+	if image.Status != entity.ImageStatusPending {
+		return dto.ImageInfo{}, ErrImageAlreadyCompleted
+	}
+
+	size, exists, err := fs.fileStorage.StatObject(ctx, image.Name)
+	if err != nil {
+		return dto.ImageInfo{}, fmt.Errorf("failed to stat image object: %w", err)
+	}
+	if !exists {
+		return dto.ImageInfo{}, ErrImageNotUploaded
+	}
+
+	head, err := fs.fileStorage.ReadObjectHead(ctx, image.Name, sniffLen)
+	if err != nil {
+		return dto.ImageInfo{}, fmt.Errorf("failed to read image object: %w", err)
+	}
+
+	contentType := http.DetectContentType(head)
+	if _, ok := imageExtensions[contentType]; !ok {
+		err = fs.discard(ctx, image)
+		if err != nil {
+			return dto.ImageInfo{}, err
+		}
+		return dto.ImageInfo{}, ErrUnsupportedImageType
+	}
+	// the object name carries the extension of the reserved type, another type would be served under it
+	if contentType != image.ContentType.String {
+		err = fs.discard(ctx, image)
+		if err != nil {
+			return dto.ImageInfo{}, err
+		}
+		return dto.ImageInfo{}, fmt.Errorf("%w: reserved %s, uploaded %s", ErrImageTypeMismatch, image.ContentType.String, contentType)
+	}
+
+	image.ContentType = sql.NullString{String: contentType, Valid: true}
+	image.Size = sql.NullInt64{Int64: size, Valid: true}
+
+	err = fs.imageRepository.Finalize(ctx, image)
+	if err != nil {
+		return dto.ImageInfo{}, err
+	}
+
+	fs.events.Publish(ctx, event.Event{Type: event.ImageUploaded, UserID: userID, ImageID: image.ID, ImageName: image.OriginalName.String})
+
+	return dto.ImageInfo{
+		ID:          image.ID,
+		Name:        image.Name,
+		ContentType: contentType,
+		Size:        size,
+	}, nil
+}
+
+// DeleteImage removes the user's image together with its object.
+func (fs *FileService) DeleteImage(ctx context.Context, userID, imageID int) error {
+	image, err := fs.imageRepository.GetById(ctx, imageID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && image.UserID != userID) {
+		return ErrImageNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	err = fs.discard(ctx, image)
+	if err != nil {
+		return err
+	}
+
+	fs.events.Publish(ctx, event.Event{Type: event.ImageDeleted, UserID: userID, ImageID: imageID, ImageName: image.OriginalName.String})
+
 	return nil
 }
 
+func (fs *FileService) discard(ctx context.Context, image entity.Image) error {
+	err := fs.fileStorage.RemoveObject(ctx, image.Name)
+	if err != nil {
+		return fmt.Errorf("failed to remove image object: %w", err)
+	}
+
+	return fs.imageRepository.DeleteById(ctx, image.ID)
+}
+
 func (fs *FileService) GetImageUrlsByUserId(ctx context.Context, userId int) ([]string, error) {
 	images, err := fs.imageRepository.GetAllByUserId(ctx, userId)
 	if err != nil {
@@ -63,6 +479,23 @@ func (fs *FileService) GetImageUrlsByUserId(ctx context.Context, userId int) ([]
 	return urls, nil
 }
 
+// GetImageSummary counts the ready images of the user and their size.
+func (fs *FileService) GetImageSummary(ctx context.Context, userId int) (dto.ImageSummary, error) {
+	summary, err := fs.imageRepository.GetSummaryByUserId(ctx, userId)
+	if err != nil {
+		return dto.ImageSummary{}, err
+	}
+
+	result := dto.ImageSummary{
+		Count:     summary.Count,
+		TotalSize: summary.TotalSize,
+	}
+	if summary.LastAddedAt.Valid {
+		result.LastAddedAt = &summary.LastAddedAt.Time
+	}
+	return result, nil
+}
+
 func (fs *FileService) GetImageObjectsByUserId(ctx context.Context, userId int) ([]io.Reader, error) {
 	images, err := fs.imageRepository.GetAllByUserId(ctx, userId)
 	if err != nil {
@@ -75,6 +508,88 @@ func (fs *FileService) GetImageObjectsByUserId(ctx context.Context, userId int)
 	return imageObjects, nil
 }
 
+// GetImagePage returns up to limit images next to the cursor. Their objects are not opened,
+// GetImageObject opens the ones that are needed.
+func (fs *FileService) GetImagePage(ctx context.Context, userId int, cursor dto.PageCursor, limit int) (dto.ImagePage, error) {
+	images, err := fs.imageRepository.GetPageByUserId(ctx, userId, cursor.ImageID, cursor.Before, limit+1)
+	if err != nil {
+		return dto.ImagePage{}, fmt.Errorf("failed to get images by userID: %w", err)
+	}
+
+	page := dto.ImagePage{}
+	more := len(images) > limit
+	if cursor.Before {
+		if more {
+			images = images[1:]
+		}
+		page.HasPrev, page.HasNext = more, true
+	} else {
+		if more {
+			images = images[:limit]
+		}
+		page.HasPrev, page.HasNext = cursor.ImageID > 0, more
+	}
+
+	for _, image := range images {
+		page.Images = append(page.Images, dto.ImageObject{
+			ID:          image.ID,
+			Name:        image.Name,
+			Description: image.Description.String,
+			Size:        image.Size.Int64,
+		})
+	}
+
+	return page, nil
+}
+
+// SearchImages finds the user's images by title or tag, newest first.
+func (fs *FileService) SearchImages(ctx context.Context, userId int, search string, offset, limit int) ([]dto.Image, error) {
+	images, err := fs.imageRepository.SearchByUserId(ctx, userId, search, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]dto.Image, 0, len(images))
+	for _, image := range images {
+		result = append(result, dto.Image{
+			ID:           image.ID,
+			UserID:       image.UserID,
+			Name:         image.Name,
+			OriginalName: image.OriginalName.String,
+			Description:  image.Description.String,
+			Title:        image.Title.String,
+			Tags:         image.Tags,
+			Extension:    image.Extension,
+		})
+	}
+
+	return result, nil
+}
+
+// GetImageObject opens a ready image of the user, the caller closes its data.
+func (fs *FileService) GetImageObject(ctx context.Context, userId, imageId int) (dto.ImageObject, error) {
+	image, err := fs.imageRepository.GetById(ctx, imageId)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && (image.UserID != userId || image.Status != entity.ImageStatusReady)) {
+		return dto.ImageObject{}, ErrImageNotFound
+	}
+	if err != nil {
+		return dto.ImageObject{}, err
+	}
+
+	object, err := fs.fileStorage.GetObject(ctx, image.Name)
+	if err != nil {
+		return dto.ImageObject{}, fmt.Errorf("failed to get image object: %w", err)
+	}
+
+	return dto.ImageObject{
+		ID:          image.ID,
+		Name:        image.Name,
+		Description: image.Description.String,
+		Size:        image.Size.Int64,
+		Data:        object,
+	}, nil
+}
+
 func getImageNames(images []entity.Image) []string {
 	names := make([]string, 0)
 	for _, image := range images {
@@ -85,9 +600,13 @@ func getImageNames(images []entity.Image) []string {
 
 func toImageEntity(image dto.Image) entity.Image {
 	return entity.Image{
-		ID:        image.ID,
-		UserID:    image.UserID,
-		Name:      image.Name,
-		Extension: image.Extension,
+		ID:           image.ID,
+		UserID:       image.UserID,
+		Name:         image.Name,
+		Extension:    image.Extension,
+		OriginalName: sql.NullString{String: image.OriginalName, Valid: image.OriginalName != ""},
+		Description:  sql.NullString{String: image.Description, Valid: image.Description != ""},
+		Title:        sql.NullString{String: image.Title, Valid: image.Title != ""},
+		Tags:         image.Tags,
 	}
 }
@@ -0,0 +1,600 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/fichca/image-loader/internal/dto"
+	"github.com/fichca/image-loader/internal/entity"
+	"github.com/fichca/image-loader/internal/event"
+	"github.com/sirupsen/logrus"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeImageStorage keeps objects in memory, methods the tests do not reach are left to the embedded nil interface.
+type fakeImageStorage struct {
+	imageStorage
+	mu      sync.Mutex
+	objects map[string][]byte
+	failPut bool
+}
+
+func (s *fakeImageStorage) PutObject(ctx context.Context, name string, data io.Reader) error {
+	if s.failPut {
+		return errInjected
+	}
+	b, err := io.ReadAll(data)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objects[name] = b
+	return err
+}
+
+func (s *fakeImageStorage) PresignedPostPolicy(ctx context.Context, name, contentType string, size int64, expires time.Duration) (string, map[string]string, error) {
+	return "https://storage.example.com/images", map[string]string{"key": name, "Content-Type": contentType}, nil
+}
+
+func (s *fakeImageStorage) StatObject(ctx context.Context, name string) (int64, bool, error) {
+	b, ok := s.objects[name]
+	return int64(len(b)), ok, nil
+}
+
+func (s *fakeImageStorage) ReadObjectHead(ctx context.Context, name string, n int64) ([]byte, error) {
+	b := s.objects[name]
+	if int64(len(b)) > n {
+		b = b[:n]
+	}
+	return b, nil
+}
+
+func (s *fakeImageStorage) RemoveObject(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.objects, name)
+	return nil
+}
+
+type fakeImageRepo struct {
+	imageRepository
+	mu     sync.Mutex
+	images map[int]entity.Image
+}
+
+// Add inserts a pending image like ImageRepo.Add does.
+func (r *fakeImageRepo) Add(ctx context.Context, image entity.Image) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	image.ID = len(r.images) + 1
+	image.Status = entity.ImageStatusPending
+	r.images[image.ID] = image
+	return image.ID, nil
+}
+
+// Reserve inserts a pending image like ImageRepo.Reserve does.
+func (r *fakeImageRepo) Reserve(ctx context.Context, image entity.Image) (int, error) {
+	image.ID = len(r.images) + 1
+	image.Status = entity.ImageStatusPending
+	r.images[image.ID] = image
+	return image.ID, nil
+}
+
+func (r *fakeImageRepo) GetById(ctx context.Context, id int) (entity.Image, error) {
+	image, ok := r.images[id]
+	if !ok {
+		return entity.Image{}, sql.ErrNoRows
+	}
+	return image, nil
+}
+
+// Finalize writes the columns ImageRepo.Finalize writes.
+func (r *fakeImageRepo) Finalize(ctx context.Context, image entity.Image) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := r.images[image.ID]
+	stored.Status, stored.ContentType, stored.Size = entity.ImageStatusReady, image.ContentType, image.Size
+	r.images[image.ID] = stored
+	return nil
+}
+
+// GetSummaryByUserId sums what ImageRepo.GetSummaryByUserId sums.
+func (r *fakeImageRepo) GetSummaryByUserId(ctx context.Context, userID int) (entity.ImageSummary, error) {
+	var summary entity.ImageSummary
+	for _, image := range r.images {
+		if image.UserID == userID && image.Status == entity.ImageStatusReady {
+			summary.Count++
+			summary.TotalSize += image.Size.Int64
+		}
+	}
+	return summary, nil
+}
+
+func (r *fakeImageRepo) DeleteById(ctx context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.images, id)
+	return nil
+}
+
+func (r *fakeImageRepo) GetPendingCreatedBefore(ctx context.Context, t time.Time, limit int) ([]entity.Image, error) {
+	images := make([]entity.Image, 0)
+	for _, image := range r.images {
+		if image.Status == entity.ImageStatusPending && image.CreatedAt.Before(t) && len(images) < limit {
+			images = append(images, image)
+		}
+	}
+	return images, nil
+}
+
+func (r *fakeImageRepo) DeletePending(ctx context.Context, id int) (bool, error) {
+	image, ok := r.images[id]
+	if !ok || image.Status != entity.ImageStatusPending {
+		return false, nil
+	}
+	delete(r.images, id)
+	return true, nil
+}
+
+type discardEvents struct{}
+
+func (discardEvents) Publish(ctx context.Context, e event.Event) {}
+
+type recordedEvents struct {
+	mu     sync.Mutex
+	events []event.Event
+}
+
+func (r *recordedEvents) Publish(ctx context.Context, e event.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, e)
+}
+
+func newTestFileService(images map[int]entity.Image, objects map[string][]byte) *FileService {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	return NewFileService(&fakeImageStorage{objects: objects}, &fakeImageRepo{images: images}, discardEvents{}, logger,
+		100, 15*time.Minute, 1, 1)
+}
+
+func TestAddImageReadyOnlyOnceStored(t *testing.T) {
+	tests := []struct {
+		name    string
+		failPut bool
+	}{
+		{"stored", false},
+		{"put fails", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			images := map[int]entity.Image{}
+			objects := map[string][]byte{}
+			fs := newTestFileService(images, objects)
+			fs.fileStorage.(*fakeImageStorage).failPut = tt.failPut
+
+			id, err := fs.AddImage(context.Background(), dto.Image{UserID: 1, Name: "a.png", Data: bytes.NewReader([]byte("\x89PNG\r\n\x1a\n"))})
+			if tt.failPut {
+				if !errors.Is(err, errInjected) {
+					t.Fatalf("got error %v, want %v", err, errInjected)
+				}
+				if len(images) != 0 {
+					t.Errorf("got %d images after the failed put, want none", len(images))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			image := images[id]
+			if image.Status != entity.ImageStatusReady {
+				t.Errorf("got status %q, want %q", image.Status, entity.ImageStatusReady)
+			}
+			if _, ok := objects[image.Name]; !ok {
+				t.Error("the image object was not stored")
+			}
+		})
+	}
+}
+
+func pendingImage(id int, name, contentType string, createdAt time.Time) entity.Image {
+	return entity.Image{
+		ID:          id,
+		UserID:      1,
+		Name:        name,
+		Status:      entity.ImageStatusPending,
+		ContentType: sql.NullString{String: contentType, Valid: true},
+		CreatedAt:   createdAt,
+	}
+}
+
+func TestReserveUpload(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		size        int64
+		wantErr     error
+	}{
+		{"image", "image/png", 100, nil},
+		{"not an image", "text/html", 100, ErrUnsupportedImageType},
+		{"empty", "image/png", 0, ErrUploadEmpty},
+		{"too large", "image/png", 101, ErrUploadTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			images := map[int]entity.Image{}
+			fs := newTestFileService(images, map[string][]byte{})
+
+			upload, err := fs.ReserveUpload(context.Background(), dto.DirectUpload{UserID: 1, ContentType: tt.contentType, Size: tt.size})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if len(images) != 0 {
+					t.Errorf("got %d images, want none", len(images))
+				}
+				return
+			}
+
+			image := images[upload.ImageID]
+			if image.Status != entity.ImageStatusPending || image.Extension != ".png" {
+				t.Errorf("got status %q and extension %q, want a pending .png", image.Status, image.Extension)
+			}
+			if upload.URL == "" || upload.Fields["key"] != image.Name {
+				t.Errorf("got url %q and fields %v, want a policy for %q", upload.URL, upload.Fields, image.Name)
+			}
+		})
+	}
+}
+
+func TestCompleteUpload(t *testing.T) {
+	ready := pendingImage(1, "a.png", "image/png", time.Now())
+	ready.Status = entity.ImageStatusReady
+
+	tests := []struct {
+		name    string
+		userID  int
+		image   entity.Image
+		data    []byte
+		wantErr error
+	}{
+		{"image", 1, pendingImage(1, "a.png", "image/png", time.Now()), []byte("\x89PNG\r\n\x1a\n"), nil},
+		{"not an image", 1, pendingImage(1, "a.png", "image/png", time.Now()), []byte("<html></html>"), ErrUnsupportedImageType},
+		{"not uploaded", 1, pendingImage(1, "a.png", "image/png", time.Now()), nil, ErrImageNotUploaded},
+		{"another user", 2, pendingImage(1, "a.png", "image/png", time.Now()), []byte("\x89PNG\r\n\x1a\n"), ErrImageNotFound},
+		{"already completed", 1, ready, []byte("\x89PNG\r\n\x1a\n"), ErrImageAlreadyCompleted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			images := map[int]entity.Image{1: tt.image}
+			objects := map[string][]byte{}
+			if tt.data != nil {
+				objects["a.png"] = tt.data
+			}
+			fs := newTestFileService(images, objects)
+
+			info, err := fs.CompleteUpload(context.Background(), tt.userID, 1)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr == ErrUnsupportedImageType {
+				if len(images) != 0 || len(objects) != 0 {
+					t.Errorf("got %d images and %d objects, want the upload discarded", len(images), len(objects))
+				}
+				return
+			}
+			if err != nil {
+				return
+			}
+
+			if info.ContentType != "image/png" || info.Size != int64(len(tt.data)) {
+				t.Errorf("got content type %q and size %d, want image/png and %d", info.ContentType, info.Size, len(tt.data))
+			}
+			if images[1].Status != entity.ImageStatusReady {
+				t.Errorf("got status %q, want %q", images[1].Status, entity.ImageStatusReady)
+			}
+		})
+	}
+}
+
+func imageFile(name string, data []byte) dto.ImageFile {
+	return dto.ImageFile{
+		Name: name,
+		Size: int64(len(data)),
+		Open: func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		},
+	}
+}
+
+func TestAddImages(t *testing.T) {
+	images := map[int]entity.Image{}
+	objects := map[string][]byte{}
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	fs := NewFileService(&fakeImageStorage{objects: objects}, &fakeImageRepo{images: images}, discardEvents{}, logger, 10, 15*time.Minute, 2, 1)
+
+	files := []dto.ImageFile{
+		imageFile("a.PNG", []byte("\x89PNG\r\n\x1a\n")),
+		imageFile("b", []byte("\xff\xd8\xff\xe0")),
+		imageFile("c.gif", []byte("GIF89a-12345")),
+		imageFile("d.png", []byte("GIF89a")),
+		imageFile("e.png", []byte("<html>")),
+	}
+
+	results := fs.AddImages(context.Background(), 1, files)
+
+	if len(results) != len(files) {
+		t.Fatalf("got %d results, want %d", len(results), len(files))
+	}
+	for i, result := range results {
+		if result.Name != files[i].Name {
+			t.Errorf("got result %d for %q, want %q", i, result.Name, files[i].Name)
+		}
+	}
+	if !strings.Contains(results[2].Error, ErrUploadTooLarge.Error()) || results[2].ID != 0 {
+		t.Errorf("got result %+v for the file over the limit, want an error", results[2])
+	}
+	if !strings.Contains(results[4].Error, ErrUnsupportedImageType.Error()) || results[4].ID != 0 {
+		t.Errorf("got result %+v for the file that is not an image, want an error", results[4])
+	}
+
+	wantExtensions := map[string]string{"a.PNG": ".png", "b": ".jpg", "d.png": ".gif"}
+	for _, result := range results {
+		want, ok := wantExtensions[result.Name]
+		if !ok {
+			continue
+		}
+		if result.Error != "" {
+			t.Errorf("got error %q for %q", result.Error, result.Name)
+			continue
+		}
+		image := images[result.ID]
+		if image.Extension != want {
+			t.Errorf("got extension %q for %q, want %q", image.Extension, result.Name, want)
+		}
+		if _, ok := objects[image.Name]; !ok {
+			t.Errorf("the object of %q was not stored", result.Name)
+		}
+	}
+	if len(images) != 3 || len(objects) != 3 {
+		t.Errorf("got %d images and %d objects, want 3", len(images), len(objects))
+	}
+}
+
+func TestAddImageTypeFromContent(t *testing.T) {
+	tests := []struct {
+		name          string
+		fileName      string
+		data          []byte
+		wantExtension string
+		wantErr       error
+	}{
+		{"matching name", "a.png", []byte("\x89PNG\r\n\x1a\n"), ".png", nil},
+		{"misleading name", "a.html", []byte("GIF89a"), ".gif", nil},
+		{"no extension", "photo", []byte("\xff\xd8\xff\xe0"), ".jpg", nil},
+		{"markup named as an image", "a.png", []byte("<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>"), "", ErrUnsupportedImageType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			images := map[int]entity.Image{}
+			objects := map[string][]byte{}
+			fs := newTestFileService(images, objects)
+
+			id, err := fs.AddImage(context.Background(), dto.Image{UserID: 1, Name: tt.fileName, Data: bytes.NewReader(tt.data)})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if len(images) != 0 || len(objects) != 0 {
+					t.Errorf("got %d images and %d objects, want none", len(images), len(objects))
+				}
+				return
+			}
+
+			image := images[id]
+			if image.Extension != tt.wantExtension || !strings.HasSuffix(image.Name, tt.wantExtension) {
+				t.Errorf("got extension %q and object %q, want %q", image.Extension, image.Name, tt.wantExtension)
+			}
+			if image.OriginalName.String != tt.fileName {
+				t.Errorf("got original name %q, want %q", image.OriginalName.String, tt.fileName)
+			}
+		})
+	}
+}
+
+func TestAddImagesPublishesOneEvent(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n")
+
+	tests := []struct {
+		name  string
+		files [][]byte
+		want  []event.Event
+	}{
+		{"single image", [][]byte{png}, []event.Event{{Type: event.ImageUploaded, UserID: 1, ImageID: 1, ImageName: "0.png"}}},
+		{"several images", [][]byte{png, []byte("not an image"), png, png}, []event.Event{{Type: event.ImagesUploaded, UserID: 1, Count: 3}}},
+		{"no image stored", [][]byte{[]byte("not an image")}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newTestFileService(map[int]entity.Image{}, map[string][]byte{})
+			events := &recordedEvents{}
+			fs.events = events
+
+			files := make([]dto.ImageFile, 0, len(tt.files))
+			for i, data := range tt.files {
+				data := data
+				files = append(files, dto.ImageFile{
+					Name: strconv.Itoa(i) + ".png",
+					Size: int64(len(data)),
+					Open: func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(data)), nil },
+				})
+			}
+
+			fs.AddImages(context.Background(), 1, files)
+
+			if len(events.events) != len(tt.want) {
+				t.Fatalf("got events %+v, want %+v", events.events, tt.want)
+			}
+			for i, e := range events.events {
+				e.Source, e.At = "", time.Time{}
+				if e != tt.want[i] {
+					t.Errorf("got event %+v, want %+v", e, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestImageSummaryCountsAddedImages(t *testing.T) {
+	fs := newTestFileService(map[int]entity.Image{}, map[string][]byte{})
+	ctx := context.Background()
+
+	images := []struct {
+		data            []byte
+		wantContentType string
+	}{
+		{append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 2*sniffLen)...), "image/png"},
+		{[]byte("GIF89a"), "image/gif"},
+	}
+
+	var wantSize int64
+	for _, image := range images {
+		id, err := fs.AddImage(ctx, dto.Image{UserID: 1, Name: "image", Data: bytes.NewReader(image.data)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantSize += int64(len(image.data))
+
+		stored := fs.imageRepository.(*fakeImageRepo).images[id]
+		if stored.ContentType.String != image.wantContentType || stored.Size.Int64 != int64(len(image.data)) {
+			t.Errorf("got content type %q and size %d, want %q and %d",
+				stored.ContentType.String, stored.Size.Int64, image.wantContentType, len(image.data))
+		}
+	}
+
+	summary, err := fs.GetImageSummary(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Count != len(images) || summary.TotalSize != wantSize {
+		t.Errorf("got %d images of %d bytes, want %d of %d", summary.Count, summary.TotalSize, len(images), wantSize)
+	}
+}
+
+func TestSniffImage(t *testing.T) {
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{1}, 2*sniffLen)...)
+
+	tests := []struct {
+		name            string
+		data            []byte
+		wantContentType string
+		wantErr         error
+	}{
+		{"png", png, "image/png", nil},
+		{"short gif", []byte("GIF89a"), "image/gif", nil},
+		{"text", []byte("not an image"), "", ErrUnsupportedImageType},
+		{"empty", nil, "", ErrUnsupportedImageType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contentType, r, err := sniffImage(bytes.NewReader(tt.data))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if contentType != tt.wantContentType {
+				t.Errorf("got content type %q, want %q", contentType, tt.wantContentType)
+			}
+
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.data) {
+				t.Errorf("got %d bytes back, want the %d bytes given", len(got), len(tt.data))
+			}
+		})
+	}
+}
+
+func TestCompleteUploadContentType(t *testing.T) {
+	tests := []struct {
+		name     string
+		reserved string
+		data     []byte
+		wantErr  error
+	}{
+		{"reserved type", "image/png", []byte("\x89PNG\r\n\x1a\n"), nil},
+		{"other image type", "image/png", []byte("GIF89a"), ErrImageTypeMismatch},
+		{"not an image", "image/png", []byte("not an image"), ErrUnsupportedImageType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			images := map[int]entity.Image{1: pendingImage(1, "a.png", tt.reserved, time.Now())}
+			objects := map[string][]byte{"a.png": tt.data}
+			fs := newTestFileService(images, objects)
+
+			_, err := fs.CompleteUpload(context.Background(), 1, 1)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+
+			_, kept := objects["a.png"]
+			if kept != (tt.wantErr == nil) {
+				t.Errorf("got object kept %v, want %v", kept, tt.wantErr == nil)
+			}
+			if _, ok := images[1]; ok != (tt.wantErr == nil) {
+				t.Errorf("got image kept %v, want %v", ok, tt.wantErr == nil)
+			}
+		})
+	}
+}
+
+func TestRemoveAbandonedImages(t *testing.T) {
+	old := time.Now().Add(-2 * time.Hour)
+	ready := pendingImage(3, "c.png", "image/png", old)
+	ready.Status = entity.ImageStatusReady
+
+	images := map[int]entity.Image{
+		1: pendingImage(1, "a.png", "image/png", old),
+		2: pendingImage(2, "b.png", "image/png", time.Now()),
+		3: ready,
+	}
+	objects := map[string][]byte{"a.png": {1}, "b.png": {2}, "c.png": {3}}
+
+	newTestFileService(images, objects).removeAbandoned(context.Background())
+
+	if _, ok := images[1]; ok {
+		t.Error("the abandoned image was kept")
+	}
+	if _, ok := objects["a.png"]; ok {
+		t.Error("the object of the abandoned image was kept")
+	}
+	if len(images) != 2 || len(objects) != 2 {
+		t.Errorf("got %d images and %d objects, want the fresh and the ready ones", len(images), len(objects))
+	}
+}
@@ -0,0 +1,284 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/fichca/image-loader/internal/apperr"
+	"github.com/fichca/image-loader/internal/dto"
+	"github.com/fichca/image-loader/internal/entity"
+	"github.com/sirupsen/logrus"
+	"net/url"
+	"path"
+	"sync"
+	"time"
+)
+
+const (
+	importQueueSize    = 100
+	importPollInterval = time.Minute
+	importStaleAfter   = 10 * time.Minute
+)
+
+var (
+	ErrImportJobNotFound = apperr.New(apperr.KindNotFound, "import_job_not_found", "import job not found")
+	ErrInvalidImportURL  = apperr.New(apperr.KindValidation, "invalid_import_url", "invalid import url")
+	ErrTooManyImportURLs = apperr.New(apperr.KindValidation, "too_many_import_urls", "too many import urls")
+)
+
+type importRepository interface {
+	CreateJob(ctx context.Context, userID int, urls []string) (int, error)
+	GetJobById(ctx context.Context, id int) (entity.ImportJob, error)
+	GetItemsByJobId(ctx context.Context, jobID int) ([]entity.ImportItem, error)
+	GetPendingJobIds(ctx context.Context) ([]int, error)
+	ClaimJob(ctx context.Context, id int) (bool, error)
+	ResetStaleJobs(ctx context.Context, staleAfter time.Duration) error
+	UpdateJobStatus(ctx context.Context, id int, status string) error
+	UpdateItem(ctx context.Context, item entity.ImportItem) error
+}
+
+// batchImageAdder adds the images of a job without an event for each and announces them once the job is done.
+type batchImageAdder interface {
+	imageAdder
+	PublishUploaded(ctx context.Context, userID int, results []dto.ImageResult)
+}
+
+type remoteFetcher interface {
+	Fetch(ctx context.Context, url string) ([]byte, error)
+}
+
+// ImportService downloads images from remote urls in background workers.
+// Jobs live in the database, so jobs queued before a restart are picked up again.
+type ImportService struct {
+	repo    importRepository
+	fetcher remoteFetcher
+	images  batchImageAdder
+	logger  *logrus.Logger
+	workers int
+	maxURLs int
+	queue   chan int
+}
+
+func NewImportService(repo importRepository, fetcher remoteFetcher, images batchImageAdder, logger *logrus.Logger, workers, maxURLs int) *ImportService {
+	if workers < 1 {
+		workers = 1
+	}
+
+	return &ImportService{
+		repo:    repo,
+		fetcher: fetcher,
+		images:  images,
+		logger:  logger,
+		workers: workers,
+		maxURLs: maxURLs,
+		queue:   make(chan int, importQueueSize),
+	}
+}
+
+// Run starts the workers and keeps feeding them pending jobs until ctx is done,
+// then it returns once the workers have stopped.
+func (is *ImportService) Run(ctx context.Context) {
+	wg := sync.WaitGroup{}
+	wg.Add(is.workers)
+	for i := 0; i < is.workers; i++ {
+		go func() {
+			defer wg.Done()
+			is.work(ctx)
+		}()
+	}
+	defer wg.Wait()
+
+	ticker := time.NewTicker(importPollInterval)
+	defer ticker.Stop()
+
+	for {
+		is.enqueuePending(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (is *ImportService) CreateJob(ctx context.Context, userID int, urls []string) (dto.ImportJob, error) {
+	if len(urls) == 0 {
+		return dto.ImportJob{}, ErrInvalidImportURL
+	}
+	if is.maxURLs > 0 && len(urls) > is.maxURLs {
+		return dto.ImportJob{}, ErrTooManyImportURLs
+	}
+
+	for _, rawURL := range urls {
+		u, err := url.Parse(rawURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return dto.ImportJob{}, fmt.Errorf("%w: %s", ErrInvalidImportURL, rawURL)
+		}
+	}
+
+	id, err := is.repo.CreateJob(ctx, userID, urls)
+	if err != nil {
+		return dto.ImportJob{}, err
+	}
+
+	select {
+	case is.queue <- id:
+	default:
+		// the queue is full, the job stays pending until the next poll
+	}
+
+	return is.GetJob(ctx, userID, id)
+}
+
+func (is *ImportService) GetJob(ctx context.Context, userID, id int) (dto.ImportJob, error) {
+	job, err := is.repo.GetJobById(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && job.UserID != userID) {
+		return dto.ImportJob{}, ErrImportJobNotFound
+	}
+	if err != nil {
+		return dto.ImportJob{}, err
+	}
+
+	items, err := is.repo.GetItemsByJobId(ctx, id)
+	if err != nil {
+		return dto.ImportJob{}, err
+	}
+
+	return toImportJobDto(job, items), nil
+}
+
+func (is *ImportService) enqueuePending(ctx context.Context) {
+	err := is.repo.ResetStaleJobs(ctx, importStaleAfter)
+	if err != nil {
+		is.logger.Error(err)
+	}
+
+	ids, err := is.repo.GetPendingJobIds(ctx)
+	if err != nil {
+		is.logger.Error(err)
+		return
+	}
+
+	for _, id := range ids {
+		select {
+		case is.queue <- id:
+		default:
+			return
+		}
+	}
+}
+
+func (is *ImportService) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-is.queue:
+			err := is.process(ctx, id)
+			if err != nil {
+				is.logger.Error(fmt.Errorf("failed to process import job %d: %w", id, err))
+			}
+		}
+	}
+}
+
+func (is *ImportService) process(ctx context.Context, id int) error {
+	ok, err := is.repo.ClaimJob(ctx, id)
+	if err != nil || !ok {
+		return err
+	}
+
+	job, err := is.repo.GetJobById(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	items, err := is.repo.GetItemsByJobId(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	status := entity.ImportStatusDone
+	imported := make([]dto.ImageResult, 0, len(items))
+	batchCtx := withBatch(ctx)
+	for _, item := range items {
+		if ctx.Err() != nil {
+			break
+		}
+		if item.Status != entity.ImportStatusPending {
+			continue
+		}
+
+		name := importName(item.URL)
+		imageID, err := is.importURL(batchCtx, job.UserID, name, item.URL)
+		if err != nil {
+			item.Status = entity.ImportStatusFailed
+			item.Error = sql.NullString{String: err.Error(), Valid: true}
+		} else {
+			item.Status = entity.ImportStatusDone
+			item.ImageID = sql.NullInt64{Int64: int64(imageID), Valid: true}
+			imported = append(imported, dto.ImageResult{Name: name, ID: imageID})
+		}
+
+		err = is.repo.UpdateItem(ctx, item)
+		if err != nil {
+			status = entity.ImportStatusFailed
+			is.logger.Error(err)
+		}
+	}
+
+	is.images.PublishUploaded(ctx, job.UserID, imported)
+
+	if ctx.Err() != nil {
+		// the job stays claimed and is picked up again once it is stale
+		return ctx.Err()
+	}
+
+	return is.repo.UpdateJobStatus(ctx, id, status)
+}
+
+func (is *ImportService) importURL(ctx context.Context, userID int, name, rawURL string) (int, error) {
+	data, err := is.fetcher.Fetch(ctx, rawURL)
+	if err != nil {
+		return 0, err
+	}
+
+	return is.images.AddImage(ctx, dto.Image{
+		UserID: userID,
+		Name:   name,
+		Data:   bytes.NewReader(data),
+	})
+}
+
+// importName is the last element of the url path, the name the imported image is added with.
+func importName(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || path.Base(u.Path) == "/" || path.Base(u.Path) == "." {
+		return "image"
+	}
+	return path.Base(u.Path)
+}
+
+func toImportJobDto(job entity.ImportJob, items []entity.ImportItem) dto.ImportJob {
+	result := dto.ImportJob{
+		ID:        job.ID,
+		Status:    job.Status,
+		Items:     make([]dto.ImportItem, 0, len(items)),
+		CreatedAt: job.CreatedAt,
+		UpdatedAt: job.UpdatedAt,
+	}
+
+	for _, item := range items {
+		result.Items = append(result.Items, dto.ImportItem{
+			URL:     item.URL,
+			Status:  item.Status,
+			ImageID: int(item.ImageID.Int64),
+			Error:   item.Error.String,
+		})
+	}
+
+	return result
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingImportRepo has one pending job whose claim lasts until the context is canceled.
+type blockingImportRepo struct {
+	importRepository
+	claimed  chan struct{}
+	finished atomic.Bool
+}
+
+func (r *blockingImportRepo) GetPendingJobIds(ctx context.Context) ([]int, error) {
+	return []int{1}, nil
+}
+
+func (r *blockingImportRepo) ResetStaleJobs(ctx context.Context, staleAfter time.Duration) error {
+	return nil
+}
+
+func (r *blockingImportRepo) ClaimJob(ctx context.Context, id int) (bool, error) {
+	close(r.claimed)
+	<-ctx.Done()
+	time.Sleep(10 * time.Millisecond)
+	r.finished.Store(true)
+	return false, ctx.Err()
+}
+
+func TestImportRunWaitsForWorkers(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	repo := &blockingImportRepo{claimed: make(chan struct{})}
+	is := NewImportService(repo, nil, nil, logger, 1, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		is.Run(ctx)
+		close(done)
+	}()
+
+	<-repo.claimed
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after its context was canceled")
+	}
+	if !repo.finished.Load() {
+		t.Error("Run returned before the worker finished its job")
+	}
+}
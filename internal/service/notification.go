@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/fichca/image-loader/internal/dto"
+	"github.com/fichca/image-loader/internal/entity"
+	"github.com/fichca/image-loader/internal/event"
+)
+
+type notificationRepo interface {
+	GetByUserId(ctx context.Context, userID int) (entity.NotificationSettings, error)
+	Save(ctx context.Context, settings entity.NotificationSettings) error
+}
+
+type NotificationService struct {
+	repo notificationRepo
+}
+
+func NewNotificationService(repo notificationRepo) *NotificationService {
+	return &NotificationService{
+		repo: repo,
+	}
+}
+
+// GetSettings returns the user's notification settings, every notification is on until the user changes it.
+func (n *NotificationService) GetSettings(ctx context.Context, userID int) (dto.NotificationSettings, error) {
+	settings, err := n.repo.GetByUserId(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return dto.NotificationSettings{ImageUploaded: true, ImageDeleted: true, ProfileUpdated: true}, nil
+	}
+	if err != nil {
+		return dto.NotificationSettings{}, err
+	}
+
+	return dto.NotificationSettings{
+		ImageUploaded:  settings.ImageUploaded,
+		ImageDeleted:   settings.ImageDeleted,
+		ProfileUpdated: settings.ProfileUpdated,
+	}, nil
+}
+
+func (n *NotificationService) UpdateSettings(ctx context.Context, userID int, settings dto.NotificationSettings) error {
+	return n.repo.Save(ctx, entity.NotificationSettings{
+		UserID:         userID,
+		ImageUploaded:  settings.ImageUploaded,
+		ImageDeleted:   settings.ImageDeleted,
+		ProfileUpdated: settings.ProfileUpdated,
+	})
+}
+
+// Enabled reports whether the user wants to be notified about events of type t.
+// Password changes cannot be muted, so that users learn about the ones they did not make.
+func (n *NotificationService) Enabled(ctx context.Context, userID int, t event.Type) (bool, error) {
+	if t == event.PasswordChanged {
+		return true, nil
+	}
+
+	settings, err := n.GetSettings(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	enabled, ok := settingFor(&settings, t)
+	return ok && *enabled, nil
+}
+
+// Toggle switches the notifications about events of type t and returns the updated settings.
+func (n *NotificationService) Toggle(ctx context.Context, userID int, t event.Type) (dto.NotificationSettings, error) {
+	settings, err := n.GetSettings(ctx, userID)
+	if err != nil {
+		return dto.NotificationSettings{}, err
+	}
+
+	enabled, ok := settingFor(&settings, t)
+	if !ok {
+		return settings, nil
+	}
+	*enabled = !*enabled
+
+	return settings, n.UpdateSettings(ctx, userID, settings)
+}
+
+func settingFor(settings *dto.NotificationSettings, t event.Type) (*bool, bool) {
+	switch t {
+	case event.ImageUploaded, event.ImagesUploaded:
+		return &settings.ImageUploaded, true
+	case event.ImageDeleted:
+		return &settings.ImageDeleted, true
+	case event.ProfileUpdated:
+		return &settings.ProfileUpdated, true
+	}
+	return nil, false
+}
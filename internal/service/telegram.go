@@ -2,27 +2,314 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"github.com/fichca/image-loader/internal/dto"
+	"github.com/fichca/image-loader/internal/entity"
+	"github.com/fichca/image-loader/internal/event"
+	"github.com/fichca/image-loader/internal/i18n"
 	"io"
+	"strings"
+	"time"
 )
 
 type TelegramService struct {
-	is imageObjectService
+	is            imageObjectService
+	notifications notificationSettings
+	stateRepo     chatStateRepo
+	languageRepo  languageRepo
+	fileIDRepo    fileIDRepo
+	userRepo      userGetter
+	stateTTL      time.Duration
 }
 
 type imageObjectService interface {
-	GetImageObjectsByUserId(ctx context.Context, userId int) ([]io.Reader, error)
+	AddImage(ctx context.Context, image dto.Image) (int, error)
+	GetImagePage(ctx context.Context, userId int, cursor dto.PageCursor, limit int) (dto.ImagePage, error)
+	DeleteImage(ctx context.Context, userID, imageID int) error
+	SearchImages(ctx context.Context, userId int, search string, offset, limit int) ([]dto.Image, error)
+	GetImageObject(ctx context.Context, userId, imageId int) (dto.ImageObject, error)
 }
 
-func NewTelegramService(imageService imageObjectService) *TelegramService {
+type notificationSettings interface {
+	Enabled(ctx context.Context, userID int, t event.Type) (bool, error)
+	GetSettings(ctx context.Context, userID int) (dto.NotificationSettings, error)
+	Toggle(ctx context.Context, userID int, t event.Type) (dto.NotificationSettings, error)
+}
+
+type chatStateRepo interface {
+	Get(ctx context.Context, chatID int64) (entity.TgChatState, error)
+	Save(ctx context.Context, state entity.TgChatState) error
+	Delete(ctx context.Context, chatID int64) error
+}
+
+type languageRepo interface {
+	Get(ctx context.Context, telegramID int64) (entity.TgLanguage, error)
+	Save(ctx context.Context, language entity.TgLanguage) error
+}
+
+type fileIDRepo interface {
+	GetFileIDs(ctx context.Context, imageIDs []int, variant string) (map[int]string, error)
+	Save(ctx context.Context, fileID entity.TgFileID) error
+	DeleteByImageIds(ctx context.Context, imageIDs []int) error
+}
+
+type userGetter interface {
+	GetById(ctx context.Context, id int) (entity.User, error)
+}
+
+func NewTelegramService(imageService imageObjectService, notifications notificationSettings, stateRepo chatStateRepo,
+	languageRepo languageRepo, fileIDRepo fileIDRepo, userRepo userGetter, stateTTL time.Duration) *TelegramService {
 	return &TelegramService{
-		is: imageService,
+		is:            imageService,
+		notifications: notifications,
+		stateRepo:     stateRepo,
+		languageRepo:  languageRepo,
+		fileIDRepo:    fileIDRepo,
+		userRepo:      userRepo,
+		stateTTL:      stateTTL,
 	}
 }
 
-func (t *TelegramService) GetImageObjects(ctx context.Context, userId int) ([]io.Reader, error) {
-	objects, err := t.is.GetImageObjectsByUserId(ctx, userId)
+// GetImagePage returns a page of the user's images ready to be sent as photos. Images Telegram already has
+// carry their file_id, only the others are downloaded and the caller has to close their data.
+func (t *TelegramService) GetImagePage(ctx context.Context, userId int, cursor dto.PageCursor, limit int) (dto.ImagePage, error) {
+	page, err := t.is.GetImagePage(ctx, userId, cursor, limit)
+	if err != nil {
+		return dto.ImagePage{}, err
+	}
+
+	fileIDs, err := t.fileIDRepo.GetFileIDs(ctx, imageIDs(page.Images), entity.TgFileVariantPhoto)
+	if err != nil {
+		return dto.ImagePage{}, err
+	}
+
+	for i := range page.Images {
+		page.Images[i].FileID = fileIDs[page.Images[i].ID]
+	}
+
+	err = t.OpenImageObjects(ctx, userId, page.Images)
+	if err != nil {
+		return dto.ImagePage{}, err
+	}
+
+	return page, nil
+}
+
+// OpenImageObjects opens the data of the images that have no file_id and fills in their names,
+// on failure nothing is left open.
+func (t *TelegramService) OpenImageObjects(ctx context.Context, userId int, images []dto.ImageObject) error {
+	for i := range images {
+		if images[i].FileID != "" || images[i].Data != nil {
+			continue
+		}
+
+		object, err := t.is.GetImageObject(ctx, userId, images[i].ID)
+		if err != nil {
+			for _, image := range images[:i] {
+				if image.Data != nil {
+					image.Data.Close()
+				}
+			}
+			return err
+		}
+		images[i].Name, images[i].Data = object.Name, object.Data
+	}
+
+	return nil
+}
+
+// InvalidateFileIDs forgets the file_ids of the images, for example when Telegram no longer accepts them.
+func (t *TelegramService) InvalidateFileIDs(ctx context.Context, imageIds []int) error {
+	return t.fileIDRepo.DeleteByImageIds(ctx, imageIds)
+}
+
+// AddImage stores an image received by the bot, the caption becomes the image description
+// and gives the image its title and tags. The name only becomes the original name of the image,
+// its type is detected from the data and data that is not an image fails with ErrUnsupportedImageType.
+func (t *TelegramService) AddImage(ctx context.Context, userId int, name, caption string, data io.Reader) (int, error) {
+	title, tags := parseCaption(caption)
+
+	return t.is.AddImage(event.WithSource(ctx, event.SourceTelegram), dto.Image{
+		UserID:      userId,
+		Name:        name,
+		Description: caption,
+		Title:       title,
+		Tags:        tags,
+		Data:        data,
+	})
+}
+
+// parseCaption splits a caption into its hashtags and the title made of the other words,
+// "#cat on the sofa #Home" has the title "on the sofa" and the tags "cat" and "home".
+func parseCaption(caption string) (string, []string) {
+	words := strings.Fields(caption)
+	title := make([]string, 0, len(words))
+	tags := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, word := range words {
+		if len(word) < 2 || word[0] != '#' {
+			title = append(title, word)
+			continue
+		}
+
+		tag := strings.ToLower(word[1:])
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	return strings.Join(title, " "), tags
+}
+
+func (t *TelegramService) DeleteImage(ctx context.Context, userId, imageId int) error {
+	return t.is.DeleteImage(event.WithSource(ctx, event.SourceTelegram), userId, imageId)
+}
+
+// GetPreview returns the image to attach to a notification, by its file_id when Telegram has it
+// and opened otherwise.
+func (t *TelegramService) GetPreview(ctx context.Context, userId, imageId int) (dto.ImageObject, error) {
+	fileIDs, err := t.fileIDRepo.GetFileIDs(ctx, []int{imageId}, entity.TgFileVariantPhoto)
+	if err != nil {
+		return dto.ImageObject{}, err
+	}
+	if fileID, ok := fileIDs[imageId]; ok {
+		return dto.ImageObject{ID: imageId, FileID: fileID}, nil
+	}
+
+	return t.is.GetImageObject(ctx, userId, imageId)
+}
+
+func (t *TelegramService) NotificationEnabled(ctx context.Context, userId int, eventType event.Type) (bool, error) {
+	return t.notifications.Enabled(ctx, userId, eventType)
+}
+
+func (t *TelegramService) GetNotificationSettings(ctx context.Context, userId int) (dto.NotificationSettings, error) {
+	return t.notifications.GetSettings(ctx, userId)
+}
+
+func (t *TelegramService) ToggleNotification(ctx context.Context, userId int, eventType event.Type) (dto.NotificationSettings, error) {
+	return t.notifications.Toggle(ctx, userId, eventType)
+}
+
+// SearchImages finds the user's images for an inline query together with their cached file_ids.
+func (t *TelegramService) SearchImages(ctx context.Context, userId int, search string, offset, limit int) ([]dto.InlineImage, error) {
+	images, err := t.is.SearchImages(ctx, userId, search, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(images))
+	for _, image := range images {
+		ids = append(ids, image.ID)
+	}
+
+	fileIDs, err := t.fileIDRepo.GetFileIDs(ctx, ids, entity.TgFileVariantPhoto)
 	if err != nil {
 		return nil, err
 	}
-	return objects, nil
+
+	result := make([]dto.InlineImage, 0, len(images))
+	for _, image := range images {
+		title := image.Title
+		if title == "" {
+			title = image.OriginalName
+		}
+		if title == "" {
+			title = image.Name
+		}
+		result = append(result, dto.InlineImage{
+			ID:          image.ID,
+			Title:       title,
+			Description: image.Description,
+			FileID:      fileIDs[image.ID],
+		})
+	}
+
+	return result, nil
+}
+
+func (t *TelegramService) GetImageObject(ctx context.Context, userId, imageId int) (dto.ImageObject, error) {
+	return t.is.GetImageObject(ctx, userId, imageId)
+}
+
+// SaveFileID remembers the file_id Telegram assigned to the image.
+func (t *TelegramService) SaveFileID(ctx context.Context, imageId int, fileId string) error {
+	return t.fileIDRepo.Save(ctx, entity.TgFileID{ImageID: imageId, Variant: entity.TgFileVariantPhoto, FileID: fileId})
+}
+
+func imageIDs(images []dto.ImageObject) []int {
+	ids := make([]int, 0, len(images))
+	for _, image := range images {
+		ids = append(ids, image.ID)
+	}
+	return ids
+}
+
+func (t *TelegramService) GetUserLogin(ctx context.Context, userId int) (string, error) {
+	user, err := t.userRepo.GetById(ctx, userId)
+	if err != nil {
+		return "", err
+	}
+	return user.Login, nil
+}
+
+// GetChatState returns the flow the chat is in. A flow abandoned for longer than the state timeout
+// is dropped and returned once more with Expired set, so the bot can tell the user about it.
+func (t *TelegramService) GetChatState(ctx context.Context, chatId int64) (dto.ChatState, error) {
+	state, err := t.stateRepo.Get(ctx, chatId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return dto.ChatState{}, nil
+	}
+	if err != nil {
+		return dto.ChatState{}, err
+	}
+
+	result := dto.ChatState{State: state.State, Data: state.Data}
+	if t.stateTTL > 0 && time.Since(state.UpdatedAt) > t.stateTTL {
+		err = t.stateRepo.Delete(ctx, chatId)
+		if err != nil {
+			return dto.ChatState{}, err
+		}
+		result.Expired = true
+	}
+
+	return result, nil
+}
+
+func (t *TelegramService) SetChatState(ctx context.Context, chatId int64, state dto.ChatState) error {
+	if state.State == "" {
+		return t.stateRepo.Delete(ctx, chatId)
+	}
+
+	return t.stateRepo.Save(ctx, entity.TgChatState{
+		ChatID:    chatId,
+		State:     state.State,
+		Data:      state.Data,
+		UpdatedAt: time.Now(),
+	})
+}
+
+// GetLanguage returns the language the Telegram user chose for the bot, ok is false when they have not chosen one.
+func (t *TelegramService) GetLanguage(ctx context.Context, tgId int64) (lang i18n.Lang, ok bool, err error) {
+	language, err := t.languageRepo.Get(ctx, tgId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	lang, ok = i18n.Parse(language.Language)
+	return lang, ok, nil
+}
+
+func (t *TelegramService) SetLanguage(ctx context.Context, tgId int64, lang i18n.Lang) error {
+	return t.languageRepo.Save(ctx, entity.TgLanguage{
+		TelegramID: tgId,
+		Language:   string(lang),
+		UpdatedAt:  time.Now(),
+	})
 }
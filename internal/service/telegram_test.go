@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"github.com/fichca/image-loader/internal/dto"
+	"github.com/fichca/image-loader/internal/entity"
+	"reflect"
+	"testing"
+)
+
+// searchImageService finds the images it holds, methods the tests do not reach are left to the embedded nil interface.
+type searchImageService struct {
+	imageObjectService
+	images []dto.Image
+}
+
+func (s *searchImageService) SearchImages(ctx context.Context, userId int, search string, offset, limit int) ([]dto.Image, error) {
+	return s.images, nil
+}
+
+// fakeFileIDRepo keeps the file_ids of photos only.
+type fakeFileIDRepo struct {
+	fileIDRepo
+	fileIDs map[int]string
+}
+
+func (r *fakeFileIDRepo) GetFileIDs(ctx context.Context, imageIDs []int, variant string) (map[int]string, error) {
+	fileIDs := make(map[int]string)
+	if variant != entity.TgFileVariantPhoto {
+		return fileIDs, nil
+	}
+	for _, id := range imageIDs {
+		if fileID, ok := r.fileIDs[id]; ok {
+			fileIDs[id] = fileID
+		}
+	}
+	return fileIDs, nil
+}
+
+func TestSearchImages(t *testing.T) {
+	images := &searchImageService{images: []dto.Image{
+		{ID: 1, Name: "0b9a.png", OriginalName: "cat.png", Description: "cat"},
+		{ID: 2, Name: "5f1c.jpg"},
+	}}
+	fileIDs := &fakeFileIDRepo{fileIDs: map[int]string{1: "cached-file"}}
+	ts := NewTelegramService(images, nil, nil, nil, fileIDs, nil, 0)
+
+	found, err := ts.SearchImages(context.Background(), 1, "cat", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []dto.InlineImage{
+		{ID: 1, Title: "cat.png", Description: "cat", FileID: "cached-file"},
+		{ID: 2, Title: "5f1c.jpg"},
+	}
+	if len(found) != len(want) {
+		t.Fatalf("got %+v, want %+v", found, want)
+	}
+	for i := range want {
+		if found[i] != want[i] {
+			t.Errorf("got %+v, want %+v", found[i], want[i])
+		}
+	}
+}
+
+func TestParseCaption(t *testing.T) {
+	tests := []struct {
+		caption   string
+		wantTitle string
+		wantTags  []string
+	}{
+		{"", "", []string{}},
+		{"sunset at the sea", "sunset at the sea", []string{}},
+		{"#cat on the sofa #Home", "on the sofa", []string{"cat", "home"}},
+		{"#cat #CAT\n#dog", "", []string{"cat", "dog"}},
+		{"price # 5 and c#sharp", "price # 5 and c#sharp", []string{}},
+		{"#котик  спит", "спит", []string{"котик"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.caption, func(t *testing.T) {
+			title, tags := parseCaption(tt.caption)
+			if title != tt.wantTitle {
+				t.Errorf("got title %q, want %q", title, tt.wantTitle)
+			}
+			if !reflect.DeepEqual(tags, tt.wantTags) {
+				t.Errorf("got tags %q, want %q", tags, tt.wantTags)
+			}
+		})
+	}
+}
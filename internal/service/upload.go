@@ -0,0 +1,400 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/fichca/image-loader/internal/apperr"
+	"github.com/fichca/image-loader/internal/dto"
+	"github.com/fichca/image-loader/internal/entity"
+	"github.com/gofrs/uuid"
+	"github.com/sirupsen/logrus"
+	"io"
+	"time"
+)
+
+// minPartSize is the smallest part S3-compatible storages accept for every part except the last one.
+const minPartSize = 5 << 20
+
+const (
+	uploadExpireInterval = time.Hour
+	uploadExpireBatch    = 100
+)
+
+var (
+	ErrUploadNotFound       = apperr.New(apperr.KindNotFound, "upload_not_found", "upload not found")
+	ErrUploadOffsetMismatch = apperr.New(apperr.KindConflict, "upload_offset_mismatch", "upload offset mismatch")
+	ErrUploadTooLarge       = apperr.New(apperr.KindTooLarge, "upload_too_large", "upload exceeds maximum size")
+	ErrUploadEmpty          = apperr.New(apperr.KindValidation, "upload_empty", "upload length must be positive")
+)
+
+type uploadStorage interface {
+	PutObject(ctx context.Context, image string, data io.Reader) error
+	GetObject(ctx context.Context, name string) (io.ReadCloser, error)
+	RemoveObject(ctx context.Context, name string) error
+	NewMultipartUpload(ctx context.Context, name string) (string, error)
+	PutObjectPart(ctx context.Context, name, uploadID string, partNumber int, data io.Reader, size int64) error
+	CompleteMultipartUpload(ctx context.Context, name, uploadID string) error
+	AbortMultipartUpload(ctx context.Context, name, uploadID string) error
+}
+
+type uploadRepository interface {
+	Add(ctx context.Context, upload entity.Upload) error
+	GetById(ctx context.Context, id string) (entity.Upload, error)
+	UpdateProgress(ctx context.Context, upload entity.Upload, prevOffset int64) (bool, error)
+	MarkAssembled(ctx context.Context, id string) error
+	SetImage(ctx context.Context, id string, imageID int) error
+	GetCreatedBefore(ctx context.Context, t time.Time, limit int) ([]entity.Upload, error)
+	DeleteById(ctx context.Context, id string) error
+}
+
+type imageAdder interface {
+	AddImage(ctx context.Context, image dto.Image) (int, error)
+}
+
+// UploadService keeps resumable uploads in storage multipart uploads until they are complete
+// and then hands the assembled file to the regular image processing.
+// Uploads that are not finished within ttl of their creation are removed by Run.
+type UploadService struct {
+	storage  uploadStorage
+	repo     uploadRepository
+	images   imageAdder
+	logger   *logrus.Logger
+	partSize int64
+	maxSize  int64
+	ttl      time.Duration
+}
+
+func NewUploadService(storage uploadStorage, repo uploadRepository, images imageAdder, logger *logrus.Logger,
+	partSize, maxSize int64, ttl time.Duration) *UploadService {
+	if partSize < minPartSize {
+		partSize = minPartSize
+	}
+
+	return &UploadService{
+		storage:  storage,
+		repo:     repo,
+		images:   images,
+		logger:   logger,
+		partSize: partSize,
+		maxSize:  maxSize,
+		ttl:      ttl,
+	}
+}
+
+// Run removes expired uploads until ctx is done.
+func (us *UploadService) Run(ctx context.Context) {
+	ticker := time.NewTicker(uploadExpireInterval)
+	defer ticker.Stop()
+
+	for {
+		us.expire(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (us *UploadService) expire(ctx context.Context) {
+	for {
+		uploads, err := us.repo.GetCreatedBefore(ctx, time.Now().Add(-us.ttl), uploadExpireBatch)
+		if err != nil {
+			us.logger.Error(err)
+			return
+		}
+
+		failed := false
+		for _, upload := range uploads {
+			err = us.remove(ctx, upload)
+			if err != nil {
+				us.logger.Error(fmt.Errorf("failed to expire upload %s: %w", upload.ID, err))
+				failed = true
+			}
+		}
+
+		// the uploads that failed would come first again, they are retried on the next tick
+		if failed || len(uploads) < uploadExpireBatch {
+			return
+		}
+	}
+}
+
+func (us *UploadService) MaxSize() int64 {
+	return us.maxSize
+}
+
+func (us *UploadService) CreateUpload(ctx context.Context, upload dto.Upload) (dto.Upload, error) {
+	if upload.Length <= 0 {
+		return dto.Upload{}, ErrUploadEmpty
+	}
+	if us.maxSize > 0 && upload.Length > us.maxSize {
+		return dto.Upload{}, ErrUploadTooLarge
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return dto.Upload{}, fmt.Errorf("failed to generate upload id: %w", err)
+	}
+	upload.ID = id.String()
+	objectName := uploadObjectName(upload.ID)
+
+	multipartID, err := us.storage.NewMultipartUpload(ctx, objectName)
+	if err != nil {
+		return dto.Upload{}, fmt.Errorf("failed to start multipart upload: %w", err)
+	}
+
+	err = us.repo.Add(ctx, entity.Upload{
+		ID:          upload.ID,
+		UserID:      upload.UserID,
+		ObjectName:  objectName,
+		MultipartID: multipartID,
+		Length:      upload.Length,
+		FileName:    upload.FileName,
+		Metadata:    upload.Metadata,
+	})
+	if err != nil {
+		return dto.Upload{}, fmt.Errorf("failed to save upload: %w", err)
+	}
+
+	return upload, nil
+}
+
+func (us *UploadService) GetUpload(ctx context.Context, userID int, id string) (dto.Upload, error) {
+	upload, err := us.getOwned(ctx, userID, id)
+	if err != nil {
+		return dto.Upload{}, err
+	}
+
+	return toUploadDto(upload), nil
+}
+
+// WriteChunk appends data at offset and returns the new offset. Whatever was received before
+// the data stream broke is kept, so the client can resume from the returned offset.
+func (us *UploadService) WriteChunk(ctx context.Context, userID int, id string, offset int64, data io.Reader) (int64, error) {
+	upload, err := us.getOwned(ctx, userID, id)
+	if err != nil {
+		return 0, err
+	}
+	if upload.Offset != offset {
+		return upload.Offset, ErrUploadOffsetMismatch
+	}
+	if upload.Assembled {
+		// an earlier request sent the last chunk but failed to finish, the chunk is in the object already
+		err = us.finish(ctx, upload)
+		if err != nil {
+			return upload.Offset, err
+		}
+		return upload.Length, nil
+	}
+
+	prevOffset := upload.Offset
+	hadTail := upload.TailSize > 0
+	reader := io.LimitReader(data, upload.Length-upload.Offset)
+
+	if hadTail {
+		tail, err := us.storage.GetObject(ctx, tailObjectName(upload.ObjectName))
+		if err != nil {
+			return upload.Offset, fmt.Errorf("failed to get upload tail: %w", err)
+		}
+		defer tail.Close()
+		reader = io.MultiReader(tail, reader)
+	}
+
+	start := upload.Offset - upload.TailSize
+	buf := make([]byte, us.partSize)
+
+	for {
+		n, readErr := io.ReadFull(reader, buf)
+		if n == 0 {
+			break
+		}
+		end := start + int64(n)
+
+		if int64(n) == us.partSize || end == upload.Length {
+			upload.PartCount++
+			err = us.storage.PutObjectPart(ctx, upload.ObjectName, upload.MultipartID, upload.PartCount, bytes.NewReader(buf[:n]), int64(n))
+			if err != nil {
+				return prevOffset, fmt.Errorf("failed to put upload part: %w", err)
+			}
+			upload.TailSize = 0
+		} else {
+			err = us.storage.PutObject(ctx, tailObjectName(upload.ObjectName), bytes.NewReader(buf[:n]))
+			if err != nil {
+				return prevOffset, fmt.Errorf("failed to put upload tail: %w", err)
+			}
+			upload.TailSize = int64(n)
+		}
+
+		upload.Offset = end
+		start = end - upload.TailSize
+		if readErr != nil {
+			break
+		}
+	}
+
+	// The offset of the last chunk is never stored, a client that was told of a failed finish
+	// sends the chunk again and the parts it already put are overwritten.
+	if upload.Offset == upload.Length {
+		err = us.finish(ctx, upload)
+		if err != nil {
+			return prevOffset, err
+		}
+		return upload.Offset, nil
+	}
+
+	if upload.Offset != prevOffset {
+		ok, err := us.repo.UpdateProgress(ctx, upload, prevOffset)
+		if err != nil {
+			return prevOffset, err
+		}
+		if !ok {
+			return prevOffset, ErrUploadOffsetMismatch
+		}
+	}
+
+	if hadTail && upload.TailSize == 0 {
+		err = us.storage.RemoveObject(ctx, tailObjectName(upload.ObjectName))
+		if err != nil {
+			return upload.Offset, fmt.Errorf("failed to remove upload tail: %w", err)
+		}
+	}
+
+	return upload.Offset, nil
+}
+
+func (us *UploadService) Terminate(ctx context.Context, userID int, id string) error {
+	upload, err := us.getOwned(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+
+	return us.remove(ctx, upload)
+}
+
+// remove drops the upload with whatever it has put into the storage.
+func (us *UploadService) remove(ctx context.Context, upload entity.Upload) error {
+	if upload.Assembled {
+		err := us.storage.RemoveObject(ctx, upload.ObjectName)
+		if err != nil {
+			return fmt.Errorf("failed to remove uploaded object: %w", err)
+		}
+	} else {
+		err := us.storage.AbortMultipartUpload(ctx, upload.ObjectName, upload.MultipartID)
+		if err != nil {
+			return fmt.Errorf("failed to abort multipart upload: %w", err)
+		}
+	}
+
+	if upload.TailSize > 0 {
+		err := us.storage.RemoveObject(ctx, tailObjectName(upload.ObjectName))
+		if err != nil {
+			return fmt.Errorf("failed to remove upload tail: %w", err)
+		}
+	}
+
+	return us.repo.DeleteById(ctx, upload.ID)
+}
+
+// finish assembles the parts and makes an image of them. Every step is recorded once it is done,
+// so a finish that failed halfway is retried from the failed step and never adds the image twice.
+// An upload that turns out not to be an image is removed.
+func (us *UploadService) finish(ctx context.Context, upload entity.Upload) error {
+	if !upload.Assembled {
+		err := us.storage.CompleteMultipartUpload(ctx, upload.ObjectName, upload.MultipartID)
+		if err != nil {
+			return fmt.Errorf("failed to complete multipart upload: %w", err)
+		}
+
+		err = us.repo.MarkAssembled(ctx, upload.ID)
+		if err != nil {
+			return err
+		}
+		upload.Assembled = true
+	}
+
+	if !upload.ImageID.Valid {
+		err := us.addImage(ctx, upload)
+		if errors.Is(err, ErrUnsupportedImageType) {
+			// retrying cannot change the content, the upload is dropped with its object
+			removeErr := us.remove(ctx, upload)
+			if removeErr != nil {
+				us.logger.Error(fmt.Errorf("failed to remove upload %s of an unsupported type: %w", upload.ID, removeErr))
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	err := us.storage.RemoveObject(ctx, upload.ObjectName)
+	if err != nil {
+		return fmt.Errorf("failed to remove uploaded object: %w", err)
+	}
+
+	// the last chunk may have taken the tail into a part without its removal being stored
+	err = us.storage.RemoveObject(ctx, tailObjectName(upload.ObjectName))
+	if err != nil {
+		return fmt.Errorf("failed to remove upload tail: %w", err)
+	}
+
+	return us.repo.DeleteById(ctx, upload.ID)
+}
+
+func (us *UploadService) addImage(ctx context.Context, upload entity.Upload) error {
+	object, err := us.storage.GetObject(ctx, upload.ObjectName)
+	if err != nil {
+		return fmt.Errorf("failed to get uploaded object: %w", err)
+	}
+	defer object.Close()
+
+	imageID, err := us.images.AddImage(ctx, dto.Image{
+		UserID: upload.UserID,
+		Name:   upload.FileName,
+		Data:   object,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to process uploaded image: %w", err)
+	}
+
+	return us.repo.SetImage(ctx, upload.ID, imageID)
+}
+
+func (us *UploadService) getOwned(ctx context.Context, userID int, id string) (entity.Upload, error) {
+	upload, err := us.repo.GetById(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity.Upload{}, ErrUploadNotFound
+	}
+	if err != nil {
+		return entity.Upload{}, err
+	}
+	if upload.UserID != userID {
+		return entity.Upload{}, ErrUploadNotFound
+	}
+
+	return upload, nil
+}
+
+func uploadObjectName(id string) string {
+	return "uploads/" + id
+}
+
+func tailObjectName(objectName string) string {
+	return objectName + ".tail"
+}
+
+func toUploadDto(upload entity.Upload) dto.Upload {
+	return dto.Upload{
+		ID:       upload.ID,
+		UserID:   upload.UserID,
+		Length:   upload.Length,
+		Offset:   upload.Offset,
+		FileName: upload.FileName,
+		Metadata: upload.Metadata,
+	}
+}
@@ -0,0 +1,461 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/fichca/image-loader/internal/dto"
+	"github.com/fichca/image-loader/internal/entity"
+	"github.com/sirupsen/logrus"
+	"io"
+	"sort"
+	"testing"
+	"time"
+)
+
+var errInjected = errors.New("injected failure")
+
+// fakeUploadStorage keeps objects and multipart uploads in memory, every multipart upload
+// of an object has the object's name as its id.
+type fakeUploadStorage struct {
+	objects      map[string][]byte
+	parts        map[string]map[int][]byte
+	completes    int
+	failComplete bool
+}
+
+func newFakeUploadStorage() *fakeUploadStorage {
+	return &fakeUploadStorage{objects: map[string][]byte{}, parts: map[string]map[int][]byte{}}
+}
+
+func (s *fakeUploadStorage) PutObject(ctx context.Context, name string, data io.Reader) error {
+	b, err := io.ReadAll(data)
+	s.objects[name] = b
+	return err
+}
+
+func (s *fakeUploadStorage) GetObject(ctx context.Context, name string) (io.ReadCloser, error) {
+	b, ok := s.objects[name]
+	if !ok {
+		return nil, errors.New("no such object")
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (s *fakeUploadStorage) RemoveObject(ctx context.Context, name string) error {
+	delete(s.objects, name)
+	return nil
+}
+
+func (s *fakeUploadStorage) NewMultipartUpload(ctx context.Context, name string) (string, error) {
+	s.parts[name] = map[int][]byte{}
+	return name, nil
+}
+
+func (s *fakeUploadStorage) PutObjectPart(ctx context.Context, name, uploadID string, partNumber int, data io.Reader, size int64) error {
+	parts, ok := s.parts[uploadID]
+	if !ok {
+		return errors.New("no such upload")
+	}
+	b, err := io.ReadAll(data)
+	parts[partNumber] = b
+	return err
+}
+
+func (s *fakeUploadStorage) CompleteMultipartUpload(ctx context.Context, name, uploadID string) error {
+	if s.failComplete {
+		return errInjected
+	}
+	parts, ok := s.parts[uploadID]
+	if !ok {
+		return errors.New("no such upload")
+	}
+
+	numbers := make([]int, 0, len(parts))
+	for n := range parts {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+
+	var object []byte
+	for _, n := range numbers {
+		object = append(object, parts[n]...)
+	}
+	s.objects[name] = object
+	delete(s.parts, uploadID)
+	s.completes++
+	return nil
+}
+
+func (s *fakeUploadStorage) AbortMultipartUpload(ctx context.Context, name, uploadID string) error {
+	if _, ok := s.parts[uploadID]; !ok {
+		return errors.New("no such upload")
+	}
+	delete(s.parts, uploadID)
+	return nil
+}
+
+type fakeUploadRepo struct {
+	uploads map[string]entity.Upload
+}
+
+func (r *fakeUploadRepo) Add(ctx context.Context, upload entity.Upload) error {
+	upload.CreatedAt = time.Now()
+	r.uploads[upload.ID] = upload
+	return nil
+}
+
+func (r *fakeUploadRepo) GetById(ctx context.Context, id string) (entity.Upload, error) {
+	upload, ok := r.uploads[id]
+	if !ok {
+		return entity.Upload{}, sql.ErrNoRows
+	}
+	return upload, nil
+}
+
+func (r *fakeUploadRepo) UpdateProgress(ctx context.Context, upload entity.Upload, prevOffset int64) (bool, error) {
+	if r.uploads[upload.ID].Offset != prevOffset {
+		return false, nil
+	}
+	r.uploads[upload.ID] = upload
+	return true, nil
+}
+
+func (r *fakeUploadRepo) MarkAssembled(ctx context.Context, id string) error {
+	upload := r.uploads[id]
+	upload.Assembled = true
+	r.uploads[id] = upload
+	return nil
+}
+
+func (r *fakeUploadRepo) SetImage(ctx context.Context, id string, imageID int) error {
+	upload := r.uploads[id]
+	upload.ImageID = sql.NullInt64{Int64: int64(imageID), Valid: true}
+	r.uploads[id] = upload
+	return nil
+}
+
+func (r *fakeUploadRepo) GetCreatedBefore(ctx context.Context, t time.Time, limit int) ([]entity.Upload, error) {
+	uploads := make([]entity.Upload, 0)
+	for _, upload := range r.uploads {
+		if upload.CreatedAt.Before(t) && len(uploads) < limit {
+			uploads = append(uploads, upload)
+		}
+	}
+	return uploads, nil
+}
+
+func (r *fakeUploadRepo) DeleteById(ctx context.Context, id string) error {
+	delete(r.uploads, id)
+	return nil
+}
+
+// fakeImageAdder records the data of every image it adds, it fails while fail is set and rejects
+// data that is not an image like FileService.AddImage does.
+type fakeImageAdder struct {
+	images [][]byte
+	fail   bool
+}
+
+func (a *fakeImageAdder) AddImage(ctx context.Context, image dto.Image) (int, error) {
+	if a.fail {
+		return 0, errInjected
+	}
+	_, data, err := sniffImage(image.Data)
+	if err != nil {
+		return 0, err
+	}
+	b, err := io.ReadAll(data)
+	if err != nil {
+		return 0, err
+	}
+	a.images = append(a.images, b)
+	return len(a.images), nil
+}
+
+func newTestUploadService() (*UploadService, *fakeUploadStorage, *fakeUploadRepo, *fakeImageAdder) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	storage := newFakeUploadStorage()
+	repo := &fakeUploadRepo{uploads: map[string]entity.Upload{}}
+	images := &fakeImageAdder{}
+	return NewUploadService(storage, repo, images, logger, minPartSize, 0, time.Hour), storage, repo, images
+}
+
+func TestWriteChunkAssemblesParts(t *testing.T) {
+	data := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte("image"), minPartSize/2)...)
+	// the chunks end inside the first part, inside the second one and at the end of the upload
+	chunks := []int64{minPartSize / 3, minPartSize + 7, int64(len(data))}
+
+	tests := []struct {
+		name   string
+		chunks []int64
+	}{
+		{"one chunk", chunks[2:]},
+		{"chunks across parts", chunks},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			us, storage, repo, images := newTestUploadService()
+			ctx := context.Background()
+
+			upload, err := us.CreateUpload(ctx, dto.Upload{UserID: 1, Length: int64(len(data)), FileName: "a.png"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var offset int64
+			for _, end := range tt.chunks {
+				offset, err = us.WriteChunk(ctx, 1, upload.ID, offset, bytes.NewReader(data[offset:end]))
+				if err != nil || offset != end {
+					t.Fatalf("got offset %d and error %v, want %d", offset, err, end)
+				}
+			}
+
+			if len(images.images) != 1 || !bytes.Equal(images.images[0], data) {
+				t.Fatalf("got %d images, want one with the uploaded data", len(images.images))
+			}
+			if len(repo.uploads) != 0 || len(storage.objects) != 0 || len(storage.parts) != 0 {
+				t.Errorf("got %d uploads, %d objects and %d multipart uploads left",
+					len(repo.uploads), len(storage.objects), len(storage.parts))
+			}
+		})
+	}
+}
+
+func TestWriteChunkOffsetMismatch(t *testing.T) {
+	us, _, _, _ := newTestUploadService()
+	ctx := context.Background()
+
+	upload, err := us.CreateUpload(ctx, dto.Upload{UserID: 1, Length: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = us.WriteChunk(ctx, 1, upload.ID, 0, bytes.NewReader([]byte("12345")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offset, err := us.WriteChunk(ctx, 1, upload.ID, 3, bytes.NewReader([]byte("45")))
+	if !errors.Is(err, ErrUploadOffsetMismatch) {
+		t.Errorf("got error %v, want %v", err, ErrUploadOffsetMismatch)
+	}
+	if offset != 5 {
+		t.Errorf("got offset %d, want the stored offset 5", offset)
+	}
+}
+
+func TestUploadOfAnotherUser(t *testing.T) {
+	us, _, _, _ := newTestUploadService()
+	ctx := context.Background()
+
+	upload, err := us.CreateUpload(ctx, dto.Upload{UserID: 1, Length: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = us.GetUpload(ctx, 2, upload.ID)
+	if !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("got error %v getting the upload, want %v", err, ErrUploadNotFound)
+	}
+	_, err = us.WriteChunk(ctx, 2, upload.ID, 0, bytes.NewReader([]byte("12345")))
+	if !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("got error %v writing the upload, want %v", err, ErrUploadNotFound)
+	}
+	err = us.Terminate(ctx, 2, upload.ID)
+	if !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("got error %v terminating the upload, want %v", err, ErrUploadNotFound)
+	}
+}
+
+func TestCreateUploadLength(t *testing.T) {
+	tests := []struct {
+		name    string
+		length  int64
+		maxSize int64
+		wantErr error
+	}{
+		{"empty", 0, 0, ErrUploadEmpty},
+		{"unlimited", 1 << 30, 0, nil},
+		{"largest", 100, 100, nil},
+		{"too large", 101, 100, ErrUploadTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := logrus.New()
+			logger.SetOutput(io.Discard)
+
+			repo := &fakeUploadRepo{uploads: map[string]entity.Upload{}}
+			us := NewUploadService(newFakeUploadStorage(), repo, &fakeImageAdder{}, logger, minPartSize, tt.maxSize, time.Hour)
+
+			_, err := us.CreateUpload(context.Background(), dto.Upload{UserID: 1, Length: tt.length})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTerminateRemovesUpload(t *testing.T) {
+	us, storage, repo, _ := newTestUploadService()
+	ctx := context.Background()
+
+	upload, err := us.CreateUpload(ctx, dto.Upload{UserID: 1, Length: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = us.WriteChunk(ctx, 1, upload.ID, 0, bytes.NewReader([]byte("12345")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = us.Terminate(ctx, 1, upload.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(repo.uploads) != 0 || len(storage.objects) != 0 || len(storage.parts) != 0 {
+		t.Errorf("got %d uploads, %d objects and %d multipart uploads left",
+			len(repo.uploads), len(storage.objects), len(storage.parts))
+	}
+}
+
+func TestWriteChunkRetriesFailedFinish(t *testing.T) {
+	data := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte("image"), minPartSize/4)...)
+	half := int64(len(data) / 2)
+
+	tests := []struct {
+		name          string
+		fail          func(storage *fakeUploadStorage, images *fakeImageAdder, fail bool)
+		wantAssembled bool
+	}{
+		{
+			name: "assembling fails",
+			fail: func(storage *fakeUploadStorage, images *fakeImageAdder, fail bool) {
+				storage.failComplete = fail
+			},
+		},
+		{
+			name: "adding the image fails",
+			fail: func(storage *fakeUploadStorage, images *fakeImageAdder, fail bool) {
+				images.fail = fail
+			},
+			wantAssembled: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			us, storage, repo, images := newTestUploadService()
+			ctx := context.Background()
+
+			upload, err := us.CreateUpload(ctx, dto.Upload{UserID: 1, Length: int64(len(data)), FileName: "a.png"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			offset, err := us.WriteChunk(ctx, 1, upload.ID, 0, bytes.NewReader(data[:half]))
+			if err != nil || offset != half {
+				t.Fatalf("got offset %d and error %v, want %d", offset, err, half)
+			}
+
+			tt.fail(storage, images, true)
+			offset, err = us.WriteChunk(ctx, 1, upload.ID, half, bytes.NewReader(data[half:]))
+			if !errors.Is(err, errInjected) {
+				t.Fatalf("got error %v, want %v", err, errInjected)
+			}
+			if offset != half {
+				t.Errorf("got offset %d after the failed finish, want %d", offset, half)
+			}
+
+			stored, err := us.GetUpload(ctx, 1, upload.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Offset != half {
+				t.Errorf("got stored offset %d, want %d until the upload is finished", stored.Offset, half)
+			}
+			if got := repo.uploads[upload.ID].Assembled; got != tt.wantAssembled {
+				t.Errorf("got assembled %v, want %v", got, tt.wantAssembled)
+			}
+
+			tt.fail(storage, images, false)
+			offset, err = us.WriteChunk(ctx, 1, upload.ID, half, bytes.NewReader(data[half:]))
+			if err != nil || offset != int64(len(data)) {
+				t.Fatalf("got offset %d and error %v on retry, want %d", offset, err, len(data))
+			}
+
+			if storage.completes != 1 {
+				t.Errorf("the parts were assembled %d times", storage.completes)
+			}
+			if len(images.images) != 1 || !bytes.Equal(images.images[0], data) {
+				t.Fatalf("got %d images, want one with the uploaded data", len(images.images))
+			}
+			if len(repo.uploads) != 0 || len(storage.objects) != 0 {
+				t.Errorf("got %d uploads and %d objects left", len(repo.uploads), len(storage.objects))
+			}
+		})
+	}
+}
+
+func TestWriteChunkRemovesUploadOfOtherType(t *testing.T) {
+	us, storage, repo, images := newTestUploadService()
+	ctx := context.Background()
+	data := []byte("<html><script>alert(1)</script></html>")
+
+	upload, err := us.CreateUpload(ctx, dto.Upload{UserID: 1, Length: int64(len(data)), FileName: "a.png"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = us.WriteChunk(ctx, 1, upload.ID, 0, bytes.NewReader(data))
+	if !errors.Is(err, ErrUnsupportedImageType) {
+		t.Fatalf("got error %v, want %v", err, ErrUnsupportedImageType)
+	}
+
+	if len(images.images) != 0 {
+		t.Errorf("got %d images, want none", len(images.images))
+	}
+	if len(repo.uploads) != 0 || len(storage.objects) != 0 || len(storage.parts) != 0 {
+		t.Errorf("got %d uploads, %d objects and %d multipart uploads left, want the upload removed",
+			len(repo.uploads), len(storage.objects), len(storage.parts))
+	}
+}
+
+func TestExpireUploads(t *testing.T) {
+	us, storage, repo, _ := newTestUploadService()
+	ctx := context.Background()
+
+	expired, err := us.CreateUpload(ctx, dto.Upload{UserID: 1, Length: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = us.WriteChunk(ctx, 1, expired.ID, 0, bytes.NewReader([]byte("12345")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := repo.uploads[expired.ID]
+	old.CreatedAt = time.Now().Add(-2 * time.Hour)
+	repo.uploads[expired.ID] = old
+
+	fresh, err := us.CreateUpload(ctx, dto.Upload{UserID: 1, Length: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	us.expire(ctx)
+
+	if _, ok := repo.uploads[expired.ID]; ok {
+		t.Error("the expired upload was kept")
+	}
+	if _, ok := repo.uploads[fresh.ID]; !ok {
+		t.Error("the fresh upload was removed")
+	}
+	if len(storage.objects) != 0 || len(storage.parts) != 1 {
+		t.Errorf("got %d objects and %d multipart uploads, want only the fresh multipart upload",
+			len(storage.objects), len(storage.parts))
+	}
+}
@@ -1,34 +1,55 @@
 package service
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/fichca/image-loader/internal/apperr"
 	"github.com/fichca/image-loader/internal/dto"
 	"github.com/fichca/image-loader/internal/entity"
-	"github.com/jinzhu/copier"
+	"github.com/fichca/image-loader/internal/event"
+	"github.com/fichca/image-loader/internal/mergepatch"
+	"github.com/fichca/image-loader/internal/validate"
 )
 
+var (
+	ErrUserNotFound  = apperr.New(apperr.KindNotFound, "user_not_found", "user not found")
+	ErrForbidden     = apperr.New(apperr.KindForbidden, "forbidden", "users can only change their own account")
+	ErrWrongPassword = apperr.New(apperr.KindForbidden, "wrong_password", "current password does not match")
+	ErrInvalidCursor = apperr.New(apperr.KindValidation, "invalid_cursor", "invalid page cursor")
+)
+
+const codeInvalidPatch = "invalid_patch"
+
 type userRepository interface {
 	Add(ctx context.Context, user entity.User) error
 	GetById(ctx context.Context, id int) (entity.User, error)
-	Update(ctx context.Context, user entity.User) error
-	DeleteById(ctx context.Context, id int) error
-	GetAll(ctx context.Context) ([]entity.User, error)
+	UpdateProfile(ctx context.Context, user entity.User) (bool, error)
+	UpdatePassword(ctx context.Context, id int, current, password string) (bool, error)
+	DeleteById(ctx context.Context, id int) (bool, error)
+	GetPage(ctx context.Context, query entity.UserQuery) ([]entity.User, error)
+	Count(ctx context.Context, search string) (int, error)
 }
 
 type imageService interface {
 	GetImageUrlsByUserId(ctx context.Context, userId int) ([]string, error)
+	GetImageSummary(ctx context.Context, userId int) (dto.ImageSummary, error)
 }
 
 type UserService struct {
-	repo userRepository
-	is   imageService
+	repo   userRepository
+	is     imageService
+	events eventPublisher
 }
 
-func NewUserService(repo userRepository, imageService imageService) *UserService {
+func NewUserService(repo userRepository, imageService imageService, events eventPublisher) *UserService {
 	return &UserService{
-		repo: repo,
-		is:   imageService,
+		repo:   repo,
+		is:     imageService,
+		events: events,
 	}
 }
 
@@ -36,8 +57,12 @@ func (u *UserService) Add(ctx context.Context, user dto.UserDto) error {
 	return u.repo.Add(ctx, toUserEntity(user))
 }
 
+// GetById returns the user as its owner sees it.
 func (u *UserService) GetById(ctx context.Context, id int) (dto.UserResponse, error) {
 	user, err := u.repo.GetById(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return dto.UserResponse{}, ErrUserNotFound
+	}
 	if err != nil {
 		return dto.UserResponse{}, err
 	}
@@ -48,28 +73,248 @@ func (u *UserService) GetById(ctx context.Context, id int) (dto.UserResponse, er
 	return toUserResponse(user, urls), err
 }
 
-func (u *UserService) Update(ctx context.Context, user dto.UserDto) error {
-	return u.repo.Update(ctx, toUserEntity(user))
+// GetPublicById returns what other users may see of the user.
+func (u *UserService) GetPublicById(ctx context.Context, id int) (dto.PublicUser, error) {
+	user, err := u.repo.GetById(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return dto.PublicUser{}, ErrUserNotFound
+	}
+	if err != nil {
+		return dto.PublicUser{}, err
+	}
+	return toPublicUser(user), nil
 }
 
-func (u *UserService) DeleteById(ctx context.Context, id int) error {
-	return u.repo.DeleteById(ctx, id)
+// GetMe returns the profile of the user userID with a summary of its images.
+func (u *UserService) GetMe(ctx context.Context, userID int) (dto.Me, error) {
+	user, err := u.repo.GetById(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return dto.Me{}, ErrUserNotFound
+	}
+	if err != nil {
+		return dto.Me{}, err
+	}
+
+	images, err := u.is.GetImageSummary(ctx, userID)
+	if err != nil {
+		return dto.Me{}, err
+	}
+
+	return dto.Me{
+		ID:          user.ID,
+		Name:        user.Name,
+		Login:       user.Login,
+		Description: user.Description.String,
+		Images:      images,
+	}, nil
 }
 
-func (u *UserService) GetAll(ctx context.Context) ([]dto.UserDto, error) {
-	users := make([]dto.UserDto, 0)
+// Update overwrites the account of the user userID with user, which must be that account.
+// The password is kept, it is changed by ChangePassword only.
+func (u *UserService) Update(ctx context.Context, userID int, user dto.UserUpdate) error {
+	if int(user.ID) != userID {
+		return ErrForbidden
+	}
 
-	allUsersEntity, err := u.repo.GetAll(ctx)
+	updated, err := u.repo.UpdateProfile(ctx, entity.User{
+		ID:          user.ID,
+		Name:        user.Name,
+		Login:       user.Login,
+		Description: sql.NullString{String: user.Description, Valid: true},
+	})
 	if err != nil {
-		return users, err
+		return err
 	}
+	if !updated {
+		return ErrUserNotFound
+	}
+
+	u.events.Publish(ctx, event.Event{Type: event.ProfileUpdated, UserID: int(user.ID)})
 
-	err = copier.Copy(&users, &allUsersEntity)
+	return nil
+}
+
+// Patch applies the JSON merge patch to the profile of the account id on behalf of the user userID.
+// The password is not part of the profile and is changed by ChangePassword only.
+func (u *UserService) Patch(ctx context.Context, userID, id int, patch []byte) error {
+	if id != userID {
+		return ErrForbidden
+	}
+
+	user, err := u.repo.GetById(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	doc, err := json.Marshal(toUserProfile(user))
+	if err != nil {
+		return err
+	}
+
+	doc, err = mergepatch.Apply(doc, patch)
 	if err != nil {
-		return users, err
+		return apperr.Wrap(apperr.KindValidation, codeInvalidPatch, err)
 	}
 
-	return users, nil
+	var profile dto.UserProfile
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&profile)
+	if err != nil {
+		return apperr.Wrap(apperr.KindValidation, codeInvalidPatch, err)
+	}
+
+	err = validate.Struct(profile)
+	if err != nil {
+		return err
+	}
+
+	user.Name = profile.Name
+	user.Login = profile.Login
+	user.Description = sql.NullString{}
+	if profile.Description != nil {
+		user.Description = sql.NullString{String: *profile.Description, Valid: true}
+	}
+
+	updated, err := u.repo.UpdateProfile(ctx, user)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return ErrUserNotFound
+	}
+
+	u.events.Publish(ctx, event.Event{Type: event.ProfileUpdated, UserID: id})
+
+	return nil
+}
+
+// ChangePassword replaces the password of the account id on behalf of the user userID,
+// the current password has to be given.
+func (u *UserService) ChangePassword(ctx context.Context, userID, id int, change dto.PasswordChange) error {
+	if id != userID {
+		return ErrForbidden
+	}
+
+	_, err := u.repo.GetById(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	updated, err := u.repo.UpdatePassword(ctx, id, change.CurrentPassword, change.NewPassword)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return ErrWrongPassword
+	}
+
+	u.events.Publish(ctx, event.Event{Type: event.PasswordChanged, UserID: id})
+
+	return nil
+}
+
+// DeleteById deletes the account id on behalf of the user userID, users can only delete their own account.
+func (u *UserService) DeleteById(ctx context.Context, userID, id int) error {
+	if id != userID {
+		return ErrForbidden
+	}
+
+	deleted, err := u.repo.DeleteById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// userCursor is where a page of users continues, it is sent to clients base64 encoded.
+type userCursor struct {
+	Sort string `json:"s"`
+	Desc bool   `json:"d,omitempty"`
+	Name string `json:"n,omitempty"`
+	ID   int64  `json:"i"`
+}
+
+// GetPage returns the users of the query and the cursor of the next page.
+func (u *UserService) GetPage(ctx context.Context, query dto.UserQuery) (dto.UserPage, error) {
+	q := entity.UserQuery{
+		Search: query.Search,
+		Sort:   query.Sort,
+		Desc:   query.Desc,
+		Limit:  query.Limit + 1,
+	}
+
+	if query.Cursor != "" {
+		cursor, err := decodeUserCursor(query.Cursor)
+		if err != nil || cursor.Sort != query.Sort || cursor.Desc != query.Desc {
+			return dto.UserPage{}, ErrInvalidCursor
+		}
+		q.AfterName, q.AfterID = cursor.Name, cursor.ID
+	}
+
+	users, err := u.repo.GetPage(ctx, q)
+	if err != nil {
+		return dto.UserPage{}, err
+	}
+
+	page := dto.UserPage{Users: make([]dto.PublicUser, 0, len(users))}
+	if len(users) > query.Limit {
+		users = users[:query.Limit]
+
+		last := users[len(users)-1]
+		cursor := userCursor{Sort: query.Sort, Desc: query.Desc, ID: last.ID}
+		if query.Sort == "name" {
+			cursor.Name = last.Name
+		}
+		page.NextCursor, err = encodeUserCursor(cursor)
+		if err != nil {
+			return dto.UserPage{}, err
+		}
+	}
+
+	for _, user := range users {
+		page.Users = append(page.Users, toPublicUser(user))
+	}
+
+	if query.Count {
+		total, err := u.repo.Count(ctx, query.Search)
+		if err != nil {
+			return dto.UserPage{}, err
+		}
+		page.Total = &total
+	}
+
+	return page, nil
+}
+
+func encodeUserCursor(cursor userCursor) (string, error) {
+	b, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeUserCursor(s string) (userCursor, error) {
+	var cursor userCursor
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, err
+	}
+
+	err = json.Unmarshal(b, &cursor)
+	return cursor, err
 }
 
 func toUserResponse(user entity.User, ImageUrls []string) dto.UserResponse {
@@ -77,12 +322,30 @@ func toUserResponse(user entity.User, ImageUrls []string) dto.UserResponse {
 		ID:          user.ID,
 		Name:        user.Name,
 		Login:       user.Login,
-		Password:    user.Password,
 		Description: user.Description.String,
 		ImageUrls:   ImageUrls,
 	}
 }
 
+func toPublicUser(user entity.User) dto.PublicUser {
+	return dto.PublicUser{
+		ID:          user.ID,
+		Name:        user.Name,
+		Description: user.Description.String,
+	}
+}
+
+func toUserProfile(user entity.User) dto.UserProfile {
+	profile := dto.UserProfile{
+		Name:  user.Name,
+		Login: user.Login,
+	}
+	if user.Description.Valid {
+		profile.Description = &user.Description.String
+	}
+	return profile
+}
+
 func toUserEntity(user dto.UserDto) entity.User {
 	return entity.User{
 		ID:       user.ID,
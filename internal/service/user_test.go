@@ -0,0 +1,365 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/fichca/image-loader/internal/dto"
+	"github.com/fichca/image-loader/internal/entity"
+	"github.com/fichca/image-loader/internal/event"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeUserRepo pages over users in memory like UserRepo does in SQL. Methods the tests do not
+// reach are left to the embedded nil interface.
+type fakeUserRepo struct {
+	userRepository
+	users []entity.User
+}
+
+func (r *fakeUserRepo) found(search string) []entity.User {
+	users := make([]entity.User, 0, len(r.users))
+	for _, user := range r.users {
+		if strings.HasPrefix(strings.ToLower(user.Name), strings.ToLower(search)) || user.Login == search {
+			users = append(users, user)
+		}
+	}
+	return users
+}
+
+func (r *fakeUserRepo) GetPage(ctx context.Context, query entity.UserQuery) ([]entity.User, error) {
+	less := func(a, b entity.User) bool {
+		if query.Sort == "name" && a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.ID < b.ID
+	}
+	if query.Desc {
+		asc := less
+		less = func(a, b entity.User) bool { return asc(b, a) }
+	}
+
+	users := r.found(query.Search)
+	sort.Slice(users, func(i, j int) bool { return less(users[i], users[j]) })
+
+	after := entity.User{ID: query.AfterID, Name: query.AfterName}
+	page := make([]entity.User, 0, query.Limit)
+	for _, user := range users {
+		if query.AfterID > 0 && !less(after, user) {
+			continue
+		}
+		if len(page) == query.Limit {
+			break
+		}
+		page = append(page, user)
+	}
+	return page, nil
+}
+
+func (r *fakeUserRepo) Count(ctx context.Context, search string) (int, error) {
+	return len(r.found(search)), nil
+}
+
+func (r *fakeUserRepo) GetById(ctx context.Context, id int) (entity.User, error) {
+	for _, user := range r.users {
+		if user.ID == int64(id) {
+			return user, nil
+		}
+	}
+	return entity.User{}, sql.ErrNoRows
+}
+
+// UpdateProfile writes the columns UserRepo.UpdateProfile writes.
+func (r *fakeUserRepo) UpdateProfile(ctx context.Context, user entity.User) (bool, error) {
+	for i := range r.users {
+		if r.users[i].ID == user.ID {
+			r.users[i].Name, r.users[i].Login, r.users[i].Description = user.Name, user.Login, user.Description
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *fakeUserRepo) UpdatePassword(ctx context.Context, id int, current, password string) (bool, error) {
+	for i := range r.users {
+		if r.users[i].ID == int64(id) && r.users[i].Password == current {
+			r.users[i].Password = password
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func newPagingService() *UserService {
+	return NewUserService(&fakeUserRepo{users: []entity.User{
+		{ID: 1, Name: "bob", Login: "bob1"},
+		{ID: 2, Name: "alice", Login: "wonderland"},
+		{ID: 3, Name: "Bob", Login: "bobby"},
+		{ID: 4, Name: "carol", Login: "carol"},
+		{ID: 5, Name: "bob", Login: "bob5"},
+	}}, nil, nil)
+}
+
+// summaryImages answers every user with the same image summary.
+type summaryImages struct {
+	imageService
+	summary dto.ImageSummary
+}
+
+func (s summaryImages) GetImageSummary(ctx context.Context, userId int) (dto.ImageSummary, error) {
+	return s.summary, nil
+}
+
+func newViewService(summary dto.ImageSummary) *UserService {
+	repo := &fakeUserRepo{users: []entity.User{
+		{ID: 1, Name: "Ann", Login: "ann", Password: "secret1", Description: sql.NullString{String: "hi", Valid: true}},
+		{ID: 2, Name: "Bob", Login: "bob", Password: "secret2"},
+	}}
+	return NewUserService(repo, summaryImages{summary: summary}, discardEvents{})
+}
+
+func TestGetPageWalksAllPages(t *testing.T) {
+	tests := []struct {
+		name   string
+		search string
+		sort   string
+		desc   bool
+		want   []int64
+	}{
+		{"by id", "", "id", false, []int64{1, 2, 3, 4, 5}},
+		{"by id descending", "", "id", true, []int64{5, 4, 3, 2, 1}},
+		{"by name, ties by id", "", "name", false, []int64{3, 2, 1, 5, 4}},
+		{"by name descending", "", "name", true, []int64{4, 5, 1, 2, 3}},
+		{"search ignores case", "BO", "name", false, []int64{3, 1, 5}},
+		{"search without match", "zed", "id", false, []int64{}},
+		{"search by whole login", "wonderland", "id", false, []int64{2}},
+		{"search by login prefix", "wonder", "id", false, []int64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			us := newPagingService()
+			query := dto.UserQuery{Search: tt.search, Sort: tt.sort, Desc: tt.desc, Limit: 2, Count: true}
+
+			got := make([]int64, 0)
+			for pages := 1; ; pages++ {
+				page, err := us.GetPage(context.Background(), query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(page.Users) > query.Limit {
+					t.Fatalf("got %d users on a page, want at most %d", len(page.Users), query.Limit)
+				}
+				if page.Total == nil || *page.Total != len(tt.want) {
+					t.Errorf("got total %v, want %d", page.Total, len(tt.want))
+				}
+
+				for _, user := range page.Users {
+					got = append(got, user.ID)
+				}
+
+				if page.NextCursor == "" {
+					break
+				}
+				if pages > len(tt.want) {
+					t.Fatalf("got more than %d pages", pages)
+				}
+				query.Cursor = page.NextCursor
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got users %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetPageLastFullPageHasNoCursor(t *testing.T) {
+	us := newPagingService()
+
+	page, err := us.GetPage(context.Background(), dto.UserQuery{Sort: "id", Limit: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Users) != 5 || page.NextCursor != "" {
+		t.Errorf("got %d users and cursor %q, want 5 users and no cursor", len(page.Users), page.NextCursor)
+	}
+	if page.Total != nil {
+		t.Errorf("got total %d without asking for the count", *page.Total)
+	}
+}
+
+func TestGetPageRejectsForeignCursors(t *testing.T) {
+	name, err := encodeUserCursor(userCursor{Sort: "name", Name: "bob", ID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	descID, err := encodeUserCursor(userCursor{Sort: "id", Desc: true, ID: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		query  dto.UserQuery
+		cursor string
+	}{
+		{"name cursor sorted by id", dto.UserQuery{Sort: "id"}, name},
+		{"name cursor sorted descending", dto.UserQuery{Sort: "name", Desc: true}, name},
+		{"descending cursor sorted ascending", dto.UserQuery{Sort: "id"}, descID},
+		{"not base64", dto.UserQuery{Sort: "id"}, "%%%"},
+		{"not JSON", dto.UserQuery{Sort: "id"}, "bm90IGpzb24"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := tt.query
+			query.Cursor, query.Limit = tt.cursor, 2
+
+			_, err := newPagingService().GetPage(context.Background(), query)
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("got error %v, want %v", err, ErrInvalidCursor)
+			}
+		})
+	}
+}
+
+func TestUserCursorRoundTrip(t *testing.T) {
+	tests := []userCursor{
+		{Sort: "id", ID: 1},
+		{Sort: "id", Desc: true, ID: 42},
+		{Sort: "name", Name: "bob", ID: 7},
+		{Sort: "name", Desc: true, Name: "Анна \"quoted\" ,:/?", ID: 1 << 40},
+		{Sort: "name", Name: "", ID: 3},
+	}
+
+	for _, want := range tests {
+		s, err := encodeUserCursor(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.ContainsAny(s, "+/=") {
+			t.Errorf("cursor %q is not URL safe", s)
+		}
+
+		got, err := decodeUserCursor(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestGetMe(t *testing.T) {
+	lastAdded := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	summary := dto.ImageSummary{Count: 2, TotalSize: 300, LastAddedAt: &lastAdded}
+
+	me, err := newViewService(summary).GetMe(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if me.ID != 1 || me.Login != "ann" || me.Description != "hi" {
+		t.Errorf("got profile %+v, want user 1", me)
+	}
+	if me.Images.Count != 2 || me.Images.TotalSize != 300 || !me.Images.LastAddedAt.Equal(lastAdded) {
+		t.Errorf("got image summary %+v, want %+v", me.Images, summary)
+	}
+
+	_, err = newViewService(summary).GetMe(context.Background(), 3)
+	if err != ErrUserNotFound {
+		t.Errorf("got error %v for a missing user, want %v", err, ErrUserNotFound)
+	}
+}
+
+func TestPublicViewsHideCredentials(t *testing.T) {
+	us := newViewService(dto.ImageSummary{})
+
+	user, err := us.GetPublicById(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := us.GetPage(context.Background(), dto.UserQuery{Sort: "id", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Users) != 2 {
+		t.Fatalf("got %d users, want 2", len(page.Users))
+	}
+
+	for _, v := range []any{user, page.Users} {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body := string(b); strings.Contains(body, "login") || strings.Contains(body, "secret") {
+			t.Errorf("got %s, want no login and password", body)
+		}
+	}
+}
+
+func TestUpdateKeepsPassword(t *testing.T) {
+	repo := &fakeUserRepo{users: []entity.User{{ID: 1, Name: "bob", Login: "bob", Password: "password1"}}}
+	us := NewUserService(repo, nil, discardEvents{})
+
+	var user dto.UserUpdate
+	err := json.Unmarshal([]byte(`{"id":1,"name":"Bob","login":"bobby","password":"password2"}`), &user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = us.Update(context.Background(), 1, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := repo.users[0]
+	if got.Name != "Bob" || got.Login != "bobby" {
+		t.Errorf("got name %q and login %q, want the updated ones", got.Name, got.Login)
+	}
+	if got.Password != "password1" {
+		t.Errorf("got password %q, want it unchanged by PUT", got.Password)
+	}
+
+	err = us.ChangePassword(context.Background(), 1, 1, dto.PasswordChange{CurrentPassword: "wrong", NewPassword: "password2"})
+	if !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("got error %v, want %v", err, ErrWrongPassword)
+	}
+}
+
+func TestChangePasswordPublishesEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		want    []event.Event
+	}{
+		{"changed", "password1", []event.Event{{Type: event.PasswordChanged, UserID: 1}}},
+		{"wrong password", "wrong", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeUserRepo{users: []entity.User{{ID: 1, Name: "bob", Login: "bob", Password: "password1"}}}
+			events := &recordedEvents{}
+			us := NewUserService(repo, nil, events)
+
+			_ = us.ChangePassword(context.Background(), 1, 1, dto.PasswordChange{CurrentPassword: tt.current, NewPassword: "password2"})
+
+			if len(events.events) != len(tt.want) {
+				t.Fatalf("got events %+v, want %+v", events.events, tt.want)
+			}
+			for i, e := range events.events {
+				if e.Type != tt.want[i].Type || e.UserID != tt.want[i].UserID {
+					t.Errorf("got event %+v, want %+v", e, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/fichca/image-loader/internal/dto"
+	"github.com/fichca/image-loader/internal/i18n"
+	"github.com/fichca/image-loader/internal/service"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strconv"
+	"strings"
+)
+
+// States of the multi-step flows, kept per chat by the telegram service.
+const (
+	stateLinkCode      = "link_code"
+	stateDeleteID      = "delete_id"
+	stateDeleteConfirm = "delete_confirm"
+)
+
+const (
+	deleteCallback = "delete"
+	confirmDelete  = "yes"
+	keepImage      = "no"
+)
+
+// commands are registered with setMyCommands so clients suggest them, /start is left out
+// because Telegram shows it for every bot anyway.
+var commands = []struct {
+	command     string
+	description i18n.Key
+}{
+	{"help", i18n.CommandHelp},
+	{"link", i18n.CommandLink},
+	{"unlink", i18n.CommandUnlink},
+	{"latest", i18n.CommandLatest},
+	{"albums", i18n.CommandAlbums},
+	{"delete", i18n.CommandDelete},
+	{"whoami", i18n.CommandWhoAmI},
+	{"notifications", i18n.CommandNotifications},
+	{"language", i18n.CommandLanguage},
+	{"cancel", i18n.CommandCancel},
+}
+
+// RegisterCommands publishes the command list shown in Telegram clients, in the default language
+// for clients in languages without a catalog.
+func (b *Bot) RegisterCommands() error {
+	for _, lang := range i18n.Supported {
+		config := tgbotapi.NewSetMyCommands(botCommands(lang)...)
+		if lang != i18n.Default {
+			config.LanguageCode = string(lang)
+		}
+
+		_, err := b.request(config)
+		if err != nil {
+			return fmt.Errorf("failed to set bot commands for %s: %w", lang, err)
+		}
+	}
+	return nil
+}
+
+func botCommands(lang i18n.Lang) []tgbotapi.BotCommand {
+	botCommands := make([]tgbotapi.BotCommand, 0, len(commands))
+	for _, command := range commands {
+		botCommands = append(botCommands, tgbotapi.BotCommand{
+			Command:     command.command,
+			Description: i18n.T(lang, command.description),
+		})
+	}
+	return botCommands
+}
+
+// processCommand runs a command, any command abandons the flow the chat was in.
+func (b *Bot) processCommand(message *tgbotapi.Message, state dto.ChatState) {
+	chatId := message.Chat.ID
+	tgUserId := message.From.ID
+	args := strings.TrimSpace(message.CommandArguments())
+
+	if state.State != "" && !state.Expired {
+		b.setState(chatId, dto.ChatState{})
+	}
+
+	switch message.Command() {
+	case "start":
+		if args == linkStartParam {
+			b.startLink(chatId, tgUserId, "")
+			return
+		}
+		if args != "" {
+			b.reply(chatId, b.linkAccount(tgUserId, args))
+			return
+		}
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(
+			[]tgbotapi.InlineKeyboardButton{
+				tgbotapi.NewInlineKeyboardButtonData(b.text(chatId, i18n.ButtonShowImages), show),
+				tgbotapi.NewInlineKeyboardButtonData(b.text(chatId, i18n.ButtonRegistration), reg),
+			},
+		)
+		msg := tgbotapi.NewMessage(chatId, b.text(chatId, i18n.SelectAction))
+		msg.ReplyToMessageID = message.MessageID
+		msg.ReplyMarkup = keyboard
+		b.sendMsg(msg)
+	case "help":
+		b.sendMsg(tgbotapi.NewMessage(chatId, helpText(b.lang(chatId))))
+	case "link":
+		b.startLink(chatId, tgUserId, args)
+	case "unlink":
+		b.unlinkAccount(chatId, tgUserId)
+	case "latest":
+		b.showGallery(chatId, tgUserId, dto.PageCursor{})
+	case "albums":
+		b.reply(chatId, i18n.AlbumsNotSupported)
+	case "delete":
+		b.startDelete(chatId, tgUserId, args)
+	case "whoami":
+		b.whoAmI(chatId, tgUserId)
+	case "notifications":
+		b.showNotifications(chatId, tgUserId)
+	case "language":
+		b.showLanguages(chatId)
+	case "cancel":
+		if state.State == "" || state.Expired {
+			b.reply(chatId, i18n.NothingToCancel)
+			return
+		}
+		b.reply(chatId, i18n.Cancelled)
+	default:
+		b.reply(chatId, i18n.UnknownCommand)
+	}
+}
+
+// processReply handles a plain message sent while the chat is in a multi-step flow.
+func (b *Bot) processReply(message *tgbotapi.Message, state dto.ChatState) {
+	chatId := message.Chat.ID
+
+	switch state.State {
+	case stateLinkCode:
+		b.setState(chatId, dto.ChatState{})
+		b.reply(chatId, b.linkAccount(message.From.ID, message.Text))
+	case stateDeleteID:
+		b.startDelete(chatId, message.From.ID, strings.TrimSpace(message.Text))
+	case stateDeleteConfirm:
+		b.reply(chatId, i18n.ConfirmDeletion)
+	}
+}
+
+func (b *Bot) startLink(chatId, tgUserId int64, code string) {
+	if code != "" {
+		b.reply(chatId, b.linkAccount(tgUserId, code))
+		return
+	}
+
+	_, err := b.authService.ValidateTGUser(context.Background(), tgUserId)
+	if err == nil {
+		b.reply(chatId, i18n.AlreadyLinked)
+		return
+	}
+
+	b.setState(chatId, dto.ChatState{State: stateLinkCode})
+	b.reply(chatId, i18n.SendLinkCode)
+}
+
+func (b *Bot) unlinkAccount(chatId, tgUserId int64) {
+	err := b.authService.UnlinkTelegram(context.Background(), tgUserId)
+	switch {
+	case errors.Is(err, service.ErrTelegramNotLinked):
+		b.reply(chatId, i18n.AccountNotLinked)
+	case err != nil:
+		b.l.Error(err)
+		b.reply(chatId, i18n.UnlinkFailed)
+	default:
+		b.reply(chatId, i18n.Unlinked)
+	}
+}
+
+func (b *Bot) whoAmI(chatId, tgUserId int64) {
+	ctx := context.Background()
+
+	userId, err := b.authService.ValidateTGUser(ctx, tgUserId)
+	if err != nil {
+		b.reply(chatId, i18n.NotLinked)
+		return
+	}
+
+	login, err := b.tgService.GetUserLogin(ctx, userId)
+	if err != nil {
+		b.l.Error(err)
+		b.reply(chatId, i18n.AccountLoadFailed)
+		return
+	}
+
+	b.reply(chatId, i18n.LinkedTo, login, userId)
+}
+
+// startDelete asks for the image ID when it is not given and then for a confirmation.
+func (b *Bot) startDelete(chatId, tgUserId int64, arg string) {
+	_, err := b.authService.ValidateTGUser(context.Background(), tgUserId)
+	if err != nil {
+		b.setState(chatId, dto.ChatState{})
+		b.reply(chatId, i18n.NotLinked)
+		return
+	}
+
+	if arg == "" {
+		b.setState(chatId, dto.ChatState{State: stateDeleteID})
+		b.reply(chatId, i18n.SendImageID)
+		return
+	}
+
+	imageId, err := strconv.Atoi(arg)
+	if err != nil || imageId <= 0 {
+		b.setState(chatId, dto.ChatState{State: stateDeleteID})
+		b.reply(chatId, i18n.ImageIDNotNumber)
+		return
+	}
+
+	b.setState(chatId, dto.ChatState{State: stateDeleteConfirm, Data: strconv.Itoa(imageId)})
+
+	msg := tgbotapi.NewMessage(chatId, b.text(chatId, i18n.DeleteImagePrompt, imageId))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		[]tgbotapi.InlineKeyboardButton{
+			tgbotapi.NewInlineKeyboardButtonData(b.text(chatId, i18n.ButtonDelete), deleteCallback+":"+confirmDelete),
+			tgbotapi.NewInlineKeyboardButtonData(b.text(chatId, i18n.ButtonKeep), deleteCallback+":"+keepImage),
+		},
+	)
+	b.sendMsg(msg)
+}
+
+// finishDelete handles the confirmation buttons, they only work while the confirmation is pending.
+func (b *Bot) finishDelete(chatId, tgUserId int64, answer string) {
+	ctx := context.Background()
+
+	state := b.chatState(chatId)
+	if state.State != stateDeleteConfirm || state.Expired {
+		b.reply(chatId, i18n.ConfirmationExpired)
+		return
+	}
+	b.setState(chatId, dto.ChatState{})
+
+	if answer != confirmDelete {
+		b.reply(chatId, i18n.ImageKept)
+		return
+	}
+
+	imageId, err := strconv.Atoi(state.Data)
+	if err != nil {
+		b.l.Error(err)
+		return
+	}
+
+	userId, err := b.authService.ValidateTGUser(ctx, tgUserId)
+	if err != nil {
+		b.reply(chatId, i18n.NotLinked)
+		return
+	}
+
+	err = b.tgService.DeleteImage(ctx, userId, imageId)
+	switch {
+	case errors.Is(err, service.ErrImageNotFound):
+		b.reply(chatId, i18n.ImageNotFoundID, imageId)
+	case err != nil:
+		b.l.Error(err)
+		b.reply(chatId, i18n.DeleteImageFailed)
+	default:
+		b.reply(chatId, i18n.ImageDeletedID, imageId)
+	}
+}
+
+// chatState loads the chat's flow, a state that cannot be loaded is treated as no flow.
+func (b *Bot) chatState(chatId int64) dto.ChatState {
+	state, err := b.tgService.GetChatState(context.Background(), chatId)
+	if err != nil {
+		b.l.Error(err)
+		return dto.ChatState{}
+	}
+	return state
+}
+
+func (b *Bot) setState(chatId int64, state dto.ChatState) {
+	err := b.tgService.SetChatState(context.Background(), chatId, state)
+	if err != nil {
+		b.l.Error(err)
+	}
+}
+
+func helpText(lang i18n.Lang) string {
+	var sb strings.Builder
+	sb.WriteString(i18n.T(lang, i18n.HelpIntro) + "\n\n")
+	for _, command := range botCommands(lang) {
+		sb.WriteString("/" + command.Command + " - " + command.Description + "\n")
+	}
+	return sb.String()
+}
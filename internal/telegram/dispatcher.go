@@ -0,0 +1,100 @@
+package telegram
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"sync"
+)
+
+// workerQueueSize is how many updates may wait for a busy worker before receiving them blocks.
+const workerQueueSize = 64
+
+// dispatcher processes updates on a fixed pool of workers. Updates of one chat always go to the
+// same worker, so they are handled in the order they arrived while other chats proceed in parallel.
+type dispatcher struct {
+	queues []chan tgbotapi.Update
+	handle func(tgbotapi.Update)
+	wg     sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func newDispatcher(workers int, handle func(tgbotapi.Update)) *dispatcher {
+	if workers < 1 {
+		workers = 1
+	}
+
+	d := &dispatcher{
+		queues: make([]chan tgbotapi.Update, workers),
+		handle: handle,
+	}
+	for i := range d.queues {
+		d.queues[i] = make(chan tgbotapi.Update, workerQueueSize)
+		d.wg.Add(1)
+		go d.work(d.queues[i])
+	}
+
+	return d
+}
+
+func (d *dispatcher) work(queue chan tgbotapi.Update) {
+	defer d.wg.Done()
+	for update := range queue {
+		d.handle(update)
+	}
+}
+
+// dispatch queues the update, it reports false once the dispatcher is stopped.
+func (d *dispatcher) dispatch(update tgbotapi.Update) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.closed {
+		return false
+	}
+
+	key := updateChatID(update)
+	if key < 0 {
+		key = -key
+	}
+	d.queues[key%int64(len(d.queues))] <- update
+
+	return true
+}
+
+// stop stops accepting updates and waits until the queued ones are processed or ctx is done.
+func (d *dispatcher) stop(ctx context.Context) error {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		for _, queue := range d.queues {
+			close(queue)
+		}
+	}
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// updateChatID is the chat an update belongs to, updates without a chat are keyed by their sender.
+func updateChatID(update tgbotapi.Update) int64 {
+	if chat := update.FromChat(); chat != nil {
+		return chat.ID
+	}
+	if user := update.SentFrom(); user != nil {
+		return user.ID
+	}
+	return 0
+}
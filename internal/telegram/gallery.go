@@ -0,0 +1,304 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/fichca/image-loader/internal/dto"
+	"github.com/fichca/image-loader/internal/i18n"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// galleryPageSize is the most media sendMediaGroup accepts in one album.
+const galleryPageSize = 10
+
+const (
+	nextPage = "n"
+	prevPage = "p"
+)
+
+// showGallery sends one page of the user's images as an album followed by a message with
+// the navigation buttons, since albums cannot carry an inline keyboard themselves.
+func (b *Bot) showGallery(chatId, tgUserId int64, cursor dto.PageCursor) {
+	ctx := context.Background()
+
+	userId, err := b.authService.ValidateTGUser(ctx, tgUserId)
+	if err != nil {
+		b.l.Error(err)
+		b.reply(chatId, i18n.SignUp)
+		return
+	}
+
+	page, err := b.tgService.GetImagePage(ctx, userId, cursor, galleryPageSize)
+	if err != nil {
+		b.l.Error(err)
+		b.reply(chatId, i18n.ImagesLoadFailed)
+		return
+	}
+	defer func() {
+		for _, image := range page.Images {
+			if image.Data == nil {
+				continue
+			}
+			err := image.Data.Close()
+			if err != nil {
+				b.l.Error(err)
+			}
+		}
+	}()
+
+	if len(page.Images) == 0 {
+		b.reply(chatId, i18n.NoImages)
+		return
+	}
+
+	b.sendImages(chatId, userId, page.Images)
+
+	msg := tgbotapi.NewMessage(chatId, b.text(chatId, i18n.ImagesRange, page.Images[0].ID, page.Images[len(page.Images)-1].ID))
+	if keyboard, ok := galleryKeyboard(b.lang(chatId), page); ok {
+		msg.ReplyMarkup = keyboard
+	}
+	b.sendMsg(msg)
+}
+
+// galleryPhoto is an image about to be sent, by its cached file_id or by uploading its bytes.
+type galleryPhoto struct {
+	imageId  int
+	caption  string
+	file     tgbotapi.RequestFileData
+	uploaded bool
+}
+
+// galleryDocument is an image too large for a photo, its data is streamed to Telegram as a document.
+type galleryDocument struct {
+	imageId int
+	caption string
+	file    tgbotapi.FileReader
+}
+
+// sendImages sends the images as photos. Images Telegram already has are sent by file_id, the others
+// are uploaded and the file_ids Telegram assigns them are cached. When Telegram no longer accepts
+// a cached file_id it is dropped and the image is uploaded again. Images too large for a photo
+// follow the album as documents.
+func (b *Bot) sendImages(chatId int64, userId int, images []dto.ImageObject) {
+	photos, documents := b.galleryPhotos(images)
+
+	err := b.sendPhotos(chatId, photos)
+	if err != nil && isBadRequest(err) && hasCachedPhotos(photos) {
+		b.l.Warnf("cached file_ids were rejected, uploading the images again: %v", err)
+		err = b.reuploadCached(userId, photos)
+		if err == nil {
+			err = b.sendPhotos(chatId, photos)
+		}
+	}
+	if err != nil {
+		b.l.Error(err)
+	}
+
+	for _, document := range documents {
+		config := tgbotapi.NewDocument(chatId, document.file)
+		config.Caption = document.caption
+		_, err := b.send(config)
+		if err != nil {
+			b.l.Errorf("failed to send image %d as a document: %v", document.imageId, err)
+		}
+	}
+}
+
+// galleryPhotos reads the images to upload into memory, so a retried upload sends them again.
+// Only images that fit in a photo are read, the larger ones are returned as documents reading
+// the image data when they are sent.
+func (b *Bot) galleryPhotos(images []dto.ImageObject) ([]galleryPhoto, []galleryDocument) {
+	photos := make([]galleryPhoto, 0, len(images))
+	documents := make([]galleryDocument, 0)
+	for _, image := range images {
+		photo := galleryPhoto{imageId: image.ID, caption: image.Description}
+
+		if image.FileID != "" {
+			photo.file = tgbotapi.FileID(image.FileID)
+			photos = append(photos, photo)
+			continue
+		}
+
+		file, err := imageFile(&image)
+		if errors.Is(err, errPhotoTooLarge) {
+			if image.Size > maxUploadSize {
+				b.l.Warnf("image %d of %d bytes is too large to be sent", image.ID, image.Size)
+				continue
+			}
+			documents = append(documents, galleryDocument{imageId: image.ID, caption: image.Description,
+				file: tgbotapi.FileReader{Name: image.Name, Reader: image.Data}})
+			continue
+		}
+		if err != nil {
+			b.l.Error(err)
+			continue
+		}
+
+		photo.file, photo.uploaded = file, true
+		photos = append(photos, photo)
+	}
+	return photos, documents
+}
+
+// reuploadCached replaces the photos sent by file_id with their bytes and forgets those file_ids.
+func (b *Bot) reuploadCached(userId int, photos []galleryPhoto) error {
+	ctx := context.Background()
+
+	images := make([]dto.ImageObject, 0, len(photos))
+	ids := make([]int, 0, len(photos))
+	for _, photo := range photos {
+		if !photo.uploaded {
+			images = append(images, dto.ImageObject{ID: photo.imageId})
+			ids = append(ids, photo.imageId)
+		}
+	}
+
+	err := b.tgService.InvalidateFileIDs(ctx, ids)
+	if err != nil {
+		b.l.Error(err)
+	}
+
+	err = b.tgService.OpenImageObjects(ctx, userId, images)
+	if err != nil {
+		return err
+	}
+
+	files := make(map[int]tgbotapi.FileBytes, len(images))
+	for _, image := range images {
+		file, err := imageFile(&image)
+		image.Data.Close()
+		if err != nil {
+			return err
+		}
+		files[image.ID] = file
+	}
+
+	for i := range photos {
+		if file, ok := files[photos[i].imageId]; ok {
+			photos[i].file, photos[i].uploaded = file, true
+		}
+	}
+
+	return nil
+}
+
+func (b *Bot) sendPhotos(chatId int64, photos []galleryPhoto) error {
+	switch len(photos) {
+	case 0:
+		return nil
+	case 1:
+		photo := tgbotapi.NewPhoto(chatId, photos[0].file)
+		photo.Caption = photos[0].caption
+		msg, err := b.send(photo)
+		if err != nil {
+			return err
+		}
+		b.saveSentFileIDs(photos, []tgbotapi.Message{msg})
+		return nil
+	}
+
+	media := make([]interface{}, 0, len(photos))
+	for _, photo := range photos {
+		inputMedia := tgbotapi.NewInputMediaPhoto(photo.file)
+		inputMedia.Caption = photo.caption
+		media = append(media, inputMedia)
+	}
+
+	messages, err := b.sendMediaGroup(tgbotapi.NewMediaGroup(chatId, media))
+	if err != nil {
+		return err
+	}
+	b.saveSentFileIDs(photos, messages)
+	return nil
+}
+
+// saveSentFileIDs caches the file_ids of uploaded photos, messages are in the order of photos.
+func (b *Bot) saveSentFileIDs(photos []galleryPhoto, messages []tgbotapi.Message) {
+	for i, msg := range messages {
+		if i < len(photos) && photos[i].uploaded && len(msg.Photo) > 0 {
+			b.saveFileID(photos[i].imageId, largestPhoto(msg.Photo).FileID)
+		}
+	}
+}
+
+func hasCachedPhotos(photos []galleryPhoto) bool {
+	for _, photo := range photos {
+		if !photo.uploaded {
+			return true
+		}
+	}
+	return false
+}
+
+// imageFile reads an image that fits in a photo. A larger one fails with errPhotoTooLarge and its data
+// is replaced by a reader of the whole image, so that it can still be sent as a document.
+func imageFile(image *dto.ImageObject) (tgbotapi.FileBytes, error) {
+	if image.Size > maxPhotoSize {
+		return tgbotapi.FileBytes{}, errPhotoTooLarge
+	}
+
+	data, err := io.ReadAll(io.LimitReader(image.Data, maxPhotoSize+1))
+	if err != nil {
+		return tgbotapi.FileBytes{}, fmt.Errorf("failed to read image %d: %w", image.ID, err)
+	}
+	if len(data) > maxPhotoSize {
+		// the size of the image was not recorded, what has been read goes ahead of the rest
+		image.Data = readCloser{io.MultiReader(bytes.NewReader(data), image.Data), image.Data}
+		return tgbotapi.FileBytes{}, errPhotoTooLarge
+	}
+
+	return tgbotapi.FileBytes{
+		Name:  image.Name,
+		Bytes: data,
+	}, nil
+}
+
+// readCloser reads from Reader and closes the image data it was made of.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func galleryKeyboard(lang i18n.Lang, page dto.ImagePage) (tgbotapi.InlineKeyboardMarkup, bool) {
+	buttons := make([]tgbotapi.InlineKeyboardButton, 0, 2)
+	if page.HasPrev {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(i18n.T(lang, i18n.ButtonPrev),
+			galleryCallback(prevPage, page.Images[0].ID)))
+	}
+	if page.HasNext {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(i18n.T(lang, i18n.ButtonNext),
+			galleryCallback(nextPage, page.Images[len(page.Images)-1].ID)))
+	}
+	if len(buttons) == 0 {
+		return tgbotapi.InlineKeyboardMarkup{}, false
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(buttons), true
+}
+
+// galleryCallback encodes a page cursor as "show:<direction>:<image id>".
+func galleryCallback(direction string, imageId int) string {
+	return show + ":" + direction + ":" + strconv.Itoa(imageId)
+}
+
+func parseGalleryCursor(data string) (dto.PageCursor, error) {
+	if data == show {
+		return dto.PageCursor{}, nil
+	}
+
+	parts := strings.Split(data, ":")
+	if len(parts) != 3 || (parts[1] != nextPage && parts[1] != prevPage) {
+		return dto.PageCursor{}, fmt.Errorf("invalid gallery cursor %q", data)
+	}
+
+	imageId, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return dto.PageCursor{}, fmt.Errorf("invalid gallery cursor %q: %w", data, err)
+	}
+
+	return dto.PageCursor{ImageID: imageId, Before: parts[1] == prevPage}, nil
+}
@@ -0,0 +1,123 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"github.com/fichca/image-loader/internal/i18n"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strconv"
+	"strings"
+)
+
+const (
+	inlinePageSize = 20
+	// maxInlineUploads bounds the images uploaded to the cache chat while answering one query,
+	// Telegram drops answers that take longer than a few seconds.
+	maxInlineUploads = 3
+	inlineCacheTime  = 10
+)
+
+// linkStartParam is the /start parameter of the button offered to unlinked users, it starts linking.
+const linkStartParam = "link"
+
+// processInlineQuery answers "@bot <text>" with the user's images whose title contains the text or that have it as a tag,
+// as cached photos so Telegram sends them by file_id. Inline mode has to be enabled with BotFather.
+func (b *Bot) processInlineQuery(query *tgbotapi.InlineQuery) {
+	ctx := context.Background()
+
+	answer := tgbotapi.InlineConfig{
+		InlineQueryID: query.ID,
+		Results:       []interface{}{},
+		CacheTime:     inlineCacheTime,
+		IsPersonal:    true,
+	}
+
+	userId, err := b.authService.ValidateTGUser(ctx, query.From.ID)
+	if err != nil {
+		answer.SwitchPMText = b.text(query.From.ID, i18n.InlineLinkAccount)
+		answer.SwitchPMParameter = linkStartParam
+		b.answerInline(answer)
+		return
+	}
+
+	offset, err := strconv.Atoi(query.Offset)
+	if err != nil {
+		offset = 0
+	}
+
+	images, err := b.tgService.SearchImages(ctx, userId, strings.TrimSpace(query.Query), offset, inlinePageSize)
+	if err != nil {
+		b.l.Error(err)
+		b.answerInline(answer)
+		return
+	}
+
+	uploads := 0
+	for _, image := range images {
+		if image.FileID == "" {
+			if b.cacheChatID == 0 || uploads == maxInlineUploads {
+				continue
+			}
+			uploads++
+
+			image.FileID, err = b.cacheImage(ctx, userId, image.ID)
+			if err != nil {
+				b.l.Error(err)
+				continue
+			}
+		}
+
+		result := tgbotapi.NewInlineQueryResultCachedPhoto(strconv.Itoa(image.ID), image.FileID)
+		result.Title = image.Title
+		result.Description = image.Description
+		result.Caption = image.Description
+		answer.Results = append(answer.Results, result)
+	}
+
+	if len(images) == inlinePageSize {
+		answer.NextOffset = strconv.Itoa(offset + len(images))
+	}
+
+	b.answerInline(answer)
+}
+
+// cacheImage uploads the image to the cache chat and remembers the file_id Telegram assigns to it.
+func (b *Bot) cacheImage(ctx context.Context, userId, imageId int) (string, error) {
+	object, err := b.tgService.GetImageObject(ctx, userId, imageId)
+	if err != nil {
+		return "", err
+	}
+	defer object.Data.Close()
+
+	file, err := imageFile(&object)
+	if err != nil {
+		return "", err
+	}
+
+	msg, err := b.send(tgbotapi.NewPhoto(b.cacheChatID, file))
+	if err != nil {
+		return "", fmt.Errorf("failed to upload image %d to the cache chat: %w", imageId, err)
+	}
+	if len(msg.Photo) == 0 {
+		return "", fmt.Errorf("uploaded image %d has no photo", imageId)
+	}
+
+	fileId := largestPhoto(msg.Photo).FileID
+	b.saveFileID(imageId, fileId)
+
+	return fileId, nil
+}
+
+func (b *Bot) saveFileID(imageId int, fileId string) {
+	err := b.tgService.SaveFileID(context.Background(), imageId, fileId)
+	if err != nil {
+		b.l.Error(err)
+	}
+}
+
+func (b *Bot) answerInline(answer tgbotapi.InlineConfig) {
+	_, err := b.request(answer)
+	if err != nil {
+		b.l.Error(err)
+	}
+}
@@ -0,0 +1,97 @@
+package telegram
+
+import (
+	"context"
+	"github.com/fichca/image-loader/internal/i18n"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strings"
+)
+
+const languageCallback = "lang"
+
+// rememberLanguage picks the language to answer the update in: the one the user chose with /language,
+// else the language of their Telegram client.
+func (b *Bot) rememberLanguage(update tgbotapi.Update) {
+	from := update.SentFrom()
+	if from == nil {
+		return
+	}
+
+	lang, ok, err := b.tgService.GetLanguage(context.Background(), from.ID)
+	if err != nil {
+		b.l.Error(err)
+	}
+	if !ok {
+		lang, ok = i18n.Parse(from.LanguageCode)
+	}
+	if !ok {
+		lang = i18n.Default
+	}
+
+	// Inline queries come without a chat, their answers go to the private chat whose ID is the user's.
+	chatId := from.ID
+	if chat := update.FromChat(); chat != nil {
+		chatId = chat.ID
+	}
+	b.langs.Store(chatId, lang)
+}
+
+// lang returns the language of the chat. Chats the bot has not heard from since it started,
+// such as the ones it notifies, are spoken to in the language their user chose, if any.
+func (b *Bot) lang(chatId int64) i18n.Lang {
+	if lang, ok := b.langs.Load(chatId); ok {
+		return lang.(i18n.Lang)
+	}
+
+	lang, ok, err := b.tgService.GetLanguage(context.Background(), chatId)
+	if err != nil {
+		b.l.Error(err)
+	}
+	if !ok {
+		lang = i18n.Default
+	}
+
+	b.langs.Store(chatId, lang)
+	return lang
+}
+
+func (b *Bot) text(chatId int64, key i18n.Key, args ...any) string {
+	return i18n.T(b.lang(chatId), key, args...)
+}
+
+// reply sends the message in the language of the chat.
+func (b *Bot) reply(chatId int64, key i18n.Key, args ...any) {
+	b.sendMsg(tgbotapi.NewMessage(chatId, b.text(chatId, key, args...)))
+}
+
+// showLanguages sends a button for each supported language.
+func (b *Bot) showLanguages(chatId int64) {
+	buttons := make([]tgbotapi.InlineKeyboardButton, 0, len(i18n.Supported))
+	for _, lang := range i18n.Supported {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(i18n.Name(lang), languageCallback+":"+string(lang)))
+	}
+
+	msg := tgbotapi.NewMessage(chatId, b.text(chatId, i18n.LanguagePrompt))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(buttons)
+	b.sendMsg(msg)
+}
+
+// setLanguage handles a language button, the choice is kept for the Telegram user.
+func (b *Bot) setLanguage(query *tgbotapi.CallbackQuery) {
+	chatId := query.Message.Chat.ID
+
+	lang, ok := i18n.Parse(strings.TrimPrefix(query.Data, languageCallback+":"))
+	if !ok {
+		return
+	}
+
+	err := b.tgService.SetLanguage(context.Background(), query.From.ID, lang)
+	if err != nil {
+		b.l.Error(err)
+		b.reply(chatId, i18n.LanguageSaveFailed)
+		return
+	}
+
+	b.langs.Store(chatId, lang)
+	b.reply(chatId, i18n.LanguageChanged)
+}
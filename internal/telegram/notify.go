@@ -0,0 +1,174 @@
+package telegram
+
+import (
+	"context"
+	"github.com/fichca/image-loader/internal/dto"
+	"github.com/fichca/image-loader/internal/event"
+	"github.com/fichca/image-loader/internal/i18n"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strings"
+)
+
+const notifyCallback = "notify"
+
+// notificationOptions are the events users can mute, in the order the /notifications buttons are shown.
+var notificationOptions = []struct {
+	eventType event.Type
+	label     i18n.Key
+}{
+	{event.ImageUploaded, i18n.NotifyUploadedImages},
+	{event.ImageDeleted, i18n.NotifyDeletedImages},
+	{event.ProfileUpdated, i18n.NotifyProfileChanges},
+}
+
+// Notify tells the user's linked chats about an account event, it is subscribed to the event bus.
+// Events caused from Telegram are skipped, the bot has already answered them.
+func (b *Bot) Notify(ctx context.Context, e event.Event) {
+	if e.Source == event.SourceTelegram {
+		return
+	}
+
+	enabled, err := b.tgService.NotificationEnabled(ctx, e.UserID, e.Type)
+	if err != nil {
+		b.l.Error(err)
+		return
+	}
+	if !enabled {
+		return
+	}
+
+	chats, err := b.authService.GetTelegramIDs(ctx, e.UserID)
+	if err != nil {
+		b.l.Error(err)
+		return
+	}
+	if len(chats) == 0 {
+		return
+	}
+
+	switch e.Type {
+	case event.ImageUploaded:
+		b.notifyUpload(ctx, e, chats)
+	case event.ImagesUploaded:
+		b.notifyText(chats, i18n.NotifyImagesUploaded, e.Count)
+	case event.ImageDeleted:
+		b.notifyText(chats, i18n.NotifyImageDeleted, e.ImageID, quoteName(e.ImageName))
+	case event.ProfileUpdated:
+		b.notifyText(chats, i18n.NotifyProfileUpdated)
+	case event.PasswordChanged:
+		b.notifyText(chats, i18n.NotifyPasswordChanged)
+	}
+}
+
+// notifyUpload sends the new image as a preview, falling back to a text message when it cannot be loaded.
+func (b *Bot) notifyUpload(ctx context.Context, e event.Event, chats []int64) {
+	name := quoteName(e.ImageName)
+
+	preview, err := b.tgService.GetPreview(ctx, e.UserID, e.ImageID)
+	if err != nil {
+		b.l.Error(err)
+		b.notifyText(chats, i18n.NotifyImageUploaded, e.ImageID, name)
+		return
+	}
+
+	// an image too large for a photo is announced by text, it is not streamed to every chat
+	photos, _ := b.galleryPhotos([]dto.ImageObject{preview})
+	if preview.Data != nil {
+		preview.Data.Close()
+	}
+	if len(photos) == 0 {
+		b.notifyText(chats, i18n.NotifyImageUploaded, e.ImageID, name)
+		return
+	}
+
+	for _, chat := range chats {
+		photo := photos[0]
+		photo.caption = b.text(chat, i18n.NotifyImageUploaded, e.ImageID, name)
+
+		err = b.sendPhotos(chat, []galleryPhoto{photo})
+		if err != nil {
+			b.l.Error(err)
+		}
+	}
+}
+
+// notifyText sends the message to each chat in its own language.
+func (b *Bot) notifyText(chats []int64, key i18n.Key, args ...any) {
+	for _, chat := range chats {
+		b.reply(chat, key, args...)
+	}
+}
+
+func quoteName(name string) string {
+	if name == "" {
+		return ""
+	}
+	return "(" + name + ")"
+}
+
+// showNotifications sends the notification settings with a button toggling each of them.
+func (b *Bot) showNotifications(chatId, tgUserId int64) {
+	ctx := context.Background()
+
+	userId, err := b.authService.ValidateTGUser(ctx, tgUserId)
+	if err != nil {
+		b.reply(chatId, i18n.NotLinked)
+		return
+	}
+
+	settings, err := b.tgService.GetNotificationSettings(ctx, userId)
+	if err != nil {
+		b.l.Error(err)
+		b.reply(chatId, i18n.NotificationsLoadFailed)
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatId, b.text(chatId, i18n.NotificationsPrompt))
+	msg.ReplyMarkup = notificationsKeyboard(b.lang(chatId), settings)
+	b.sendMsg(msg)
+}
+
+// toggleNotification handles a settings button and updates the buttons in place.
+func (b *Bot) toggleNotification(query *tgbotapi.CallbackQuery) {
+	ctx := context.Background()
+	chatId := query.Message.Chat.ID
+
+	userId, err := b.authService.ValidateTGUser(ctx, query.From.ID)
+	if err != nil {
+		b.reply(chatId, i18n.NotLinked)
+		return
+	}
+
+	eventType := event.Type(strings.TrimPrefix(query.Data, notifyCallback+":"))
+	settings, err := b.tgService.ToggleNotification(ctx, userId, eventType)
+	if err != nil {
+		b.l.Error(err)
+		b.reply(chatId, i18n.NotificationsUpdateFailed)
+		return
+	}
+
+	_, err = b.request(tgbotapi.NewEditMessageReplyMarkup(chatId, query.Message.MessageID, notificationsKeyboard(b.lang(chatId), settings)))
+	if err != nil {
+		b.l.Error(err)
+	}
+}
+
+func notificationsKeyboard(lang i18n.Lang, settings dto.NotificationSettings) tgbotapi.InlineKeyboardMarkup {
+	enabled := map[event.Type]bool{
+		event.ImageUploaded:  settings.ImageUploaded,
+		event.ImageDeleted:   settings.ImageDeleted,
+		event.ProfileUpdated: settings.ProfileUpdated,
+	}
+
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(notificationOptions))
+	for _, option := range notificationOptions {
+		state := i18n.NotificationOff
+		if enabled[option.eventType] {
+			state = i18n.NotificationOn
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			i18n.T(lang, option.label)+": "+i18n.T(lang, state), notifyCallback+":"+string(option.eventType))))
+	}
+
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
@@ -0,0 +1,240 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Telegram allows bots about 30 messages per second overall and one message per second in a chat.
+const (
+	globalSendInterval = time.Second / 30
+	chatSendInterval   = time.Second
+)
+
+const (
+	maxSendAttempts = 5
+	baseBackoff     = 500 * time.Millisecond
+	maxBackoff      = 30 * time.Second
+)
+
+// rateLimiter spaces out messages to stay within the send limits. Every caller reserves the
+// earliest slot free both globally and in its chat, then waits for it. Chat zero stands for
+// requests without a chat, they only take a global slot.
+type rateLimiter struct {
+	mu     sync.Mutex
+	global time.Time
+	chats  map[int64]time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		chats: make(map[int64]time.Time),
+	}
+}
+
+func (l *rateLimiter) wait(ctx context.Context, chatId int64) error {
+	l.mu.Lock()
+	now := time.Now()
+	at := now
+	if l.global.After(at) {
+		at = l.global
+	}
+	if next := l.chats[chatId]; chatId != 0 && next.After(at) {
+		at = next
+	}
+	l.global = at.Add(globalSendInterval)
+	if chatId != 0 {
+		l.chats[chatId] = at.Add(chatSendInterval)
+	}
+
+	for id, next := range l.chats {
+		if next.Before(now) {
+			delete(l.chats, id)
+		}
+	}
+	l.mu.Unlock()
+
+	return sleep(ctx, time.Until(at))
+}
+
+// send sends a message within the rate limits, retrying when Telegram asks to slow down.
+func (b *Bot) send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	ctx := context.Background()
+
+	var msg tgbotapi.Message
+	err := b.withRetry(ctx, func() error {
+		err := b.limiter.wait(ctx, b.limitedChatID(c))
+		if err != nil {
+			return err
+		}
+		msg, err = b.client.Send(c)
+		return err
+	})
+	return msg, err
+}
+
+func (b *Bot) sendMediaGroup(config tgbotapi.MediaGroupConfig) ([]tgbotapi.Message, error) {
+	ctx := context.Background()
+
+	var messages []tgbotapi.Message
+	err := b.withRetry(ctx, func() error {
+		err := b.limiter.wait(ctx, b.limitedChatID(config))
+		if err != nil {
+			return err
+		}
+		messages, err = b.client.SendMediaGroup(config)
+		return err
+	})
+	return messages, err
+}
+
+// request makes a call that sends no message, edits and deletions still count against the limits of their chat.
+func (b *Bot) request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	ctx := context.Background()
+
+	var resp *tgbotapi.APIResponse
+	err := b.withRetry(ctx, func() error {
+		err := b.limiter.wait(ctx, b.limitedChatID(c))
+		if err != nil {
+			return err
+		}
+		resp, err = b.client.Request(c)
+		return err
+	})
+	return resp, err
+}
+
+// withRetry calls fn until it succeeds, waiting retry_after when Telegram reports flood control and
+// backing off exponentially on server and network errors. Other API errors are returned at once.
+func (b *Bot) withRetry(ctx context.Context, fn func() error) error {
+	backoff := baseBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt == maxSendAttempts {
+			return err
+		}
+
+		delay, ok := retryDelay(err, backoff)
+		if !ok {
+			return err
+		}
+		b.l.Warnf("telegram request failed, retrying in %s: %v", delay, err)
+
+		err = sleep(ctx, delay)
+		if err != nil {
+			return err
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+func retryDelay(err error, backoff time.Duration) (time.Duration, bool) {
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) {
+		return backoff, true
+	}
+	if apiErr.RetryAfter > 0 {
+		return time.Duration(apiErr.RetryAfter) * time.Second, true
+	}
+	code := apiErrorCode(apiErr)
+	if code == http.StatusTooManyRequests || code >= http.StatusInternalServerError {
+		return backoff, true
+	}
+	return 0, false
+}
+
+func isBadRequest(err error) bool {
+	var apiErr *tgbotapi.Error
+	return errors.As(err, &apiErr) && apiErrorCode(apiErr) == http.StatusBadRequest
+}
+
+// apiErrorStatuses are the codes apiErrorCode recognizes in error descriptions.
+var apiErrorStatuses = []int{
+	http.StatusBadRequest,
+	http.StatusUnauthorized,
+	http.StatusForbidden,
+	http.StatusNotFound,
+	http.StatusConflict,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// apiErrorCode returns the code of a Bot API error. tgbotapi leaves the code out of the errors
+// of requests uploading files, their description starts with the status text, as in "Bad Request: ...".
+func apiErrorCode(apiErr *tgbotapi.Error) int {
+	if apiErr.Code != 0 {
+		return apiErr.Code
+	}
+	for _, code := range apiErrorStatuses {
+		if strings.HasPrefix(apiErr.Message, http.StatusText(code)) {
+			return code
+		}
+	}
+	return 0
+}
+
+// limitedChatID returns the chat whose limit the request counts against. The cache chat only
+// receives uploads that give inline results their file_ids, so just the global limit applies to it.
+func (b *Bot) limitedChatID(c tgbotapi.Chattable) int64 {
+	chatID := chattableChatID(c)
+	if chatID == b.cacheChatID {
+		return 0
+	}
+	return chatID
+}
+
+// chattableChatID returns the chat a request sends to or changes. Requests that are not bound
+// to a chat, like answers to callback and inline queries, get zero and only count globally.
+func chattableChatID(c tgbotapi.Chattable) int64 {
+	switch config := c.(type) {
+	case tgbotapi.MessageConfig:
+		return config.ChatID
+	case tgbotapi.PhotoConfig:
+		return config.ChatID
+	case tgbotapi.DocumentConfig:
+		return config.ChatID
+	case tgbotapi.MediaGroupConfig:
+		return config.ChatID
+	case tgbotapi.EditMessageTextConfig:
+		return config.ChatID
+	case tgbotapi.EditMessageCaptionConfig:
+		return config.ChatID
+	case tgbotapi.EditMessageMediaConfig:
+		return config.ChatID
+	case tgbotapi.EditMessageReplyMarkupConfig:
+		return config.ChatID
+	case tgbotapi.DeleteMessageConfig:
+		return config.ChatID
+	case tgbotapi.CallbackConfig, tgbotapi.InlineConfig, tgbotapi.SetMyCommandsConfig, tgbotapi.DeleteWebhookConfig:
+		return 0
+	}
+	return 0
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
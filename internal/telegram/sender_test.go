@@ -0,0 +1,100 @@
+package telegram
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"testing"
+	"time"
+)
+
+func TestChattableChatID(t *testing.T) {
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("a", "a")))
+
+	tests := []struct {
+		name   string
+		config tgbotapi.Chattable
+		want   int64
+	}{
+		{"message", tgbotapi.NewMessage(1, "text"), 1},
+		{"photo", tgbotapi.NewPhoto(2, tgbotapi.FileID("photo")), 2},
+		{"document", tgbotapi.NewDocument(3, tgbotapi.FileID("document")), 3},
+		{"media group", tgbotapi.NewMediaGroup(4, []any{tgbotapi.NewInputMediaPhoto(tgbotapi.FileID("photo"))}), 4},
+		{"edit text", tgbotapi.NewEditMessageText(5, 1, "text"), 5},
+		{"edit caption", tgbotapi.NewEditMessageCaption(6, 1, "caption"), 6},
+		{"edit reply markup", tgbotapi.NewEditMessageReplyMarkup(7, 1, keyboard), 7},
+		{"delete", tgbotapi.NewDeleteMessage(8, 1), 8},
+		{"callback answer", tgbotapi.NewCallback("id", ""), 0},
+		{"inline answer", tgbotapi.InlineConfig{InlineQueryID: "id"}, 0},
+		{"commands", tgbotapi.NewSetMyCommands(), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chattableChatID(tt.config); got != tt.want {
+				t.Errorf("got chat %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIErrorCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  *tgbotapi.Error
+		want int
+	}{
+		{"code", &tgbotapi.Error{Code: 400, Message: "Bad Request: wrong file identifier"}, 400},
+		{"upload without code", &tgbotapi.Error{Message: "Bad Request: wrong file identifier"}, 400},
+		{"upload server error", &tgbotapi.Error{Message: "Internal Server Error"}, 500},
+		{"unknown description", &tgbotapi.Error{Message: "something went wrong"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := apiErrorCode(tt.err); got != tt.want {
+				t.Errorf("got code %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimitedChatID(t *testing.T) {
+	b := &Bot{cacheChatID: -100}
+
+	if got := b.limitedChatID(tgbotapi.NewPhoto(-100, tgbotapi.FileID("photo"))); got != 0 {
+		t.Errorf("got chat %d for the cache chat, want 0", got)
+	}
+	if got := b.limitedChatID(tgbotapi.NewPhoto(5, tgbotapi.FileID("photo"))); got != 5 {
+		t.Errorf("got chat %d, want 5", got)
+	}
+}
+
+func TestRateLimiterWithoutChat(t *testing.T) {
+	l := newRateLimiter()
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		err := l.wait(ctx, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed >= chatSendInterval {
+		t.Errorf("requests without a chat waited %s, want only the global interval", elapsed)
+	}
+	if len(l.chats) != 0 {
+		t.Errorf("got %d chats reserved, want none", len(l.chats))
+	}
+
+	start = time.Now()
+	for i := 0; i < 2; i++ {
+		err := l.wait(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < chatSendInterval-globalSendInterval {
+		t.Errorf("two messages to one chat were %s apart, want about %s", elapsed, chatSendInterval)
+	}
+}
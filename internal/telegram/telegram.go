@@ -2,53 +2,135 @@ package telegram
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"github.com/fichca/image-loader/internal/dto"
+	"github.com/fichca/image-loader/internal/event"
+	"github.com/fichca/image-loader/internal/i18n"
+	"github.com/fichca/image-loader/internal/service"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/sirupsen/logrus"
 	"io"
-	"strconv"
+	"net/http"
 	"strings"
+	"sync"
+	"time"
 )
 
 type authService interface {
-	AuthorizeTG(ctx context.Context, tgID int64, login, password string) error
+	LinkTelegram(ctx context.Context, code string, tgID int64) error
+	UnlinkTelegram(ctx context.Context, tgID int64) error
+	GetTelegramIDs(ctx context.Context, userID int) ([]int64, error)
 	ValidateTGUser(ctx context.Context, tgID int64) (int, error)
 }
 
 type tgService interface {
-	GetImageObjects(ctx context.Context, userId int) ([]io.Reader, error)
+	GetImagePage(ctx context.Context, userId int, cursor dto.PageCursor, limit int) (dto.ImagePage, error)
+	AddImage(ctx context.Context, userId int, name, caption string, data io.Reader) (int, error)
+	DeleteImage(ctx context.Context, userId, imageId int) error
+	SearchImages(ctx context.Context, userId int, search string, offset, limit int) ([]dto.InlineImage, error)
+	GetImageObject(ctx context.Context, userId, imageId int) (dto.ImageObject, error)
+	SaveFileID(ctx context.Context, imageId int, fileId string) error
+	OpenImageObjects(ctx context.Context, userId int, images []dto.ImageObject) error
+	InvalidateFileIDs(ctx context.Context, imageIds []int) error
+	GetPreview(ctx context.Context, userId, imageId int) (dto.ImageObject, error)
+	NotificationEnabled(ctx context.Context, userId int, eventType event.Type) (bool, error)
+	GetNotificationSettings(ctx context.Context, userId int) (dto.NotificationSettings, error)
+	ToggleNotification(ctx context.Context, userId int, eventType event.Type) (dto.NotificationSettings, error)
+	GetUserLogin(ctx context.Context, userId int) (string, error)
+	GetChatState(ctx context.Context, chatId int64) (dto.ChatState, error)
+	SetChatState(ctx context.Context, chatId int64, state dto.ChatState) error
+	GetLanguage(ctx context.Context, tgId int64) (i18n.Lang, bool, error)
+	SetLanguage(ctx context.Context, tgId int64, lang i18n.Lang) error
+}
+
+// botClient is the part of the Bot API the bot uses. *tgbotapi.BotAPI implements it,
+// telegramtest provides one backed by a fake Bot API server.
+type botClient interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+	Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error)
+	MakeRequest(endpoint string, params tgbotapi.Params) (*tgbotapi.APIResponse, error)
+	SendMediaGroup(config tgbotapi.MediaGroupConfig) ([]tgbotapi.Message, error)
+	GetFileDirectURL(fileID string) (string, error)
+	GetUpdatesChan(config tgbotapi.UpdateConfig) tgbotapi.UpdatesChannel
+	StopReceivingUpdates()
+	HandleUpdate(r *http.Request) (*tgbotapi.Update, error)
 }
 
 type Bot struct {
 	tgService   tgService
 	authService authService
-	botAPI      *tgbotapi.BotAPI
-	l           *logrus.Logger
+	client      botClient
+	username    string
+	cacheChatID int64
+	httpClient  *http.Client
+	limiter     *rateLimiter
+	dispatcher  *dispatcher
+	// langs caches the language of each chat the bot talks to.
+	langs sync.Map
+	l     *logrus.Logger
 }
 
 const (
-	reg      = "register"
-	show     = "show"
-	startCMD = "/start"
+	reg  = "register"
+	show = "show"
+)
+
+const (
+	// maxDownloadSize is the largest file the Bot API lets bots download.
+	maxDownloadSize = 20 << 20
+	downloadTimeout = time.Minute
+	// maxPhotoSize is the largest photo the Bot API accepts, larger images are sent as documents.
+	maxPhotoSize = 10 << 20
+	// maxUploadSize is the largest document the Bot API accepts.
+	maxUploadSize = 50 << 20
 )
 
-func NewBot(token string, l *logrus.Logger, tgService tgService, authService authService) (*Bot, error) {
+var (
+	errFileTooLarge  = errors.New("file is too large")
+	errPhotoTooLarge = errors.New("image is too large for a photo")
+)
+
+// NewBot creates a bot processing updates on workers goroutines. When cacheChatID is set images are posted
+// there to get a file_id for inline queries.
+func NewBot(token string, workers int, cacheChatID int64, l *logrus.Logger, tgService tgService, authService authService) (*Bot, error) {
 	bot, err := tgbotapi.NewBotAPI(token)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Bot{
-		botAPI:      bot,
+	return NewBotWithClient(bot, bot.Self.UserName, workers, cacheChatID, l, tgService, authService), nil
+}
+
+// NewBotWithClient creates a bot talking to Telegram through client, username is the bot's own username.
+func NewBotWithClient(client botClient, username string, workers int, cacheChatID int64, l *logrus.Logger,
+	tgService tgService, authService authService) *Bot {
+	b := &Bot{
+		client:      client,
+		username:    username,
+		cacheChatID: cacheChatID,
+		httpClient:  &http.Client{Timeout: downloadTimeout},
+		limiter:     newRateLimiter(),
 		l:           l,
 		tgService:   tgService,
 		authService: authService,
-	}, nil
+	}
+	b.dispatcher = newDispatcher(workers, b.HandleUpdate)
+
+	return b
 }
 
+// StartBot receives updates with long polling, a webhook left from webhook mode is removed first
+// because Telegram refuses getUpdates while one is set.
 func (b *Bot) StartBot() {
-	bot := b.botAPI
+	bot := b.client
 
-	b.l.Infof("Authorized on account %s", bot.Self.UserName)
+	b.l.Infof("Authorized on account %s", b.username)
+
+	_, err := b.request(tgbotapi.DeleteWebhookConfig{})
+	if err != nil {
+		b.l.Error(err)
+	}
 
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
@@ -56,92 +138,208 @@ func (b *Bot) StartBot() {
 	updates := bot.GetUpdatesChan(u)
 
 	for update := range updates {
-		if update.Message != nil {
-			b.ProcessMessage(update.Message)
-
-		} else if update.CallbackQuery != nil {
-			b.l.Info(update.CallbackQuery.Data)
-			chatId := update.CallbackQuery.Message.Chat.ID
-			msgs := make([]tgbotapi.Chattable, 0)
-
-			switch update.CallbackQuery.Data {
-			case show:
-				ctx := context.Background()
-				userId, err := b.authService.ValidateTGUser(ctx, chatId)
-				if err != nil {
-					b.l.Error(err)
-					msgs = append(msgs, tgbotapi.NewMessage(chatId, "Sign up!"))
-					break
-				}
-
-				images, err := b.tgService.GetImageObjects(ctx, userId)
-				if err != nil {
-					b.l.Error(err)
-				}
-
-				for i, image := range images {
-					byt, err := io.ReadAll(image)
-					if err != nil {
-						b.l.Error(err)
-					}
-
-					msg := tgbotapi.NewPhoto(chatId, tgbotapi.FileBytes{
-						Name:  strconv.Itoa(i) + ".jpg",
-						Bytes: byt,
-					})
-					msgs = append(msgs, msg)
-				}
-			case reg:
-				msgs = append(msgs, tgbotapi.NewMessage(chatId, "Enter your username and password.\nExample: test test"))
-			}
-
-			b.sendMsgs(msgs)
+		if !b.dispatcher.dispatch(update) {
+			return
 		}
 	}
 }
 
+// Stop stops receiving updates and waits for the ones already received to be processed.
+// Webhook requests must be stopped first, for example by shutting down the HTTP server.
+func (b *Bot) Stop(ctx context.Context) error {
+	b.client.StopReceivingUpdates()
+	return b.dispatcher.stop(ctx)
+}
+
+// HandleUpdate processes an update received either by polling or by the webhook.
+func (b *Bot) HandleUpdate(update tgbotapi.Update) {
+	b.rememberLanguage(update)
+
+	if update.Message != nil {
+		b.ProcessMessage(update.Message)
+
+	} else if update.CallbackQuery != nil {
+		b.ProcessCallback(update.CallbackQuery)
+
+	} else if update.InlineQuery != nil {
+		b.processInlineQuery(update.InlineQuery)
+	}
+}
+
+func (b *Bot) ProcessCallback(query *tgbotapi.CallbackQuery) {
+	b.l.Info(query.Data)
+	b.answerCallback(query.ID)
+	chatId := query.Message.Chat.ID
+
+	switch {
+	case query.Data == show || strings.HasPrefix(query.Data, show+":"):
+		cursor, err := parseGalleryCursor(query.Data)
+		if err != nil {
+			b.l.Error(err)
+			return
+		}
+		b.showGallery(chatId, query.From.ID, cursor)
+	case query.Data == reg:
+		b.reply(chatId, i18n.LinkHelp)
+	case strings.HasPrefix(query.Data, languageCallback+":"):
+		b.setLanguage(query)
+	case strings.HasPrefix(query.Data, notifyCallback+":"):
+		b.toggleNotification(query)
+	case strings.HasPrefix(query.Data, deleteCallback+":"):
+		b.finishDelete(chatId, query.From.ID, strings.TrimPrefix(query.Data, deleteCallback+":"))
+	}
+}
+
 func (b *Bot) ProcessMessage(message *tgbotapi.Message) {
-	var msg tgbotapi.MessageConfig
+	if len(message.Photo) > 0 || isImageDocument(message.Document) {
+		b.processImage(message)
+		return
+	}
+
 	chatId := message.Chat.ID
-	switch message.Text {
-	case startCMD:
-		keyboard := tgbotapi.NewInlineKeyboardMarkup(
-			[]tgbotapi.InlineKeyboardButton{
-				tgbotapi.NewInlineKeyboardButtonData("Show images", show),
-				tgbotapi.NewInlineKeyboardButtonData("Registration", reg),
-			},
-		)
-		msg = tgbotapi.NewMessage(chatId, "Select the action")
-		msg.ReplyToMessageID = message.MessageID
-		msg.ReplyMarkup = keyboard
+	state := b.chatState(chatId)
+
+	switch {
+	case message.IsCommand():
+		b.processCommand(message, state)
+	case state.Expired:
+		b.reply(chatId, i18n.ActionTimedOut)
+	case state.State != "":
+		b.processReply(message, state)
+	case looksLikeCredentials(message.Text):
+		b.deleteMsg(chatId, message.MessageID)
+		b.reply(chatId, i18n.PasswordDeleted)
 	default:
-		var msgStr string
-		s := strings.Split(message.Text, " ")
-		if len(s) == 2 {
-			err := b.authService.AuthorizeTG(context.Background(), message.From.ID, s[0], s[1])
-			if err != nil {
-				msgStr = "Incorrect login or password"
-				b.l.Error(err)
-			} else {
-				msgStr = "You are registered!"
-			}
-		} else {
-			msgStr = "Unknown command, enter:/start"
-		}
+		b.reply(chatId, i18n.UnknownCommand)
+	}
+}
+
+// processImage saves a photo or an image document sent by a linked user.
+func (b *Bot) processImage(message *tgbotapi.Message) {
+	chatId := message.Chat.ID
+	ctx := context.Background()
+
+	userId, err := b.authService.ValidateTGUser(ctx, message.From.ID)
+	if err != nil {
+		b.l.Error(err)
+		b.reply(chatId, i18n.SignUp)
+		return
+	}
+
+	var fileID, name string
+	var size int
+	if len(message.Photo) > 0 {
+		photo := largestPhoto(message.Photo)
+		fileID, size = photo.FileID, photo.FileSize
+		name = "telegram_" + photo.FileUniqueID + ".jpg"
+	} else {
+		fileID, size = message.Document.FileID, message.Document.FileSize
+		name = message.Document.FileName
+	}
+
+	data, err := b.downloadFile(fileID, size)
+	if err != nil {
+		b.l.Error(err)
+		b.reply(chatId, i18n.SaveImageFailed)
+		return
+	}
+	defer data.Close()
 
-		msg = tgbotapi.NewMessage(chatId, msgStr)
+	imageId, err := b.tgService.AddImage(ctx, userId, name, message.Caption, data)
+	if errors.Is(err, service.ErrUnsupportedImageType) {
+		b.reply(chatId, i18n.NotAnImage)
+		return
 	}
+	if err != nil {
+		b.l.Error(err)
+		b.reply(chatId, i18n.SaveImageFailed)
+		return
+	}
+
+	if len(message.Photo) > 0 {
+		b.saveFileID(imageId, largestPhoto(message.Photo).FileID)
+	}
+
+	msg := tgbotapi.NewMessage(chatId, b.text(chatId, i18n.ImageSaved, imageId))
+	msg.ReplyToMessageID = message.MessageID
 	b.sendMsg(msg)
 }
 
-func (b *Bot) sendMsgs(msgs []tgbotapi.Chattable) {
-	for _, msg := range msgs {
-		b.sendMsg(msg)
+func (b *Bot) downloadFile(fileID string, size int) (io.ReadCloser, error) {
+	if size > maxDownloadSize {
+		return nil, errFileTooLarge
 	}
+
+	url, err := b.client.GetFileDirectURL(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file url: %w", err)
+	}
+
+	resp, err := b.httpClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to download file: %s", resp.Status)
+	}
+
+	return resp.Body, nil
+}
+
+func largestPhoto(photos []tgbotapi.PhotoSize) tgbotapi.PhotoSize {
+	largest := photos[0]
+	for _, photo := range photos[1:] {
+		if photo.Width*photo.Height > largest.Width*largest.Height {
+			largest = photo
+		}
+	}
+	return largest
+}
+
+// isImageDocument reports whether the document is declared to be an image. The declared type only
+// decides whether the document is saved at all, the type of the image is detected from its content.
+func isImageDocument(document *tgbotapi.Document) bool {
+	return document != nil && strings.HasPrefix(document.MimeType, "image/")
 }
 
 func (b *Bot) sendMsg(msg tgbotapi.Chattable) {
-	_, err := b.botAPI.Send(msg)
+	_, err := b.send(msg)
+	if err != nil {
+		b.l.Error(err)
+	}
+}
+
+// linkAccount links the Telegram account with the code and returns the message telling how it went.
+func (b *Bot) linkAccount(tgUserId int64, code string) i18n.Key {
+	err := b.authService.LinkTelegram(context.Background(), strings.TrimSpace(code), tgUserId)
+	switch {
+	case errors.Is(err, service.ErrTelegramAlreadyLinked):
+		return i18n.AlreadyLinked
+	case errors.Is(err, service.ErrInvalidLinkCode):
+		return i18n.LinkCodeInvalid
+	case err != nil:
+		b.l.Error(err)
+		return i18n.LinkFailed
+	}
+	return i18n.Linked
+}
+
+// looksLikeCredentials reports whether the text is shaped like the "login password" message
+// the bot used to ask for, such messages are removed from the chat history.
+func looksLikeCredentials(text string) bool {
+	return !strings.HasPrefix(text, "/") && len(strings.Fields(text)) == 2
+}
+
+func (b *Bot) deleteMsg(chatId int64, messageId int) {
+	_, err := b.request(tgbotapi.NewDeleteMessage(chatId, messageId))
+	if err != nil {
+		b.l.Error(err)
+	}
+}
+
+func (b *Bot) answerCallback(id string) {
+	_, err := b.request(tgbotapi.NewCallback(id, ""))
 	if err != nil {
 		b.l.Error(err)
 	}
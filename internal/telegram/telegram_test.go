@@ -0,0 +1,690 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/fichca/image-loader/internal/dto"
+	"github.com/fichca/image-loader/internal/event"
+	"github.com/fichca/image-loader/internal/i18n"
+	"github.com/fichca/image-loader/internal/service"
+	"github.com/fichca/image-loader/internal/telegram/telegramtest"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	// linkedTgID is the Telegram user linked to linkedUserID, any other Telegram user is not linked.
+	linkedTgID   = 42
+	linkedUserID = 7
+	validCode    = "CODE1234"
+	waitTimeout  = 5 * time.Second
+)
+
+var pngData = []byte("\x89PNG\r\n\x1a\nimage")
+
+type addedImage struct {
+	userID  int
+	name    string
+	caption string
+	data    []byte
+}
+
+// fakeTgService keeps what the bot stored. Methods the tests do not reach are left to the
+// embedded nil interface and panic when called.
+type fakeTgService struct {
+	tgService
+
+	mu          sync.Mutex
+	page        dto.ImagePage
+	cursors     []dto.PageCursor
+	added       []addedImage
+	fileIDs     map[int]string
+	invalidated []int
+	// found is what SearchImages returns
+	found []dto.InlineImage
+	muted map[event.Type]bool
+}
+
+func newFakeTgService() *fakeTgService {
+	return &fakeTgService{fileIDs: make(map[int]string)}
+}
+
+func (s *fakeTgService) GetLanguage(ctx context.Context, tgId int64) (i18n.Lang, bool, error) {
+	return "", false, nil
+}
+
+func (s *fakeTgService) GetChatState(ctx context.Context, chatId int64) (dto.ChatState, error) {
+	return dto.ChatState{}, nil
+}
+
+func (s *fakeTgService) SetChatState(ctx context.Context, chatId int64, state dto.ChatState) error {
+	return nil
+}
+
+func (s *fakeTgService) GetImagePage(ctx context.Context, userId int, cursor dto.PageCursor, limit int) (dto.ImagePage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cursors = append(s.cursors, cursor)
+
+	page := s.page
+	page.Images = make([]dto.ImageObject, 0, len(s.page.Images))
+	for _, image := range s.page.Images {
+		if image.FileID == "" {
+			image.Data = io.NopCloser(bytes.NewReader(pngData))
+		}
+		page.Images = append(page.Images, image)
+	}
+	return page, nil
+}
+
+// OpenImageObjects names and opens the images like TelegramService.OpenImageObjects does.
+func (s *fakeTgService) OpenImageObjects(ctx context.Context, userId int, images []dto.ImageObject) error {
+	for i := range images {
+		if images[i].FileID == "" && images[i].Data == nil {
+			images[i].Name = strconv.Itoa(images[i].ID) + ".png"
+			images[i].Data = io.NopCloser(bytes.NewReader(pngData))
+		}
+	}
+	return nil
+}
+
+func (s *fakeTgService) InvalidateFileIDs(ctx context.Context, imageIds []int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.invalidated = append(s.invalidated, imageIds...)
+	return nil
+}
+
+func (s *fakeTgService) AddImage(ctx context.Context, userId int, name, caption string, data io.Reader) (int, error) {
+	b, err := io.ReadAll(data)
+	if err != nil {
+		return 0, err
+	}
+	if !strings.HasPrefix(http.DetectContentType(b), "image/") {
+		return 0, service.ErrUnsupportedImageType
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.added = append(s.added, addedImage{userID: userId, name: name, caption: caption, data: b})
+	return len(s.added), nil
+}
+
+func (s *fakeTgService) SearchImages(ctx context.Context, userId int, search string, offset, limit int) ([]dto.InlineImage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]dto.InlineImage(nil), s.found...), nil
+}
+
+func (s *fakeTgService) GetImageObject(ctx context.Context, userId, imageId int) (dto.ImageObject, error) {
+	return dto.ImageObject{ID: imageId, Name: strconv.Itoa(imageId) + ".png", Data: io.NopCloser(bytes.NewReader(pngData))}, nil
+}
+
+func (s *fakeTgService) SaveFileID(ctx context.Context, imageId int, fileId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fileIDs[imageId] = fileId
+	return nil
+}
+
+func (s *fakeTgService) NotificationEnabled(ctx context.Context, userId int, eventType event.Type) (bool, error) {
+	return !s.muted[eventType], nil
+}
+
+func (s *fakeTgService) snapshot() ([]dto.PageCursor, []addedImage, map[int]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fileIDs := make(map[int]string, len(s.fileIDs))
+	for id, fileID := range s.fileIDs {
+		fileIDs[id] = fileID
+	}
+	return append([]dto.PageCursor(nil), s.cursors...), append([]addedImage(nil), s.added...), fileIDs
+}
+
+type fakeAuthService struct {
+	mu     sync.Mutex
+	linked map[int64]string
+}
+
+func newFakeAuthService() *fakeAuthService {
+	return &fakeAuthService{linked: make(map[int64]string)}
+}
+
+func (s *fakeAuthService) LinkTelegram(ctx context.Context, code string, tgID int64) error {
+	if code != validCode {
+		return service.ErrInvalidLinkCode
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.linked[tgID] = code
+	return nil
+}
+
+func (s *fakeAuthService) UnlinkTelegram(ctx context.Context, tgID int64) error {
+	return service.ErrTelegramNotLinked
+}
+
+func (s *fakeAuthService) GetTelegramIDs(ctx context.Context, userID int) ([]int64, error) {
+	return []int64{linkedTgID}, nil
+}
+
+func (s *fakeAuthService) ValidateTGUser(ctx context.Context, tgID int64) (int, error) {
+	if tgID != linkedTgID {
+		return 0, errors.New("telegram user is not linked")
+	}
+	return linkedUserID, nil
+}
+
+// startBot runs a bot polling a fake Bot API server until the test ends.
+func startBot(t *testing.T, tg *fakeTgService, auth *fakeAuthService) *telegramtest.Server {
+	t.Helper()
+
+	return startBotWithCacheChat(t, tg, auth, 0)
+}
+
+// startBotWithCacheChat runs a bot that uploads images for inline queries to cacheChatID.
+func startBotWithCacheChat(t *testing.T, tg *fakeTgService, auth *fakeAuthService, cacheChatID int64) *telegramtest.Server {
+	t.Helper()
+
+	srv := telegramtest.NewServer()
+	client, err := srv.NewClient()
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	bot := NewBotWithClient(client, srv.BotUsername, 1, cacheChatID, logger, tg, auth)
+	go bot.StartBot()
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+		defer cancel()
+
+		err := bot.Stop(ctx)
+		if err != nil {
+			t.Error(err)
+		}
+		srv.Close()
+	})
+
+	return srv
+}
+
+func waitForText(t *testing.T, srv *telegramtest.Server, n int) []telegramtest.Request {
+	t.Helper()
+
+	reqs, err := srv.WaitForRequests("sendMessage", n, waitTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reqs
+}
+
+func TestStartWithLinkCode(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		code   string
+		want   i18n.Key
+		linked bool
+	}{
+		{"valid code", validCode, i18n.Linked, true},
+		{"invalid code", "WRONG", i18n.LinkCodeInvalid, false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			auth := newFakeAuthService()
+			srv := startBot(t, newFakeTgService(), auth)
+
+			srv.SendText(100, "/start "+tt.code)
+
+			reqs := waitForText(t, srv, 1)
+			if got, want := reqs[0].Params.Get("text"), i18n.T(i18n.Default, tt.want); got != want {
+				t.Errorf("got reply %q, want %q", got, want)
+			}
+
+			auth.mu.Lock()
+			_, linked := auth.linked[100]
+			auth.mu.Unlock()
+			if linked != tt.linked {
+				t.Errorf("got linked %v, want %v", linked, tt.linked)
+			}
+		})
+	}
+}
+
+func TestCredentialsAreDeleted(t *testing.T) {
+	t.Parallel()
+
+	srv := startBot(t, newFakeTgService(), newFakeAuthService())
+
+	sent := srv.SendText(100, "john password1")
+
+	reqs := waitForText(t, srv, 1)
+	if got, want := reqs[0].Params.Get("text"), i18n.T(i18n.Default, i18n.PasswordDeleted); got != want {
+		t.Errorf("got reply %q, want %q", got, want)
+	}
+
+	deleted := srv.Requests("deleteMessage")
+	if len(deleted) != 1 || deleted[0].Params.Get("message_id") != strconv.Itoa(sent.Message.MessageID) {
+		t.Errorf("got deletions %+v, want the message %d", deleted, sent.Message.MessageID)
+	}
+}
+
+func TestGalleryCursor(t *testing.T) {
+	t.Parallel()
+
+	tg := newFakeTgService()
+	tg.page = dto.ImagePage{
+		Images: []dto.ImageObject{
+			{ID: 11, Name: "11.png", Description: "first"},
+			{ID: 12, Name: "12.png", Description: "second"},
+		},
+		HasPrev: true,
+		HasNext: true,
+	}
+	srv := startBot(t, tg, newFakeAuthService())
+
+	srv.PressButton(linkedTgID, "show:n:10")
+
+	reqs := waitForText(t, srv, 1)
+
+	cursors, _, fileIDs := tg.snapshot()
+	if len(cursors) != 1 || cursors[0] != (dto.PageCursor{ImageID: 10}) {
+		t.Errorf("got cursors %+v, want the page after image 10", cursors)
+	}
+
+	albums := srv.Requests("sendMediaGroup")
+	if len(albums) != 1 {
+		t.Fatalf("got %d albums, want 1", len(albums))
+	}
+	if len(albums[0].Files) != 2 {
+		t.Errorf("got %d uploaded photos, want 2", len(albums[0].Files))
+	}
+	if len(fileIDs) != 2 || fileIDs[11] == "" || fileIDs[12] == "" {
+		t.Errorf("got cached file_ids %v, want one for both images", fileIDs)
+	}
+
+	markup := reqs[0].Params.Get("reply_markup")
+	for _, data := range []string{"show:p:11", "show:n:12"} {
+		if !strings.Contains(markup, `"`+data+`"`) {
+			t.Errorf("got keyboard %s, want a %s button", markup, data)
+		}
+	}
+
+	if got := len(srv.Requests("answerCallbackQuery")); got != 1 {
+		t.Errorf("got %d callback answers, want 1", got)
+	}
+}
+
+func TestGalleryCachedFileIDs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		rejected bool
+		// uploads is how many photos each sendMediaGroup request uploads
+		uploads []int
+		saved   []int
+	}{
+		{"reused", false, []int{1}, []int{12}},
+		{"rejected", true, []int{1, 2}, []int{11, 12}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tg := newFakeTgService()
+			tg.page = dto.ImagePage{Images: []dto.ImageObject{
+				{ID: 11, Name: "11.png", FileID: "cached-11"},
+				{ID: 12, Name: "12.png"},
+			}}
+			srv := startBot(t, tg, newFakeAuthService())
+			if tt.rejected {
+				srv.FailNext("sendMediaGroup", http.StatusBadRequest, 0)
+			}
+
+			srv.PressButton(linkedTgID, show)
+			waitForText(t, srv, 1)
+
+			albums := srv.Requests("sendMediaGroup")
+			if len(albums) != len(tt.uploads) {
+				t.Fatalf("got %d albums sent, want %d", len(albums), len(tt.uploads))
+			}
+			for i, album := range albums {
+				if len(album.Files) != tt.uploads[i] {
+					t.Errorf("album %d uploaded %d photos, want %d", i, len(album.Files), tt.uploads[i])
+				}
+			}
+			if !strings.Contains(albums[0].Params.Get("media"), `"cached-11"`) {
+				t.Errorf("got media %s, want the cached file_id", albums[0].Params.Get("media"))
+			}
+
+			_, _, fileIDs := tg.snapshot()
+			if len(fileIDs) != len(tt.saved) {
+				t.Errorf("got file_ids %v saved, want ones for images %v", fileIDs, tt.saved)
+			}
+			for _, id := range tt.saved {
+				if fileIDs[id] == "" {
+					t.Errorf("got no file_id saved for image %d", id)
+				}
+			}
+
+			tg.mu.Lock()
+			invalidated := tg.invalidated
+			tg.mu.Unlock()
+			if tt.rejected != (len(invalidated) == 1 && invalidated[0] == 11) {
+				t.Errorf("got file_ids of images %v invalidated", invalidated)
+			}
+		})
+	}
+}
+
+func TestGallerySendsLargeImagesAsDocuments(t *testing.T) {
+	t.Parallel()
+
+	tg := newFakeTgService()
+	tg.page = dto.ImagePage{
+		Images: []dto.ImageObject{
+			{ID: 11, Name: "11.png", Size: int64(len(pngData))},
+			{ID: 12, Name: "12.png"},
+			{ID: 13, Name: "13.png", Description: "large", Size: maxPhotoSize + 1},
+			{ID: 14, Name: "14.png", Size: maxUploadSize + 1},
+		},
+	}
+	srv := startBot(t, tg, newFakeAuthService())
+
+	srv.PressButton(linkedTgID, "show")
+
+	waitForText(t, srv, 1)
+
+	albums := srv.Requests("sendMediaGroup")
+	if len(albums) != 1 || len(albums[0].Files) != 2 {
+		t.Fatalf("got albums %+v, want one with the 2 small images", albums)
+	}
+
+	documents := srv.Requests("sendDocument")
+	if len(documents) != 1 {
+		t.Fatalf("got %d documents, want 1", len(documents))
+	}
+	if got := documents[0].Params.Get("caption"); got != "large" {
+		t.Errorf("got caption %q, want the description of image 13", got)
+	}
+	if !bytes.Equal(documents[0].Files["document"], pngData) {
+		t.Errorf("got document %q, want %q", documents[0].Files["document"], pngData)
+	}
+}
+
+func TestImageFileOfUnknownSize(t *testing.T) {
+	data := bytes.Repeat([]byte{1}, maxPhotoSize+1)
+	image := dto.ImageObject{ID: 1, Name: "1.png", Data: io.NopCloser(bytes.NewReader(data))}
+
+	_, err := imageFile(&image)
+	if !errors.Is(err, errPhotoTooLarge) {
+		t.Fatalf("got error %v, want %v", err, errPhotoTooLarge)
+	}
+
+	got, err := io.ReadAll(image.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("got %d bytes back, want the whole image of %d", len(got), len(data))
+	}
+}
+
+func TestUploadImage(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		send     func(srv *telegramtest.Server)
+		wantName string
+		caption  string
+		cached   bool
+	}{
+		{
+			name: "photo",
+			send: func(srv *telegramtest.Server) {
+				srv.SendPhoto(linkedTgID, pngData, "sunset")
+			},
+			wantName: "telegram_unique-fake-file-1.jpg",
+			caption:  "sunset",
+			cached:   true,
+		},
+		{
+			name: "document",
+			send: func(srv *telegramtest.Server) {
+				srv.SendDocument(linkedTgID, "cat.png", "image/png", pngData, "")
+			},
+			wantName: "cat.png",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tg := newFakeTgService()
+			srv := startBot(t, tg, newFakeAuthService())
+
+			tt.send(srv)
+
+			reqs := waitForText(t, srv, 1)
+			if got, want := reqs[0].Params.Get("text"), i18n.T(i18n.Default, i18n.ImageSaved, 1); got != want {
+				t.Errorf("got reply %q, want %q", got, want)
+			}
+
+			_, added, fileIDs := tg.snapshot()
+			if len(added) != 1 {
+				t.Fatalf("got %d images, want 1", len(added))
+			}
+			image := added[0]
+			if image.userID != linkedUserID || image.name != tt.wantName || image.caption != tt.caption {
+				t.Errorf("got image of user %d named %q with caption %q, want %d, %q and %q",
+					image.userID, image.name, image.caption, linkedUserID, tt.wantName, tt.caption)
+			}
+			if !bytes.Equal(image.data, pngData) {
+				t.Errorf("got data %q, want %q", image.data, pngData)
+			}
+			if cached := fileIDs[1] != ""; cached != tt.cached {
+				t.Errorf("got file_id cached %v, want %v", cached, tt.cached)
+			}
+		})
+	}
+}
+
+func TestUploadDocumentThatIsNotAnImage(t *testing.T) {
+	t.Parallel()
+
+	tg := newFakeTgService()
+	srv := startBot(t, tg, newFakeAuthService())
+
+	srv.SendDocument(linkedTgID, "cat.png", "image/png", []byte("<html><body>not a cat</body></html>"), "")
+
+	reqs := waitForText(t, srv, 1)
+	if got, want := reqs[0].Params.Get("text"), i18n.T(i18n.Default, i18n.NotAnImage); got != want {
+		t.Errorf("got reply %q, want %q", got, want)
+	}
+	if _, added, _ := tg.snapshot(); len(added) != 0 {
+		t.Errorf("got %d images, want none", len(added))
+	}
+}
+
+func TestUploadFromUnlinkedUser(t *testing.T) {
+	t.Parallel()
+
+	tg := newFakeTgService()
+	srv := startBot(t, tg, newFakeAuthService())
+
+	srv.SendPhoto(100, pngData, "")
+
+	reqs := waitForText(t, srv, 1)
+	if got, want := reqs[0].Params.Get("text"), i18n.T(i18n.Default, i18n.SignUp); got != want {
+		t.Errorf("got reply %q, want %q", got, want)
+	}
+	if _, added, _ := tg.snapshot(); len(added) != 0 {
+		t.Errorf("got %d images, want none", len(added))
+	}
+}
+
+func TestAlbumsNotSupported(t *testing.T) {
+	t.Parallel()
+
+	srv := startBot(t, newFakeTgService(), newFakeAuthService())
+
+	srv.SendText(100, "/albums")
+
+	reqs := waitForText(t, srv, 1)
+	if got, want := reqs[0].Params.Get("text"), i18n.T(i18n.Default, i18n.AlbumsNotSupported); got != want {
+		t.Errorf("got reply %q, want %q", got, want)
+	}
+}
+
+func TestInlineQuery(t *testing.T) {
+	t.Parallel()
+
+	const cacheChatID = -100
+
+	tg := newFakeTgService()
+	tg.found = []dto.InlineImage{
+		{ID: 1, Title: "cat.png", Description: "cat", FileID: "cached-file"},
+		{ID: 2, Title: "dog.png", Description: "dog"},
+	}
+	srv := startBotWithCacheChat(t, tg, newFakeAuthService(), cacheChatID)
+
+	srv.SendInlineQuery(linkedTgID, "cat", "")
+
+	reqs, err := srv.WaitForRequests("answerInlineQuery", 1, waitTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uploads := srv.Requests("sendPhoto")
+	if len(uploads) != 1 || uploads[0].Params.Get("chat_id") != strconv.Itoa(cacheChatID) {
+		t.Fatalf("got uploads %+v, want the uncached image posted to the cache chat", uploads)
+	}
+	_, _, fileIDs := tg.snapshot()
+	if fileIDs[2] == "" {
+		t.Errorf("got cached file_ids %v, want one for the uploaded image", fileIDs)
+	}
+
+	results := reqs[0].Params.Get("results")
+	for _, fileID := range []string{"cached-file", fileIDs[2]} {
+		if !strings.Contains(results, `"photo_file_id":"`+fileID+`"`) {
+			t.Errorf("got results %s, want a photo %s", results, fileID)
+		}
+	}
+}
+
+func TestInlineQueryFromUnlinkedUser(t *testing.T) {
+	t.Parallel()
+
+	srv := startBot(t, newFakeTgService(), newFakeAuthService())
+
+	srv.SendInlineQuery(100, "cat", "")
+
+	reqs, err := srv.WaitForRequests("answerInlineQuery", 1, waitTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reqs[0].Params.Get("switch_pm_parameter"); got != linkStartParam {
+		t.Errorf("got switch_pm_parameter %q, want %q", got, linkStartParam)
+	}
+	if got := reqs[0].Params.Get("results"); got != "[]" {
+		t.Errorf("got results %s, want none", got)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		source string
+		muted  bool
+		want   int
+	}{
+		{"from the api", event.SourceAPI, false, 1},
+		{"from telegram", event.SourceTelegram, false, 0},
+		{"muted", event.SourceAPI, true, 0},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			srv := telegramtest.NewServer()
+			t.Cleanup(srv.Close)
+			client, err := srv.NewClient()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			logger := logrus.New()
+			logger.SetOutput(io.Discard)
+
+			tg := newFakeTgService()
+			tg.muted = map[event.Type]bool{event.ProfileUpdated: tt.muted}
+			bot := NewBotWithClient(client, srv.BotUsername, 1, 0, logger, tg, newFakeAuthService())
+
+			bot.Notify(context.Background(), event.Event{Type: event.ProfileUpdated, UserID: linkedUserID, Source: tt.source})
+
+			reqs := srv.Requests("sendMessage")
+			if len(reqs) != tt.want {
+				t.Fatalf("got %d notifications, want %d", len(reqs), tt.want)
+			}
+			if tt.want > 0 && reqs[0].Params.Get("chat_id") != strconv.Itoa(linkedTgID) {
+				t.Errorf("got a notification to chat %s, want the linked chat %d", reqs[0].Params.Get("chat_id"), linkedTgID)
+			}
+		})
+	}
+}
+
+func TestRetryAfterFloodControl(t *testing.T) {
+	t.Parallel()
+
+	srv := startBot(t, newFakeTgService(), newFakeAuthService())
+	srv.FailNext("sendMessage", 429, 1)
+
+	start := time.Now()
+	srv.SendText(100, "/help")
+
+	reqs := waitForText(t, srv, 2)
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, want at least the 1s retry_after", elapsed)
+	}
+	if reqs[0].Params.Get("text") != reqs[1].Params.Get("text") {
+		t.Errorf("the retry sent %q, want the same message as %q", reqs[1].Params.Get("text"), reqs[0].Params.Get("text"))
+	}
+	if len(reqs) != 2 {
+		t.Errorf("got %d attempts, want 2", len(reqs))
+	}
+}
@@ -0,0 +1,21 @@
+package telegramtest
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Client is a Bot API client bound to a fake server. tgbotapi builds file download links
+// from a hardcoded api.telegram.org endpoint, so GetFileDirectURL is redirected to the server.
+type Client struct {
+	*tgbotapi.BotAPI
+	server *Server
+}
+
+func (c *Client) GetFileDirectURL(fileID string) (string, error) {
+	file, err := c.GetFile(tgbotapi.FileConfig{FileID: fileID})
+	if err != nil {
+		return "", err
+	}
+
+	return c.server.URL + "/file/bot" + c.Token + "/" + file.FilePath, nil
+}
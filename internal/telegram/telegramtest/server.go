@@ -0,0 +1,467 @@
+// Package telegramtest provides a fake Telegram Bot API server for end-to-end tests of the bot.
+//
+// The server records every method the bot calls, serves scripted updates to getUpdates and
+// stores files that the bot can download, so registration, gallery and upload flows can be
+// driven without Telegram:
+//
+//	srv := telegramtest.NewServer()
+//	defer srv.Close()
+//
+//	client, _ := srv.NewClient()
+//	bot := telegram.NewBotWithClient(client, srv.BotUsername, 1, 0, logger, tgService, authService)
+//	go bot.StartBot()
+//
+//	srv.SendText(42, "/start "+code)
+//	reqs, _ := srv.WaitForRequests("sendMessage", 1, time.Second)
+package telegramtest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	Token       = "123456:TEST"
+	BotUsername = "test_bot"
+	botID       = 1
+)
+
+// maxPollWait caps how long getUpdates waits for new updates, so bots stop quickly after Close.
+const maxPollWait = time.Second
+
+// Request is a Bot API call made by the bot.
+type Request struct {
+	Method string
+	Params url.Values
+	// Files holds uploaded files by form field name.
+	Files map[string][]byte
+}
+
+type failure struct {
+	code       int
+	retryAfter int
+}
+
+// Server is a fake Bot API server. It is safe for concurrent use.
+type Server struct {
+	*httptest.Server
+	BotUsername string
+
+	mu            sync.Mutex
+	requests      []Request
+	updates       []tgbotapi.Update
+	files         map[string][]byte
+	failures      map[string][]failure
+	nextUpdateID  int
+	nextMessageID int
+	nextFileID    int
+	changed       chan struct{}
+}
+
+func NewServer() *Server {
+	s := &Server{
+		BotUsername:  BotUsername,
+		files:        make(map[string][]byte),
+		failures:     make(map[string][]failure),
+		nextUpdateID: 1,
+		changed:      make(chan struct{}),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Endpoint is the API endpoint format for tgbotapi.NewBotAPIWithAPIEndpoint.
+func (s *Server) Endpoint() string {
+	return s.URL + "/bot%s/%s"
+}
+
+// NewClient returns a Bot API client talking to the server.
+func (s *Server) NewClient() (*Client, error) {
+	api, err := tgbotapi.NewBotAPIWithAPIEndpoint(Token, s.Endpoint())
+	if err != nil {
+		return nil, err
+	}
+	return &Client{BotAPI: api, server: s}, nil
+}
+
+// AddUpdate queues an update for getUpdates and returns it with its update_id set.
+func (s *Server) AddUpdate(update tgbotapi.Update) tgbotapi.Update {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	update.UpdateID = s.nextUpdateID
+	s.nextUpdateID++
+	s.updates = append(s.updates, update)
+	s.notify()
+
+	return update
+}
+
+// SendText scripts a private text message from the Telegram user.
+func (s *Server) SendText(userID int64, text string) tgbotapi.Update {
+	message := s.newMessage(userID)
+	message.Text = text
+	if strings.HasPrefix(text, "/") {
+		length := len(strings.Fields(text)[0])
+		message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: length}}
+	}
+	return s.AddUpdate(tgbotapi.Update{Message: message})
+}
+
+// SendPhoto scripts a photo message, data is served when the bot downloads the photo.
+func (s *Server) SendPhoto(userID int64, data []byte, caption string) tgbotapi.Update {
+	fileID := s.AddFile(data)
+
+	message := s.newMessage(userID)
+	message.Caption = caption
+	message.Photo = []tgbotapi.PhotoSize{{
+		FileID:       fileID,
+		FileUniqueID: "unique-" + fileID,
+		Width:        800,
+		Height:       600,
+		FileSize:     len(data),
+	}}
+	return s.AddUpdate(tgbotapi.Update{Message: message})
+}
+
+// SendDocument scripts a document message, data is served when the bot downloads the document.
+func (s *Server) SendDocument(userID int64, name, mimeType string, data []byte, caption string) tgbotapi.Update {
+	fileID := s.AddFile(data)
+
+	message := s.newMessage(userID)
+	message.Caption = caption
+	message.Document = &tgbotapi.Document{
+		FileID:       fileID,
+		FileUniqueID: "unique-" + fileID,
+		FileName:     name,
+		MimeType:     mimeType,
+		FileSize:     len(data),
+	}
+	return s.AddUpdate(tgbotapi.Update{Message: message})
+}
+
+// PressButton scripts a press of an inline keyboard button carrying data.
+func (s *Server) PressButton(userID int64, data string) tgbotapi.Update {
+	message := s.newMessage(userID)
+	message.From = &tgbotapi.User{ID: botID, IsBot: true, UserName: s.BotUsername}
+
+	return s.AddUpdate(tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:      strconv.Itoa(message.MessageID),
+		From:    &tgbotapi.User{ID: userID, UserName: "user" + strconv.FormatInt(userID, 10)},
+		Message: message,
+		Data:    data,
+	}})
+}
+
+// SendInlineQuery scripts an inline query typed by the user in any chat.
+func (s *Server) SendInlineQuery(userID int64, query, offset string) tgbotapi.Update {
+	message := s.newMessage(userID)
+
+	return s.AddUpdate(tgbotapi.Update{InlineQuery: &tgbotapi.InlineQuery{
+		ID:     strconv.Itoa(message.MessageID),
+		From:   message.From,
+		Query:  query,
+		Offset: offset,
+	}})
+}
+
+// AddFile stores data for download and returns its file_id.
+func (s *Server) AddFile(data []byte) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextFileID++
+	fileID := "fake-file-" + strconv.Itoa(s.nextFileID)
+	s.files[fileID] = data
+
+	return fileID
+}
+
+// FailNext makes the next call of method fail with code, a positive retryAfter is sent as
+// retry_after like Telegram does for 429 Too Many Requests.
+func (s *Server) FailNext(method string, code, retryAfter int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[method] = append(s.failures[method], failure{code: code, retryAfter: retryAfter})
+}
+
+// Requests returns the calls made so far, with method set only the calls of that method.
+func (s *Server) Requests(method string) []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.filter(method)
+}
+
+// WaitForRequests waits until at least n calls of method were made.
+func (s *Server) WaitForRequests(method string, n int, timeout time.Duration) ([]Request, error) {
+	deadline := time.After(timeout)
+
+	for {
+		s.mu.Lock()
+		requests := s.filter(method)
+		changed := s.changed
+		s.mu.Unlock()
+
+		if len(requests) >= n {
+			return requests, nil
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return requests, fmt.Errorf("got %d %s requests, want %d", len(requests), method, n)
+		}
+	}
+}
+
+func (s *Server) filter(method string) []Request {
+	requests := make([]Request, 0, len(s.requests))
+	for _, req := range s.requests {
+		if method == "" || req.Method == method {
+			requests = append(requests, req)
+		}
+	}
+	return requests
+}
+
+func (s *Server) newMessage(userID int64) *tgbotapi.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextMessageID++
+	return &tgbotapi.Message{
+		MessageID: s.nextMessageID,
+		From:      &tgbotapi.User{ID: userID, UserName: "user" + strconv.FormatInt(userID, 10), LanguageCode: "en"},
+		Chat:      &tgbotapi.Chat{ID: userID, Type: "private"},
+		Date:      int(time.Now().Unix()),
+	}
+}
+
+// notify wakes up everyone waiting for updates or requests, s.mu must be held.
+func (s *Server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	filePrefix := "/file/bot" + Token + "/"
+	if strings.HasPrefix(r.URL.Path, filePrefix) {
+		s.serveFile(w, strings.TrimPrefix(r.URL.Path, filePrefix))
+		return
+	}
+
+	prefix := "/bot" + Token + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		writeResult(w, tgbotapi.APIResponse{Ok: false, ErrorCode: http.StatusNotFound, Description: "Not Found"})
+		return
+	}
+
+	req, err := parseRequest(strings.TrimPrefix(r.URL.Path, prefix), r)
+	if err != nil {
+		writeResult(w, tgbotapi.APIResponse{Ok: false, ErrorCode: http.StatusBadRequest, Description: err.Error()})
+		return
+	}
+
+	if req.Method == "getUpdates" {
+		s.serveUpdates(w, req)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	failures := s.failures[req.Method]
+	var fail *failure
+	if len(failures) > 0 {
+		fail = &failures[0]
+		s.failures[req.Method] = failures[1:]
+	}
+	s.notify()
+	s.mu.Unlock()
+
+	if fail != nil {
+		resp := tgbotapi.APIResponse{Ok: false, ErrorCode: fail.code, Description: http.StatusText(fail.code)}
+		if fail.retryAfter > 0 {
+			resp.Parameters = &tgbotapi.ResponseParameters{RetryAfter: fail.retryAfter}
+		}
+		writeResult(w, resp)
+		return
+	}
+
+	result, err := s.result(req)
+	if err != nil {
+		writeResult(w, tgbotapi.APIResponse{Ok: false, ErrorCode: http.StatusBadRequest, Description: err.Error()})
+		return
+	}
+
+	writeResult(w, tgbotapi.APIResponse{Ok: true, Result: result})
+}
+
+func (s *Server) serveUpdates(w http.ResponseWriter, req Request) {
+	offset, _ := strconv.Atoi(req.Params.Get("offset"))
+	wait, _ := strconv.Atoi(req.Params.Get("timeout"))
+	deadline := time.After(minDuration(time.Duration(wait)*time.Second, maxPollWait))
+
+	for {
+		s.mu.Lock()
+		updates := make([]tgbotapi.Update, 0)
+		for _, update := range s.updates {
+			if update.UpdateID >= offset {
+				updates = append(updates, update)
+			}
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		if len(updates) > 0 {
+			result, _ := json.Marshal(updates)
+			writeResult(w, tgbotapi.APIResponse{Ok: true, Result: result})
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			writeResult(w, tgbotapi.APIResponse{Ok: true, Result: json.RawMessage("[]")})
+			return
+		}
+	}
+}
+
+func (s *Server) serveFile(w http.ResponseWriter, fileID string) {
+	s.mu.Lock()
+	data, ok := s.files[fileID]
+	s.mu.Unlock()
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_, _ = w.Write(data)
+}
+
+// result builds the successful response of a Bot API method.
+func (s *Server) result(req Request) (json.RawMessage, error) {
+	chatID, _ := strconv.ParseInt(req.Params.Get("chat_id"), 10, 64)
+
+	switch req.Method {
+	case "getMe":
+		return json.Marshal(tgbotapi.User{ID: botID, IsBot: true, FirstName: "Test", UserName: s.BotUsername})
+	case "getFile":
+		fileID := req.Params.Get("file_id")
+		s.mu.Lock()
+		data, ok := s.files[fileID]
+		s.mu.Unlock()
+		if !ok {
+			return nil, errors.New("file not found")
+		}
+		return json.Marshal(tgbotapi.File{FileID: fileID, FileSize: len(data), FilePath: fileID})
+	case "sendMessage":
+		message := s.sentMessage(chatID)
+		message.Text = req.Params.Get("text")
+		return json.Marshal(message)
+	case "sendPhoto":
+		message := s.sentMessage(chatID)
+		message.Caption = req.Params.Get("caption")
+		message.Photo = s.sentPhoto(req.Params.Get("photo"), req.Files["photo"])
+		return json.Marshal(message)
+	case "sendDocument":
+		message := s.sentMessage(chatID)
+		message.Caption = req.Params.Get("caption")
+		message.Document = &tgbotapi.Document{FileID: s.AddFile(req.Files["document"])}
+		return json.Marshal(message)
+	case "sendMediaGroup":
+		var media []struct {
+			Media   string `json:"media"`
+			Caption string `json:"caption"`
+		}
+		err := json.Unmarshal([]byte(req.Params.Get("media")), &media)
+		if err != nil {
+			return nil, err
+		}
+
+		messages := make([]tgbotapi.Message, 0, len(media))
+		for i, item := range media {
+			message := s.sentMessage(chatID)
+			message.Caption = item.Caption
+			message.Photo = s.sentPhoto(item.Media, req.Files["file-"+strconv.Itoa(i)])
+			messages = append(messages, *message)
+		}
+		return json.Marshal(messages)
+	default:
+		return json.RawMessage("true"), nil
+	}
+}
+
+func (s *Server) sentMessage(chatID int64) *tgbotapi.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextMessageID++
+	return &tgbotapi.Message{
+		MessageID: s.nextMessageID,
+		From:      &tgbotapi.User{ID: botID, IsBot: true, UserName: s.BotUsername},
+		Chat:      &tgbotapi.Chat{ID: chatID, Type: "private"},
+		Date:      int(time.Now().Unix()),
+	}
+}
+
+// sentPhoto stores an uploaded photo under a new file_id, a photo sent by file_id keeps it.
+func (s *Server) sentPhoto(sent string, uploaded []byte) []tgbotapi.PhotoSize {
+	fileID := sent
+	if uploaded != nil {
+		fileID = s.AddFile(uploaded)
+	}
+
+	return []tgbotapi.PhotoSize{{FileID: fileID, FileUniqueID: "unique-" + fileID, Width: 800, Height: 600}}
+}
+
+func parseRequest(method string, r *http.Request) (Request, error) {
+	req := Request{Method: method, Files: make(map[string][]byte)}
+
+	err := r.ParseMultipartForm(32 << 20)
+	if err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return req, err
+	}
+	req.Params = r.Form
+
+	if r.MultipartForm != nil {
+		for field, headers := range r.MultipartForm.File {
+			file, err := headers[0].Open()
+			if err != nil {
+				return req, err
+			}
+			data, err := io.ReadAll(file)
+			file.Close()
+			if err != nil {
+				return req, err
+			}
+			req.Files[field] = data
+		}
+	}
+
+	return req, nil
+}
+
+func writeResult(w http.ResponseWriter, resp tgbotapi.APIResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,61 @@
+package telegram
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"net/http"
+)
+
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+var errEmptyWebhookSecret = errors.New("webhook secret must be set")
+
+// SetWebhook tells Telegram to post updates to url along with the secret token,
+// updates are then received by the route registered with RegisterWebhookRoute.
+func (b *Bot) SetWebhook(url, secret string) error {
+	if secret == "" {
+		return errEmptyWebhookSecret
+	}
+
+	_, err := b.client.MakeRequest("setWebhook", tgbotapi.Params{
+		"url":          url,
+		"secret_token": secret,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set webhook: %w", err)
+	}
+
+	b.l.Infof("Authorized on account %s, receiving updates on %s", b.username, url)
+	return nil
+}
+
+func (b *Bot) RegisterWebhookRoute(r chi.Router, path, secret string) {
+	r.Post(path, b.handleWebhook(secret))
+}
+
+func (b *Bot) handleWebhook(secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get(secretTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		update, err := b.client.HandleUpdate(r)
+		if err != nil {
+			b.l.Error(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		// Telegram redelivers updates that were not acknowledged, so one arriving during shutdown is not lost.
+		if !b.dispatcher.dispatch(*update) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
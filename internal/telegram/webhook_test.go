@@ -0,0 +1,103 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/fichca/image-loader/internal/i18n"
+	"github.com/fichca/image-loader/internal/telegram/telegramtest"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const webhookSecret = "secret"
+
+// newWebhookBot creates a bot that receives updates by the webhook only, it is not polling.
+func newWebhookBot(t *testing.T) (*Bot, *telegramtest.Server) {
+	t.Helper()
+
+	srv := telegramtest.NewServer()
+	t.Cleanup(srv.Close)
+
+	client, err := srv.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	return NewBotWithClient(client, srv.BotUsername, 1, 0, logger, newFakeTgService(), newFakeAuthService()), srv
+}
+
+func postUpdate(b *Bot, secret, body string) int {
+	r := httptest.NewRequest(http.MethodPost, "/telegram/webhook", strings.NewReader(body))
+	if secret != "" {
+		r.Header.Set(secretTokenHeader, secret)
+	}
+
+	w := httptest.NewRecorder()
+	b.handleWebhook(webhookSecret).ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestWebhook(t *testing.T) {
+	b, srv := newWebhookBot(t)
+
+	update, err := json.Marshal(srv.SendText(100, "/albums"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		secret string
+		body   string
+		status int
+	}{
+		{"no secret", "", string(update), http.StatusUnauthorized},
+		{"wrong secret", "wrong", string(update), http.StatusUnauthorized},
+		{"not an update", webhookSecret, "{", http.StatusBadRequest},
+		{"update", webhookSecret, string(update), http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := postUpdate(b, tt.secret, tt.body); got != tt.status {
+				t.Errorf("got status %d, want %d", got, tt.status)
+			}
+		})
+	}
+
+	// only the update with the right secret is handled
+	reqs := waitForText(t, srv, 1)
+	if got, want := reqs[0].Params.Get("text"), i18n.T(i18n.Default, i18n.AlbumsNotSupported); got != want {
+		t.Errorf("got reply %q, want %q", got, want)
+	}
+
+	err = b.Stop(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(srv.Requests("sendMessage")); got != 1 {
+		t.Errorf("got %d replies, want 1", got)
+	}
+
+	// Telegram redelivers an update refused during shutdown
+	if got := postUpdate(b, webhookSecret, string(update)); got != http.StatusServiceUnavailable {
+		t.Errorf("got status %d after stop, want %d", got, http.StatusServiceUnavailable)
+	}
+}
+
+func TestSetWebhookRequiresSecret(t *testing.T) {
+	b, _ := newWebhookBot(t)
+
+	err := b.SetWebhook("https://example.com/telegram/webhook", "")
+	if !errors.Is(err, errEmptyWebhookSecret) {
+		t.Errorf("got error %v, want %v", err, errEmptyWebhookSecret)
+	}
+}
@@ -0,0 +1,131 @@
+// Package validate checks input DTOs against the rules declared in their validate struct tags:
+//
+//	Login string `json:"login" validate:"required,max=64"`
+//
+// Rules are separated by commas. required rejects zero values and empty slices, min and max bound
+// the length of strings in characters, the length of slices and the value of numbers.
+// Rules of pointer fields apply to the values they point at, nil pointers only fail required.
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"github.com/fichca/image-loader/internal/apperr"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Code is the code of the errors returned for invalid input.
+const Code = "validation_failed"
+
+// Field error codes, the length and size variants tell how min and max were applied.
+const (
+	Required  = "required"
+	MinLength = "min_length"
+	MaxLength = "max_length"
+	Min       = "min"
+	Max       = "max"
+	MinItems  = "min_items"
+	MaxItems  = "max_items"
+)
+
+// Struct validates v, a struct or a pointer to one. It returns an *apperr.Error listing every broken rule,
+// fields are named by their json names.
+func Struct(v any) error {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		return fmt.Errorf("validate: %T is not a struct", v)
+	}
+
+	var fields []apperr.FieldError
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		tag, ok := field.Tag.Lookup("validate")
+		if !ok || !field.IsExported() {
+			continue
+		}
+
+		for _, rule := range strings.Split(tag, ",") {
+			name, param, _ := strings.Cut(rule, "=")
+			code, ok, err := check(value.Field(i), name, param)
+			if err != nil {
+				return fmt.Errorf("validate: field %s: %w", field.Name, err)
+			}
+			if !ok {
+				fields = append(fields, apperr.FieldError{Field: jsonName(field), Code: code, Param: param})
+				break
+			}
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	return &apperr.Error{
+		Kind:   apperr.KindValidation,
+		Code:   Code,
+		Err:    fmt.Errorf("invalid fields: %v", fields),
+		Fields: fields,
+	}
+}
+
+// check reports whether the value satisfies the rule and the code of the error when it does not.
+func check(value reflect.Value, rule, param string) (code string, ok bool, err error) {
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return Required, rule != Required, nil
+		}
+		value = value.Elem()
+	}
+
+	if rule == Required {
+		switch value.Kind() {
+		case reflect.Slice, reflect.Map:
+			return Required, value.Len() > 0, nil
+		default:
+			return Required, !value.IsZero(), nil
+		}
+	}
+
+	if rule != Min && rule != Max {
+		return "", false, fmt.Errorf("unknown rule %q", rule)
+	}
+
+	bound, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid %s bound %q", rule, param)
+	}
+
+	var size float64
+	codes := [2]string{Min, Max}
+	switch value.Kind() {
+	case reflect.String:
+		size, codes = float64(utf8.RuneCountInString(value.String())), [2]string{MinLength, MaxLength}
+	case reflect.Slice, reflect.Map:
+		size, codes = float64(value.Len()), [2]string{MinItems, MaxItems}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		size = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		size = value.Float()
+	default:
+		return "", false, errors.New(rule + " does not apply to " + value.Kind().String())
+	}
+
+	if rule == Min {
+		return codes[0], size >= bound, nil
+	}
+	return codes[1], size <= bound, nil
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
@@ -0,0 +1,129 @@
+package validate
+
+import (
+	"github.com/fichca/image-loader/internal/apperr"
+	"reflect"
+	"testing"
+)
+
+type sample struct {
+	Name   string   `json:"name" validate:"required,max=5"`
+	Login  string   `json:"login,omitempty" validate:"min=3"`
+	Tags   []string `json:"tags" validate:"min=1,max=2"`
+	Age    int      `json:"age" validate:"min=18,max=99"`
+	Size   uint     `json:"size" validate:"max=10"`
+	Score  float64  `json:"-" validate:"max=1.5"`
+	Note   *string  `json:"note" validate:"max=3"`
+	Ref    *int     `json:"ref" validate:"required"`
+	Free   string   `json:"free"`
+	hidden string   `validate:"required"`
+}
+
+func validSample() sample {
+	ref := 1
+	return sample{Name: "John", Login: "joe", Tags: []string{"a"}, Age: 30, Size: 10, Score: 1.5, Ref: &ref}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func TestStruct(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(s *sample)
+		want   []apperr.FieldError
+	}{
+		{"valid", func(s *sample) {}, nil},
+		{"required string", func(s *sample) { s.Name = "" }, []apperr.FieldError{{Field: "name", Code: Required}}},
+		{"max counts characters", func(s *sample) { s.Name = "Анна" }, nil},
+		{"string too long", func(s *sample) { s.Name = "Johnny" }, []apperr.FieldError{{Field: "name", Code: MaxLength, Param: "5"}}},
+		{"string too short", func(s *sample) { s.Login = "jo" }, []apperr.FieldError{{Field: "login", Code: MinLength, Param: "3"}}},
+		{"empty string below min", func(s *sample) { s.Login = "" }, []apperr.FieldError{{Field: "login", Code: MinLength, Param: "3"}}},
+		{"too few items", func(s *sample) { s.Tags = nil }, []apperr.FieldError{{Field: "tags", Code: MinItems, Param: "1"}}},
+		{"too many items", func(s *sample) { s.Tags = []string{"a", "b", "c"} }, []apperr.FieldError{{Field: "tags", Code: MaxItems, Param: "2"}}},
+		{"number below min", func(s *sample) { s.Age = 17 }, []apperr.FieldError{{Field: "age", Code: Min, Param: "18"}}},
+		{"number above max", func(s *sample) { s.Age = 100 }, []apperr.FieldError{{Field: "age", Code: Max, Param: "99"}}},
+		{"number on the bounds", func(s *sample) { s.Age = 18; s.Size = 10 }, nil},
+		{"unsigned above max", func(s *sample) { s.Size = 11 }, []apperr.FieldError{{Field: "size", Code: Max, Param: "10"}}},
+		{"float above max", func(s *sample) { s.Score = 1.6 }, []apperr.FieldError{{Field: "Score", Code: Max, Param: "1.5"}}},
+		{"nil pointer without required", func(s *sample) { s.Note = nil }, nil},
+		{"pointer checked by value", func(s *sample) { s.Note = stringPtr("abc") }, nil},
+		{"pointer value too long", func(s *sample) { s.Note = stringPtr("abcd") }, []apperr.FieldError{{Field: "note", Code: MaxLength, Param: "3"}}},
+		{"required pointer", func(s *sample) { s.Ref = nil }, []apperr.FieldError{{Field: "ref", Code: Required}}},
+		{"required pointer to zero", func(s *sample) { zero := 0; s.Ref = &zero }, []apperr.FieldError{{Field: "ref", Code: Required}}},
+		{"unexported fields are skipped", func(s *sample) { s.hidden = "" }, nil},
+		{
+			"first broken rule of every field",
+			func(s *sample) { s.Name = ""; s.Age = 5; s.Tags = []string{"a", "b", "c"} },
+			[]apperr.FieldError{
+				{Field: "name", Code: Required},
+				{Field: "tags", Code: MaxItems, Param: "2"},
+				{Field: "age", Code: Min, Param: "18"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := validSample()
+			tt.change(&s)
+
+			err := Struct(&s)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("got error %v, want none", err)
+				}
+				return
+			}
+
+			appErr, ok := apperr.As(err)
+			if !ok {
+				t.Fatalf("got error %v, want an *apperr.Error", err)
+			}
+			if appErr.Kind != apperr.KindValidation || appErr.Code != Code {
+				t.Errorf("got kind %s and code %s, want %s and %s", appErr.Kind, appErr.Code, apperr.KindValidation, Code)
+			}
+			if !reflect.DeepEqual(appErr.Fields, tt.want) {
+				t.Errorf("got fields %+v, want %+v", appErr.Fields, tt.want)
+			}
+		})
+	}
+}
+
+func TestStructValue(t *testing.T) {
+	err := Struct(validSample())
+	if err != nil {
+		t.Fatalf("got error %v, want none", err)
+	}
+}
+
+func TestStructInvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		v    any
+	}{
+		{"not a struct", 5},
+		{"unknown rule", &struct {
+			Email string `validate:"email"`
+		}{}},
+		{"invalid bound", &struct {
+			Name string `validate:"max=ten"`
+		}{}},
+		{"rule not applying to the kind", &struct {
+			Enabled bool `validate:"min=1"`
+		}{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Struct(tt.v)
+			if err == nil {
+				t.Fatal("got no error")
+			}
+			if _, ok := apperr.As(err); ok {
+				t.Errorf("got the validation error %v, want a programming error", err)
+			}
+		})
+	}
+}
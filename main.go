@@ -3,10 +3,14 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/fichca/image-loader/internal/config"
+	"github.com/fichca/image-loader/internal/event"
+	"github.com/fichca/image-loader/internal/fetcher"
 	"github.com/fichca/image-loader/internal/filestore"
 	"github.com/fichca/image-loader/internal/middleware"
+	"github.com/fichca/image-loader/internal/openapi"
 	"github.com/fichca/image-loader/internal/repository"
 	"github.com/fichca/image-loader/internal/server"
 	"github.com/fichca/image-loader/internal/service"
@@ -20,6 +24,10 @@ import (
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/sirupsen/logrus"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 )
 
 // @title           Image-loader
@@ -29,22 +37,97 @@ import (
 // @license.name  Apache 2.0
 // @license.url   http://www.apache.org/licenses/LICENSE-2.0.html
 
-// @host      localhost:8080
 // @BasePath  /
+// The host is not annotated, the spec served at /openapi.json takes its server from DOCS_BASE_URL.
 func main() {
 	logger := logrus.New()
+
+	command := commandAll
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+	if command != commandAll && command != commandAPI && command != commandBot {
+		logger.Fatalf("unknown command %q, run with %q, %q or no command to run both", command, commandAPI, commandBot)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	router := chi.NewRouter()
 
 	router.Use(middleware.Logger(logger))
+	router.Use(middleware.Language)
 
 	cfg := initConfig(logger)
 
-	userRepo, imageRepo, tgAuthRepo, fileStorage := initRepositories(logger, cfg)
+	dbConnection := initDBConnection(cfg.DB, logger)
+	defer func() {
+		err := dbConnection.Close()
+		if err != nil {
+			logger.Error(err)
+		}
+	}()
+	repos := initRepositories(logger, cfg, dbConnection)
+
+	// jobs are the background loops, they stop with ctx and are waited for before the database is closed
+	var jobs sync.WaitGroup
+
+	events := event.NewBus(logger)
+
+	authService := service.NewAuthService(repos.user, repos.tgAuth, cfg.JWTKeyword, cfg.TgBot.Username, cfg.TgBot.LinkCodeTTL)
+	fileService := service.NewFileService(repos.fileStorage, repos.image, events, logger, cfg.Upload.MaxSize,
+		cfg.Upload.PresignExpiry, cfg.Upload.BatchConcurrency, cfg.Archive.Prefetch)
+	notificationService := service.NewNotificationService(repos.notifications)
+
+	if command != commandBot {
+		initAPI(ctx, &jobs, cfg, logger, router, repos, events, authService, fileService, notificationService)
+	}
+
+	var bot *telegram.Bot
+	if command != commandAPI {
+		telegramService := service.NewTelegramService(fileService, notificationService, repos.tgState, repos.tgLanguages, repos.tgFiles,
+			repos.user, cfg.TgBot.StateTTL)
+		bot = initBot(cfg, logger, router, telegramService, authService)
+		if bot == nil && command == commandBot {
+			logger.Fatal("the bot is not configured, set TGBOT_API_KEY")
+		}
+	}
+
+	// The API and the bot share events in process, an API without its own bot passes them
+	// through Postgres to a bot running as a separate process.
+	relay := event.NewRelay(dbConnection, dataSourceName(cfg.DB), logger)
+	if bot != nil {
+		events.Subscribe(bot.Notify)
+	} else {
+		events.Subscribe(relay.Forward)
+	}
+	if command == commandBot {
+		runJob(ctx, &jobs, func(ctx context.Context) {
+			err := relay.Listen(ctx, events)
+			if err != nil {
+				logger.Error(err)
+			}
+		})
+	}
+
+	// A bot receiving updates by polling needs no HTTP server of its own.
+	listen := command != commandBot || cfg.TgBot.Mode == "webhook"
+	startServer(ctx, cfg.App, router, logger, bot, events, &jobs, listen)
+}
 
-	authService := service.NewAuthService(userRepo, tgAuthRepo, cfg.JWTKeyword)
-	fileService := service.NewFileService(fileStorage, imageRepo)
-	userService := service.NewUserService(userRepo, fileService)
-	telegramService := service.NewTelegramService(fileService)
+const (
+	commandAll = "all"
+	commandAPI = "api"
+	commandBot = "bot"
+)
+
+func initAPI(ctx context.Context, jobs *sync.WaitGroup, cfg *config.Config, logger *logrus.Logger, router *chi.Mux, repos repositories, events *event.Bus,
+	authService *service.AuthService, fileService *service.FileService, notificationService *service.NotificationService) {
+	userService := service.NewUserService(repos.user, fileService, events)
+	importService := service.NewImportService(repos.importJobs, initFetcher(cfg.Import, logger), fileService, logger,
+		cfg.Import.Workers, cfg.Import.MaxURLs)
+	uploadService := service.NewUploadService(repos.fileStorage, repos.upload, fileService, logger, cfg.Upload.PartSize,
+		cfg.Upload.MaxSize, cfg.Upload.TTL)
 
 	authMiddleware := middleware.Auth(authService, cfg.JWTKeyword, logger)
 
@@ -54,45 +137,177 @@ func main() {
 	fileHandler := server.NewFileHandler(logger, fileService, router, authMiddleware)
 	fileHandler.RegisterFileRoutes()
 
-	authHandler := server.NewAuthHandler(logger, authService, router)
+	uploadHandler := server.NewUploadHandler(logger, uploadService, router, authMiddleware)
+	uploadHandler.RegisterUploadRoutes()
+
+	importHandler := server.NewImportHandler(logger, importService, router, authMiddleware)
+	importHandler.RegisterImportRoutes()
+
+	notificationHandler := server.NewNotificationHandler(logger, notificationService, router, authMiddleware)
+	notificationHandler.RegisterNotificationRoutes()
+
+	authHandler := server.NewAuthHandler(logger, authService, router, authMiddleware)
 	authHandler.RegisterAuthRoutes()
 
-	initBot(cfg, logger, telegramService, authService)
-	startServer(cfg.App.Port, router, logger)
+	err := openapi.CheckRoutes(router, server.APIPrefix)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	if cfg.Docs.Enabled {
+		docsHandler := server.NewDocsHandler(logger, router, cfg.Docs.BaseURL)
+		docsHandler.RegisterDocsRoutes()
+	}
+
+	runJob(ctx, jobs, importService.Run)
+	runJob(ctx, jobs, uploadService.Run)
+	runJob(ctx, jobs, fileService.Run)
+}
+
+// runJob runs the job until ctx is done, jobs is done once it has returned.
+func runJob(ctx context.Context, jobs *sync.WaitGroup, job func(ctx context.Context)) {
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		job(ctx)
+	}()
 }
 
-func initBot(cfg *config.Config, logger *logrus.Logger, telegramService *service.TelegramService, authService *service.AuthService) {
-	bot, err := telegram.NewBot(cfg.TgBot.APIKey, logger, telegramService, authService)
+// initBot starts the bot, it returns nil when no bot token is configured.
+func initBot(cfg *config.Config, logger *logrus.Logger, router chi.Router, telegramService *service.TelegramService, authService *service.AuthService) *telegram.Bot {
+	if cfg.TgBot.APIKey == "" {
+		logger.Warning("TGBOT_API_KEY is not set, the Telegram bot is disabled")
+		return nil
+	}
+
+	bot, err := telegram.NewBot(cfg.TgBot.APIKey, cfg.TgBot.Workers, cfg.TgBot.CacheChatID, logger, telegramService, authService)
 	if err != nil {
 		logger.Fatal(err)
 	}
+
+	err = bot.RegisterCommands()
+	if err != nil {
+		logger.Error(err)
+	}
+
+	if cfg.TgBot.Mode == "webhook" {
+		err = bot.SetWebhook(cfg.TgBot.WebhookURL, cfg.TgBot.WebhookSecret)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		bot.RegisterWebhookRoute(router, cfg.TgBot.WebhookPath, cfg.TgBot.WebhookSecret)
+		return bot
+	}
+
 	go bot.StartBot()
+	return bot
 }
 
-func initRepositories(logger *logrus.Logger, cfg *config.Config) (*repository.UserRepo, *repository.ImageRepo, *repository.TgAuthRepo, *filestore.Minio) {
-	dbConnection := initDBConnection(cfg.DB, logger)
+type repositories struct {
+	user          *repository.UserRepo
+	image         *repository.ImageRepo
+	tgAuth        *repository.TgAuthRepo
+	tgState       *repository.TgStateRepo
+	tgLanguages   *repository.TgLanguageRepo
+	tgFiles       *repository.TgFileRepo
+	notifications *repository.NotificationRepo
+	upload        *repository.UploadRepo
+	importJobs    *repository.ImportRepo
+	fileStorage   *filestore.Minio
+}
+
+func initRepositories(logger *logrus.Logger, cfg *config.Config, dbConnection *sqlx.DB) repositories {
 	minioConnection := initMinioConnection(logger, cfg.Minio)
-	userRepo := repository.NewUserRepo(dbConnection)
-	imageRepo := repository.NewImageRepo(dbConnection)
-	tgAuthRepo := repository.NewTgAuthRepo(dbConnection)
-	fileStorage := filestore.NewMinio(minioConnection, cfg.Minio.Bucket)
+	repos := repositories{
+		user:          repository.NewUserRepo(dbConnection),
+		image:         repository.NewImageRepo(dbConnection),
+		tgAuth:        repository.NewTgAuthRepo(dbConnection),
+		tgState:       repository.NewTgStateRepo(dbConnection),
+		tgLanguages:   repository.NewTgLanguageRepo(dbConnection),
+		tgFiles:       repository.NewTgFileRepo(dbConnection),
+		notifications: repository.NewNotificationRepo(dbConnection),
+		upload:        repository.NewUploadRepo(dbConnection),
+		importJobs:    repository.NewImportRepo(dbConnection),
+		fileStorage:   filestore.NewMinio(minioConnection, cfg.Minio.Bucket),
+	}
 	err := RunMigrations(dbConnection.DB, cfg)
 	if err != nil {
 		logger.Warning(err)
 	}
-	return userRepo, imageRepo, tgAuthRepo, fileStorage
+	return repos
 }
 
-func startServer(listenURI string, r chi.Router, logger *logrus.Logger) {
+func initFetcher(cfg *config.Import, logger *logrus.Logger) *fetcher.Fetcher {
+	f, err := fetcher.NewFetcher(cfg.Timeout, cfg.MaxRedirects, cfg.MaxSize, cfg.AllowedCIDRs)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	return f
+}
+
+// startServer serves until ctx is done, then lets in-flight requests, bot updates, the background jobs
+// and the events they published finish. Without listen only the bot runs, bot may be nil when it is disabled.
+func startServer(ctx context.Context, cfg *config.App, r chi.Router, logger *logrus.Logger, bot *telegram.Bot, events *event.Bus,
+	jobs *sync.WaitGroup, listen bool) {
 	srv := http.Server{
-		Addr:    listenURI,
+		Addr:    cfg.Port,
 		Handler: r,
 	}
 
-	logger.Info(fmt.Sprintf("server is running on port %v!", listenURI))
-	err := srv.ListenAndServe()
+	if listen {
+		go func() {
+			logger.Info(fmt.Sprintf("server is running on port %v!", cfg.Port))
+			err := srv.ListenAndServe()
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Fatal(err)
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	logger.Info("shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if listen {
+		err := srv.Shutdown(shutdownCtx)
+		if err != nil {
+			logger.Error(err)
+		}
+	}
+
+	if bot != nil {
+		err := bot.Stop(shutdownCtx)
+		if err != nil {
+			logger.Error(err)
+		}
+	}
+
+	err := waitJobs(shutdownCtx, jobs)
 	if err != nil {
-		logger.Fatal(err)
+		logger.Error(err)
+	}
+
+	err = events.Close(shutdownCtx)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+// waitJobs waits for the jobs to return, or for ctx to be done first.
+func waitJobs(ctx context.Context, jobs *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		jobs.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("background jobs did not finish: %w", ctx.Err())
 	}
 }
 
@@ -130,14 +345,17 @@ func initConfig(logger *logrus.Logger) *config.Config {
 }
 
 func initDBConnection(cfg *config.DB, logger *logrus.Logger) *sqlx.DB {
-	db, err := sqlx.Connect(cfg.Driver, fmt.Sprintf("user=%s dbname=%s sslmode=%s password=%s", cfg.User,
-		cfg.Name, cfg.SSLMode, cfg.Password))
+	db, err := sqlx.Connect(cfg.Driver, dataSourceName(cfg))
 	if err != nil {
 		logger.Fatal(err)
 	}
 	return db
 }
 
+func dataSourceName(cfg *config.DB) string {
+	return fmt.Sprintf("user=%s dbname=%s sslmode=%s password=%s", cfg.User, cfg.Name, cfg.SSLMode, cfg.Password)
+}
+
 func RunMigrations(dbConnection *sql.DB, cfg *config.Config) error {
 	driver, err := postgres.WithInstance(dbConnection, &postgres.Config{})
 	if err != nil {